@@ -0,0 +1,69 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Claims what the application server grants a participant, clients can not change it
+// without the secret
+type Claims struct {
+	SignalID string `json:"signalID"`
+	Role     string `json:"role"`
+	Expires  int64  `json:"exp"` // unix seconds, 0 never expires
+}
+
+// Sign claims into a token, payload and signature in base64url separated by a dot
+func Sign(secret []byte, claims *Claims) (string, error) {
+	if len(secret) == 0 {
+		return "", fmt.Errorf("Missing token secret")
+	}
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+	encoded := base64.RawURLEncoding.EncodeToString(payload)
+	return encoded + "." + base64.RawURLEncoding.EncodeToString(sign(secret, encoded)), nil
+}
+
+// Verify token was signed with secret and has not expired at now, return its claims
+func Verify(secret []byte, token string, now time.Time) (*Claims, error) {
+	if len(secret) == 0 {
+		return nil, fmt.Errorf("Missing token secret")
+	}
+	parts := strings.Split(token, ".")
+	if len(parts) != 2 {
+		return nil, fmt.Errorf("Malformed token")
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, fmt.Errorf("Malformed token signature: %v", err)
+	}
+	if !hmac.Equal(signature, sign(secret, parts[0])) {
+		return nil, fmt.Errorf("Invalid token signature")
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return nil, fmt.Errorf("Malformed token payload: %v", err)
+	}
+	claims := &Claims{}
+	if err := json.Unmarshal(payload, claims); err != nil {
+		return nil, fmt.Errorf("Malformed token payload: %v", err)
+	}
+	if claims.Expires != 0 && now.Unix() > claims.Expires {
+		return nil, fmt.Errorf("Token of %s expired", claims.SignalID)
+	}
+	return claims, nil
+}
+
+func sign(secret []byte, data string) []byte {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
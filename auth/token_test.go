@@ -0,0 +1,36 @@
+package auth
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSignAndVerify(t *testing.T) {
+	secret := []byte("secret")
+	now := time.Now()
+	token, err := Sign(secret, &Claims{SignalID: "alice", Role: "host", Expires: now.Add(time.Minute).Unix()})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	claims, err := Verify(secret, token, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if claims.SignalID != "alice" || claims.Role != "host" {
+		t.Fatalf("unexpected claims %+v", claims)
+	}
+
+	if _, err := Verify([]byte("other"), token, now); err == nil {
+		t.Fatal("token verified with another secret")
+	}
+	if _, err := Verify(secret, token, now.Add(2*time.Minute)); err == nil {
+		t.Fatal("expired token verified")
+	}
+
+	// a client changing its role breaks the signature
+	forged, _ := Sign([]byte("guess"), &Claims{SignalID: "alice", Role: "host"})
+	if _, err := Verify(secret, forged, now); err == nil {
+		t.Fatal("forged token verified")
+	}
+}
@@ -0,0 +1,68 @@
+package avsync
+
+import (
+	"sync"
+	"time"
+
+	"github.com/pion/rtp"
+)
+
+type delayed struct {
+	pkt     *rtp.Packet
+	release time.Time
+}
+
+// Delayer hold packets for a while keeping their order
+type Delayer struct {
+	chann    chan *delayed
+	handler  func(pkt *rtp.Packet)
+	isClosed bool
+	mutex    sync.RWMutex
+}
+
+// NewDelayer linter
+func NewDelayer(handler func(pkt *rtp.Packet)) *Delayer {
+	d := &Delayer{
+		chann:   make(chan *delayed, 1000),
+		handler: handler,
+	}
+	go d.serve()
+	return d
+}
+
+// Push packet to handle after delay
+func (d *Delayer) Push(pkt *rtp.Packet, delay time.Duration) {
+	d.mutex.RLock()
+	defer d.mutex.RUnlock()
+	if d.isClosed {
+		return
+	}
+	d.chann <- &delayed{
+		pkt:     pkt,
+		release: time.Now().Add(delay),
+	}
+}
+
+// Close linter
+func (d *Delayer) Close() {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	if !d.isClosed {
+		d.isClosed = true
+		close(d.chann)
+	}
+}
+
+func (d *Delayer) serve() {
+	for {
+		item, open := <-d.chann
+		if !open {
+			return
+		}
+		if wait := time.Until(item.release); wait > 0 {
+			time.Sleep(wait)
+		}
+		d.handler(item.pkt)
+		item = nil
+	}
+}
@@ -0,0 +1,31 @@
+package avsync
+
+import (
+	"time"
+)
+
+// seconds between 1900 (ntp epoch) and 1970 (unix epoch)
+const ntpEpochOffset = 2208988800
+
+// ToNTP convert wallclock to 64 bits ntp timestamp
+func ToNTP(t time.Time) uint64 {
+	nsec := uint64(t.UnixNano())
+	sec := nsec/1e9 + ntpEpochOffset
+	frac := (nsec % 1e9) << 32 / 1e9
+	return sec<<32 | frac
+}
+
+// FromNTP convert 64 bits ntp timestamp to wallclock
+func FromNTP(ntp uint64) time.Time {
+	sec := int64(ntp>>32) - ntpEpochOffset
+	nsec := int64((ntp & 0xffffffff) * 1e9 >> 32)
+	return time.Unix(sec, nsec)
+}
+
+// rtpDuration convert a rtp timestamp difference to duration
+func rtpDuration(delta int32, clockRate uint32) time.Duration {
+	if clockRate == 0 {
+		return 0
+	}
+	return time.Duration(int64(delta) * int64(time.Second) / int64(clockRate))
+}
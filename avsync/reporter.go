@@ -0,0 +1,59 @@
+package avsync
+
+import (
+	"sync"
+	"time"
+
+	"github.com/pion/rtcp"
+	"github.com/pion/rtp"
+)
+
+// Reporter build sender reports of a local track from the packets written to it
+type Reporter struct {
+	ssrc        uint32
+	clockRate   uint32
+	lastRTP     uint32    // rtp timestamp of the last written packet
+	lastTime    time.Time // wallclock when the last packet was written
+	packetCount uint32
+	octetCount  uint32
+	hasPacket   bool
+	mutex       sync.RWMutex
+}
+
+// NewReporter linter
+func NewReporter(ssrc uint32, clockRate uint32) *Reporter {
+	return &Reporter{
+		ssrc:      ssrc,
+		clockRate: clockRate,
+	}
+}
+
+// OnPacket save rtp to wallclock mapping of a written packet.
+// Mixer output is paced in real time so the write time is the media clock
+func (r *Reporter) OnPacket(pkt *rtp.Packet, now time.Time) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.lastRTP = pkt.Timestamp
+	r.lastTime = now
+	r.packetCount++
+	r.octetCount += uint32(len(pkt.Payload))
+	r.hasPacket = true
+}
+
+// Report return sender report at now, nil if nothing was sent yet
+func (r *Reporter) Report(now time.Time) *rtcp.SenderReport {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	if !r.hasPacket {
+		return nil
+	}
+
+	elapsed := now.Sub(r.lastTime)
+	return &rtcp.SenderReport{
+		SSRC:        r.ssrc,
+		NTPTime:     ToNTP(now),
+		RTPTime:     r.lastRTP + uint32(elapsed*time.Duration(r.clockRate)/time.Second),
+		PacketCount: r.packetCount,
+		OctetCount:  r.octetCount,
+	}
+}
@@ -0,0 +1,104 @@
+package avsync
+
+import (
+	"sync"
+	"time"
+
+	"github.com/pion/rtcp"
+	"github.com/pion/rtp"
+)
+
+const (
+	maxDelay      = time.Second // never hold a stream more than this
+	transitWeight = 0.1         // smoothing factor of transit time
+)
+
+// stream save sender report and transit time of one remote track
+type stream struct {
+	clockRate  uint32
+	srNTP      time.Time // wallclock of the last sender report
+	srRTP      uint32    // rtp timestamp of the last sender report
+	hasSR      bool
+	transit    time.Duration // smoothed arrival - capture time
+	hasTransit bool
+}
+
+// Synchronizer compute how much each remote track must be held
+// so audio and video of one publisher reach the mixer in sync
+type Synchronizer struct {
+	streams map[string]*stream // kind - stream
+	mutex   sync.RWMutex
+}
+
+// NewSynchronizer linter
+func NewSynchronizer() *Synchronizer {
+	return &Synchronizer{
+		streams: make(map[string]*stream),
+	}
+}
+
+func (s *Synchronizer) getStream(kind string, clockRate uint32) *stream {
+	st, ok := s.streams[kind]
+	if !ok {
+		st = &stream{}
+		s.streams[kind] = st
+	}
+	if clockRate != 0 {
+		st.clockRate = clockRate
+	}
+	return st
+}
+
+// AddSenderReport save ntp to rtp mapping of remote track kind
+func (s *Synchronizer) AddSenderReport(kind string, clockRate uint32, sr *rtcp.SenderReport) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	st := s.getStream(kind, clockRate)
+	st.srNTP = FromNTP(sr.NTPTime)
+	st.srRTP = sr.RTPTime
+	st.hasSR = true
+}
+
+// Update transit time of remote track kind with an incoming packet
+func (s *Synchronizer) Update(kind string, pkt *rtp.Packet, arrival time.Time) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	st, ok := s.streams[kind]
+	if !ok || !st.hasSR {
+		return
+	}
+
+	capture := st.srNTP.Add(rtpDuration(int32(pkt.Timestamp-st.srRTP), st.clockRate))
+	transit := arrival.Sub(capture)
+	if !st.hasTransit {
+		st.transit = transit
+		st.hasTransit = true
+		return
+	}
+	st.transit += time.Duration(float64(transit-st.transit) * transitWeight)
+}
+
+// Delay return how long packets of this kind must be held before mixing
+func (s *Synchronizer) Delay(kind string) time.Duration {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	current, ok := s.streams[kind]
+	if !ok || !current.hasTransit {
+		return 0
+	}
+
+	for other, st := range s.streams {
+		if other == kind || !st.hasTransit {
+			continue
+		}
+		// this stream arrives earlier than the other one
+		if diff := st.transit - current.transit; diff > 0 {
+			if diff > maxDelay {
+				return maxDelay
+			}
+			return diff
+		}
+	}
+	return 0
+}
@@ -0,0 +1,139 @@
+package cascade
+
+import (
+	"bytes"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/lamhai1401/testrtc/utils"
+	"github.com/pion/rtp"
+)
+
+var secret = []byte("secret")
+
+func TestUplinkToServer(t *testing.T) {
+	joined := make(chan string, 1)
+	received := make(chan *utils.Wrapper, 10)
+	left := make(chan string, 1)
+	server, err := NewServer("127.0.0.1:0", 1, secret, nil, func(id string) error {
+		joined <- id
+		return nil
+	}, func(id string, wrapper *utils.Wrapper) {
+		received <- wrapper
+	}, func(id string) {
+		left <- id
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+	go server.Serve()
+
+	uplink := NewUplink(server.GetAddr(), &Hello{ID: "edge", Level: 0}, secret)
+	uplink.Start()
+	defer uplink.Close()
+
+	select {
+	case id := <-joined:
+		if id != "edge" {
+			t.Fatalf("joined as %s", id)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("child did not join")
+	}
+
+	// the parent answers before the uplink is set, so push until it is
+	pkt := rtp.Packet{
+		Header:  rtp.Header{Version: 2, PayloadType: 96, SequenceNumber: 7, Timestamp: 9000, SSRC: 42},
+		Payload: []byte{1, 2, 3},
+	}
+	var wrapper *utils.Wrapper
+	for wrapper == nil {
+		uplink.Push(&utils.Wrapper{Pkg: pkt, Kind: "video", SeatID: 2})
+		select {
+		case wrapper = <-received:
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+	if wrapper.Kind != "video" || wrapper.SeatID != 2 || wrapper.Pkg.SequenceNumber != 7 || !bytes.Equal(wrapper.Pkg.Payload, pkt.Payload) {
+		t.Fatalf("unexpected wrapper %+v", wrapper)
+	}
+
+	server.Drop("edge")
+	select {
+	case <-left:
+	case <-time.After(time.Second):
+		t.Fatal("dropped child did not leave")
+	}
+}
+
+// sayHello answer the challenge of the server at addr with secret, return the answer to hello
+func sayHello(t *testing.T, addr string, hello *Hello, secret []byte) *utils.Wrapper {
+	raw, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := newConn(raw)
+	defer c.close()
+
+	challenge, err := c.read()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if challenge.Type != TypeChallenge {
+		t.Fatalf("first wrapper is %s, want %s", challenge.Type, TypeChallenge)
+	}
+	hello.Proof = prove(secret, challenge.Data, hello)
+	data, _ := utils.ToByte(hello)
+	if err := c.write(&utils.Wrapper{Type: TypeOk, Data: data}); err != nil {
+		t.Fatal(err)
+	}
+	answer, err := c.read()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return answer
+}
+
+func TestRefuseChild(t *testing.T) {
+	server, err := NewServer("127.0.0.1:0", 2, secret, nil, func(id string) error {
+		t.Fatalf("child %s joined", id)
+		return nil
+	}, func(id string, wrapper *utils.Wrapper) {}, func(id string) {})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+	go server.Serve()
+
+	if answer := sayHello(t, server.GetAddr(), &Hello{ID: "edge", Level: 0}, secret); answer.Type != TypeError {
+		t.Fatalf("child of level 0 got %s, want %s", answer.Type, TypeError)
+	}
+	if answer := sayHello(t, server.GetAddr(), &Hello{ID: "edge", Level: 1}, []byte("guess")); answer.Type != TypeError {
+		t.Fatalf("child without the secret got %s, want %s", answer.Type, TypeError)
+	}
+}
+
+func TestRefuseAddress(t *testing.T) {
+	_, other, _ := net.ParseCIDR("192.0.2.0/24")
+	server, err := NewServer("127.0.0.1:0", 1, secret, []*net.IPNet{other}, func(id string) error {
+		t.Fatalf("child %s joined", id)
+		return nil
+	}, func(id string, wrapper *utils.Wrapper) {}, func(id string) {})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+	go server.Serve()
+
+	raw, err := net.Dial("tcp", server.GetAddr())
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := newConn(raw)
+	defer c.close()
+	if wrapper, err := c.read(); err == nil {
+		t.Fatalf("child from a refused address got %s", wrapper.Type)
+	}
+}
@@ -0,0 +1,97 @@
+package cascade
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/lamhai1401/testrtc/utils"
+)
+
+// types of wrappers between nodes
+const (
+	TypeData      = "data"      // Data is an rtp packet of the mixed output
+	TypeChallenge = "challenge" // Data is the nonce the parent sends first, the child proves the secret with it
+	TypeOk        = "ok"        // Data is the hello of a child, the parent answers with an empty one
+	TypeError     = "error"     // Data is why the parent refused a child
+	TypePing      = "ping"
+	TypePong      = "pong"
+
+	dialTimeout  = 5 * time.Second
+	writeTimeout = 5 * time.Second
+	pingInterval = 5 * time.Second
+	readTimeout  = 3 * pingInterval
+	nonceSize    = 32
+)
+
+// Hello introduce a child to its parent
+type Hello struct {
+	ID    string `json:"id"`    // participant id of the sub-mix at the parent
+	Level int    `json:"level"` // must be one below the parent
+	Proof string `json:"proof"` // hmac of the challenge, id and level with the cascade secret
+}
+
+// newNonce random challenge of a parent
+func newNonce() ([]byte, error) {
+	nonce := make([]byte, nonceSize)
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return nonce, nil
+}
+
+// prove hello answers nonce, only nodes sharing secret can compute it
+func prove(secret []byte, nonce []byte, hello *Hello) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write(nonce)
+	mac.Write([]byte(fmt.Sprintf("|%s|%d", hello.ID, hello.Level)))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// conn json encoded wrappers over tcp, one writer at a time
+type conn struct {
+	raw        net.Conn
+	encoder    *json.Encoder
+	decoder    *json.Decoder
+	writeMutex sync.Mutex
+}
+
+func newConn(raw net.Conn) *conn {
+	return &conn{
+		raw:     raw,
+		encoder: json.NewEncoder(raw),
+		decoder: json.NewDecoder(raw),
+	}
+}
+
+func (c *conn) write(wrapper *utils.Wrapper) error {
+	c.writeMutex.Lock()
+	defer c.writeMutex.Unlock()
+	c.raw.SetWriteDeadline(time.Now().Add(writeTimeout))
+	return c.encoder.Encode(wrapper)
+}
+
+// read next wrapper, a data one has its packet unmarshalled to Pkg
+func (c *conn) read() (*utils.Wrapper, error) {
+	c.raw.SetReadDeadline(time.Now().Add(readTimeout))
+	wrapper := &utils.Wrapper{}
+	if err := c.decoder.Decode(wrapper); err != nil {
+		return nil, err
+	}
+	if wrapper.Type == TypeData {
+		if err := wrapper.Pkg.Unmarshal(wrapper.Data); err != nil {
+			return nil, fmt.Errorf("Invalid rtp packet of %s: %v", wrapper.Kind, err)
+		}
+	}
+	return wrapper, nil
+}
+
+func (c *conn) close() error {
+	return c.raw.Close()
+}
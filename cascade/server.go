@@ -0,0 +1,233 @@
+package cascade
+
+import (
+	"crypto/hmac"
+	"fmt"
+	"net"
+	"sync"
+
+	"github.com/lamhai1401/gologs/logs"
+	"github.com/lamhai1401/testrtc/utils"
+)
+
+// Server accept children one level below, the mixed output of each child arrives
+// as the wrappers of one participant. Children prove they know the cascade secret
+type Server struct {
+	level    int
+	secret   []byte
+	allowed  []*net.IPNet // networks children may connect from, empty is any
+	listener net.Listener
+	join     func(id string) error // refuse the child with an error
+	push     func(id string, wrapper *utils.Wrapper)
+	leave    func(id string)
+	children *utils.AdvanceMap // id - *conn
+	isClosed bool
+	mutex    sync.Mutex
+}
+
+// NewServer listen on addr for children of level - 1 sharing secret
+func NewServer(addr string, level int, secret []byte, allowed []*net.IPNet, join func(id string) error, push func(id string, wrapper *utils.Wrapper), leave func(id string)) (*Server, error) {
+	if level < 1 {
+		return nil, fmt.Errorf("Node of level %d has no level below", level)
+	}
+	if len(secret) == 0 {
+		return nil, fmt.Errorf("Missing cascade secret")
+	}
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	return &Server{
+		level:    level,
+		secret:   secret,
+		allowed:  allowed,
+		listener: listener,
+		join:     join,
+		push:     push,
+		leave:    leave,
+		children: utils.NewAdvanceMap(),
+	}, nil
+}
+
+// GetAddr address children connect to
+func (s *Server) GetAddr() string {
+	return s.listener.Addr().String()
+}
+
+// Serve accept children until closed
+func (s *Server) Serve() {
+	for {
+		raw, err := s.listener.Accept()
+		if err != nil {
+			if !s.checkClose() {
+				logs.Error("Accept cascade child err: ", err.Error())
+			}
+			return
+		}
+		go s.handle(newConn(raw))
+	}
+}
+
+func (s *Server) handle(c *conn) {
+	defer c.close()
+
+	if !s.isAllowed(c.raw.RemoteAddr()) {
+		logs.Warn(fmt.Sprintf("Refuse cascade child %s: address is not allowed", c.raw.RemoteAddr()))
+		return
+	}
+
+	hello, err := s.accept(c)
+	if err != nil {
+		logs.Warn(fmt.Sprintf("Refuse cascade child %s: %v", c.raw.RemoteAddr(), err))
+		c.write(&utils.Wrapper{Type: TypeError, Data: []byte(err.Error())})
+		return
+	}
+	logs.Info(fmt.Sprintf("Cascade child %s of level %d joined", hello.ID, hello.Level))
+
+	defer func() {
+		s.children.Delete(hello.ID)
+		s.leave(hello.ID)
+		logs.Info(fmt.Sprintf("Cascade child %s left", hello.ID))
+	}()
+
+	for {
+		wrapper, err := c.read()
+		if err != nil {
+			if !s.checkClose() {
+				logs.Warn(fmt.Sprintf("Read cascade child %s err: %v", hello.ID, err))
+			}
+			return
+		}
+
+		switch wrapper.Type {
+		case TypeData:
+			s.push(hello.ID, wrapper)
+		case TypePing:
+			if err := c.write(&utils.Wrapper{Type: TypePong}); err != nil {
+				logs.Warn(fmt.Sprintf("Write cascade child %s err: %v", hello.ID, err))
+				return
+			}
+		}
+	}
+}
+
+// isAllowed check addr is in an allowed network
+func (s *Server) isAllowed(addr net.Addr) bool {
+	if len(s.allowed) == 0 {
+		return true
+	}
+	tcp, ok := addr.(*net.TCPAddr)
+	if !ok {
+		return false
+	}
+	for _, network := range s.allowed {
+		if network.Contains(tcp.IP) {
+			return true
+		}
+	}
+	return false
+}
+
+// accept challenge a child, read its hello and let it join
+func (s *Server) accept(c *conn) (*Hello, error) {
+	nonce, err := newNonce()
+	if err != nil {
+		return nil, err
+	}
+	if err := c.write(&utils.Wrapper{Type: TypeChallenge, Data: nonce}); err != nil {
+		return nil, err
+	}
+
+	wrapper, err := c.read()
+	if err != nil {
+		return nil, err
+	}
+	if wrapper.Type != TypeOk {
+		return nil, fmt.Errorf("Expect %s, got %s", TypeOk, wrapper.Type)
+	}
+
+	hello := &Hello{}
+	if err := utils.ToJSON(wrapper.Data, hello); err != nil {
+		return nil, fmt.Errorf("Invalid hello: %v", err)
+	}
+	if hello.ID == "" {
+		return nil, fmt.Errorf("Missing child ID")
+	}
+	if !hmac.Equal([]byte(hello.Proof), []byte(prove(s.secret, nonce, hello))) {
+		return nil, fmt.Errorf("Child %s does not know the cascade secret", hello.ID)
+	}
+	if hello.Level != s.level-1 {
+		return nil, fmt.Errorf("Child of level %d can not join level %d", hello.Level, s.level)
+	}
+
+	if err := s.register(hello.ID, c); err != nil {
+		return nil, err
+	}
+	// join and the answer may block, Close drops the registered child meanwhile
+	if err := s.join(hello.ID); err != nil {
+		s.children.Delete(hello.ID)
+		return nil, err
+	}
+	if err := c.write(&utils.Wrapper{Type: TypeOk}); err != nil {
+		s.children.Delete(hello.ID)
+		s.leave(hello.ID)
+		return nil, err
+	}
+	return hello, nil
+}
+
+// register child id on c, refused when the server is closed or id is taken
+func (s *Server) register(id string, c *conn) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.isClosed {
+		return fmt.Errorf("Server is closed")
+	}
+	if _, has := s.children.Get(id); has {
+		return fmt.Errorf("Child %s already joined", id)
+	}
+	s.children.Set(id, c)
+	return nil
+}
+
+// GetChildren ids of joined children
+func (s *Server) GetChildren() []string {
+	return s.children.GetKeys()
+}
+
+// HasChild check child id joined
+func (s *Server) HasChild(id string) bool {
+	_, has := s.children.Get(id)
+	return has
+}
+
+// Drop close the connection of child id, it leaves once its reader stops
+func (s *Server) Drop(id string) {
+	if value, has := s.children.Get(id); has {
+		if c, ok := value.(*conn); ok {
+			c.close()
+		}
+	}
+}
+
+func (s *Server) checkClose() bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.isClosed
+}
+
+// Close stop accepting and drop every child
+func (s *Server) Close() {
+	s.mutex.Lock()
+	if s.isClosed {
+		s.mutex.Unlock()
+		return
+	}
+	s.isClosed = true
+	s.mutex.Unlock()
+
+	s.listener.Close()
+	for _, id := range s.GetChildren() {
+		s.Drop(id)
+	}
+}
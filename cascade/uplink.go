@@ -0,0 +1,221 @@
+package cascade
+
+import (
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/lamhai1401/gologs/logs"
+	"github.com/lamhai1401/testrtc/utils"
+)
+
+const (
+	minRetry  = time.Second
+	maxRetry  = 30 * time.Second
+	queueSize = 500
+)
+
+// Uplink send the mixed output of this node to its parent one level above,
+// reconnecting until closed. Wrappers pushed while disconnected are dropped
+type Uplink struct {
+	addr     string
+	hello    *Hello
+	secret   []byte
+	queue    chan *utils.Wrapper
+	conn     *conn
+	isClosed bool
+	closed   chan struct{}
+	mutex    sync.Mutex
+}
+
+// NewUplink send as hello, proving secret shared with the parent
+func NewUplink(addr string, hello *Hello, secret []byte) *Uplink {
+	return &Uplink{
+		addr:   addr,
+		hello:  hello,
+		secret: secret,
+		queue:  make(chan *utils.Wrapper, queueSize),
+		closed: make(chan struct{}),
+	}
+}
+
+// Start connecting in background
+func (u *Uplink) Start() {
+	go u.run()
+}
+
+func (u *Uplink) run() {
+	retry := minRetry
+	for {
+		c, err := u.dial()
+		if err != nil {
+			logs.Error(fmt.Sprintf("Connect cascade parent %s err: %v, retry in %s", u.addr, err, retry))
+			select {
+			case <-u.closed:
+				return
+			case <-time.After(retry):
+			}
+			if retry *= 2; retry > maxRetry {
+				retry = maxRetry
+			}
+			continue
+		}
+
+		retry = minRetry
+		if !u.setConn(c) {
+			c.close()
+			return
+		}
+		logs.Info(fmt.Sprintf("Cascade %s joined parent %s", u.hello.ID, u.addr))
+		u.serve(c)
+		u.setConn(nil)
+
+		if u.checkClose() {
+			return
+		}
+	}
+}
+
+// dial connect, answer the challenge of the parent and say hello, the parent may refuse
+func (u *Uplink) dial() (*conn, error) {
+	raw, err := net.DialTimeout("tcp", u.addr, dialTimeout)
+	if err != nil {
+		return nil, err
+	}
+	c := newConn(raw)
+
+	challenge, err := c.read()
+	if err != nil {
+		c.close()
+		return nil, err
+	}
+	if challenge.Type != TypeChallenge {
+		c.close()
+		return nil, fmt.Errorf("Expect %s, got %s", TypeChallenge, challenge.Type)
+	}
+	proved := *u.hello
+	proved.Proof = prove(u.secret, challenge.Data, &proved)
+
+	hello, err := utils.ToByte(&proved)
+	if err != nil {
+		c.close()
+		return nil, err
+	}
+	if err := c.write(&utils.Wrapper{Type: TypeOk, Data: hello}); err != nil {
+		c.close()
+		return nil, err
+	}
+
+	answer, err := c.read()
+	if err != nil {
+		c.close()
+		return nil, err
+	}
+	switch answer.Type {
+	case TypeOk:
+		return c, nil
+	case TypeError:
+		c.close()
+		return nil, fmt.Errorf("Parent refused: %s", answer.Data)
+	default:
+		c.close()
+		return nil, fmt.Errorf("Expect %s, got %s", TypeOk, answer.Type)
+	}
+}
+
+// serve write queued wrappers and pings until the connection fails or uplink is closed
+func (u *Uplink) serve(c *conn) {
+	defer c.close()
+
+	// pongs keep the read deadline away, a silent parent fails the read
+	failed := make(chan struct{})
+	go func() {
+		defer close(failed)
+		for {
+			if _, err := c.read(); err != nil {
+				if !u.checkClose() {
+					logs.Warn(fmt.Sprintf("Read cascade parent %s err: %v", u.addr, err))
+				}
+				return
+			}
+		}
+	}()
+
+	ticker := time.NewTicker(pingInterval)
+	defer ticker.Stop()
+	for {
+		var wrapper *utils.Wrapper
+		select {
+		case <-u.closed:
+			return
+		case <-failed:
+			return
+		case <-ticker.C:
+			wrapper = &utils.Wrapper{Type: TypePing}
+		case wrapper = <-u.queue:
+		}
+
+		if err := c.write(wrapper); err != nil {
+			logs.Warn(fmt.Sprintf("Write cascade parent %s err: %v", u.addr, err))
+			return
+		}
+	}
+}
+
+// Push a mixed packet to the parent without blocking, it is dropped when the queue is full
+func (u *Uplink) Push(wrapper *utils.Wrapper) {
+	if u.getConn() == nil {
+		return
+	}
+
+	// wrapper is reused by its forwarder, so the packet is marshalled now
+	data, err := wrapper.Pkg.Marshal()
+	if err != nil {
+		logs.Error(fmt.Sprintf("Marshal cascade %s packet err: %v", wrapper.Kind, err))
+		return
+	}
+
+	select {
+	case u.queue <- &utils.Wrapper{Data: data, Kind: wrapper.Kind, SeatID: wrapper.SeatID, Type: TypeData}:
+	default:
+	}
+}
+
+func (u *Uplink) getConn() *conn {
+	u.mutex.Lock()
+	defer u.mutex.Unlock()
+	return u.conn
+}
+
+// setConn return false if uplink was closed meanwhile, queued wrappers of the last
+// connection are dropped so the parent does not get stale packets
+func (u *Uplink) setConn(c *conn) bool {
+	u.mutex.Lock()
+	defer u.mutex.Unlock()
+	if u.isClosed {
+		return false
+	}
+	u.conn = c
+	for len(u.queue) > 0 {
+		<-u.queue
+	}
+	return true
+}
+
+func (u *Uplink) checkClose() bool {
+	u.mutex.Lock()
+	defer u.mutex.Unlock()
+	return u.isClosed
+}
+
+// Close stop sending and disconnect
+func (u *Uplink) Close() {
+	u.mutex.Lock()
+	defer u.mutex.Unlock()
+	if u.isClosed {
+		return
+	}
+	u.isClosed = true
+	close(u.closed)
+}
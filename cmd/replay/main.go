@@ -0,0 +1,159 @@
+// Command replay feed rtp dump files back through the mixer with their original timing.
+//
+//	replay [-out dir] [-config mixer.json -room name] capture1.rtpdump [capture2.rtpdump ...]
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"sync"
+
+	"github.com/lamhai1401/gologs/logs"
+	"github.com/lamhai1401/testrtc/mixer"
+	"github.com/lamhai1401/testrtc/recorder"
+	"github.com/lamhai1401/testrtc/rtpdump"
+	"github.com/lamhai1401/testrtc/utils"
+	"github.com/pion/rtp"
+)
+
+func main() {
+	out := flag.String("out", "", "folder to record mixer output as webm, empty is not recording")
+	configPath := flag.String("config", utils.GetMixerConfig(), "json file of mixer configs by room, empty is the config from env")
+	room := flag.String("room", mixer.DefaultRoom, "room whose mixer config is used")
+	flag.Parse()
+
+	if flag.NArg() == 0 {
+		fmt.Fprintln(os.Stderr, "usage: replay [-out dir] [-config mixer.json -room name] capture.rtpdump ...")
+		os.Exit(2)
+	}
+
+	config := mixer.DefaultConfig()
+	if *configPath != "" {
+		configs, err := mixer.LoadConfigs(*configPath)
+		if err != nil {
+			logs.Error("Load mixer configs err: ", err.Error())
+			os.Exit(1)
+		}
+		config = configs.Get(*room)
+	}
+	if err := config.Validate(); err != nil {
+		logs.Error("Invalid mixer config err: ", err.Error())
+		os.Exit(1)
+	}
+
+	m, err := mixer.New(config)
+	if err != nil {
+		logs.Error("Create mixer err: ", err.Error())
+		os.Exit(1)
+	}
+	if err := m.Start(); err != nil {
+		logs.Error("Start mixer err: ", err.Error())
+		os.Exit(1)
+	}
+
+	var rec *recorder.MixedRecorder
+	var drains sync.WaitGroup
+	done := make(chan struct{})
+	if *out != "" {
+		rec, err = recorder.NewMixedRecorder(*out, config.StreamID)
+		if err != nil {
+			logs.Error("Create mixed recorder err: ", err.Error())
+			os.Exit(1)
+		}
+
+		drains.Add(2)
+		go drain(m.GetMixedVideo(), rec.PushVideo, done, &drains)
+		go drain(m.GetMixedAudio(), rec.PushAudio, done, &drains)
+	}
+
+	var wg sync.WaitGroup
+	for _, path := range flag.Args() {
+		wg.Add(1)
+		go func(path string) {
+			defer wg.Done()
+			if err := replay(m, path); err != nil {
+				logs.Error(fmt.Sprintf("Replay %s err: %v", path, err))
+			}
+		}(path)
+	}
+	wg.Wait()
+
+	// the recorder closes its files last, once the drains have handed it what the mixer made
+	m.Close()
+	close(done)
+	drains.Wait()
+	if rec != nil {
+		rec.Close()
+	}
+}
+
+// replay push every rtp packet of dump file to the mixer, rtcp is skipped
+func replay(m mixer.Mixer, path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	reader, err := rtpdump.NewReader(file)
+	if err != nil {
+		return err
+	}
+	signalID := reader.Header().SignalID
+	defer m.RemoveVideoStream(signalID)
+	defer m.RemoveAudioStream(signalID)
+
+	logs.Info(fmt.Sprintf("Replay %s as %s", path, signalID))
+	return reader.Replay(func(record *rtpdump.Record) error {
+		if record.RTCP {
+			return nil
+		}
+
+		pkt := &rtp.Packet{}
+		if err := pkt.Unmarshal(record.Data); err != nil {
+			logs.Warn(fmt.Sprintf("Skip invalid rtp of %s: %v", signalID, err))
+			return nil
+		}
+
+		switch record.Kind {
+		case "video":
+			m.PushVideoStream(signalID, pkt)
+		case "audio":
+			m.PushAudioStream(signalID, pkt)
+		}
+		return nil
+	})
+}
+
+// drain hand packets of source to handler until source is closed or done, then the ones still buffered
+func drain(source chan *rtp.Packet, handler func(pkt *rtp.Packet) error, done chan struct{}, wg *sync.WaitGroup) {
+	defer wg.Done()
+	for {
+		select {
+		case pkt, ok := <-source:
+			if !ok {
+				return
+			}
+			record(pkt, handler)
+		case <-done:
+			for {
+				select {
+				case pkt, ok := <-source:
+					if !ok {
+						return
+					}
+					record(pkt, handler)
+				default:
+					return
+				}
+			}
+		}
+	}
+}
+
+func record(pkt *rtp.Packet, handler func(pkt *rtp.Packet) error) {
+	if err := handler(pkt); err != nil {
+		logs.Error("Record mixed packet err: ", err.Error())
+	}
+}
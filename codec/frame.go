@@ -0,0 +1,169 @@
+package codec
+
+import (
+	"encoding/binary"
+	"fmt"
+	"strings"
+
+	"github.com/pion/rtp"
+	"github.com/pion/rtp/codecs"
+)
+
+// codec names as found in webrtc.RTPCodec.Name
+const (
+	VP8  = "vp8"
+	VP9  = "vp9"
+	Opus = "opus"
+)
+
+// Frame a whole encoded frame rebuilt from rtp packets
+type Frame struct {
+	Data      []byte
+	Timestamp uint32 // rtp timestamp
+	Keyframe  bool
+	Width     uint16 // vp8 keyframe only
+	Height    uint16 // vp8 keyframe only
+}
+
+// FrameBuilder depacketize rtp packets to frames, frames with lost packets are dropped
+type FrameBuilder struct {
+	codec        string
+	data         []byte
+	timestamp    uint32
+	lastSeq      uint16
+	started      bool // received at least one packet
+	inFrame      bool // first packet of current frame received
+	broken       bool // current frame lost a packet
+	keyframe     bool
+	waitKeyframe bool // drop frames until next keyframe
+}
+
+// NewFrameBuilder linter
+func NewFrameBuilder(codec string) *FrameBuilder {
+	return &FrameBuilder{
+		codec:        strings.ToLower(codec),
+		waitKeyframe: true,
+	}
+}
+
+// IsSupported check codec can be depacketized
+func IsSupported(codec string) bool {
+	switch strings.ToLower(codec) {
+	case VP8, VP9, Opus:
+		return true
+	default:
+		return false
+	}
+}
+
+// RequestKeyframe drop frames until next keyframe, use it when starting a new file
+func (b *FrameBuilder) RequestKeyframe() {
+	b.waitKeyframe = true
+}
+
+// Push a packet in sequence order, return a frame when complete
+func (b *FrameBuilder) Push(pkt *rtp.Packet) (*Frame, error) {
+	if b.started && pkt.SequenceNumber != b.lastSeq+1 {
+		// the lost packet may be of any frame, next frames can only depend on a keyframe
+		b.broken = true
+		b.waitKeyframe = true
+	}
+	b.started = true
+	b.lastSeq = pkt.SequenceNumber
+
+	if b.inFrame && pkt.Timestamp != b.timestamp {
+		// marker of previous frame was lost, the frame is abandoned
+		b.waitKeyframe = true
+		b.reset()
+	}
+
+	switch b.codec {
+	case Opus:
+		return &Frame{
+			Data:      append([]byte{}, pkt.Payload...),
+			Timestamp: pkt.Timestamp,
+			Keyframe:  true,
+		}, nil
+	case VP8:
+		vp8 := codecs.VP8Packet{}
+		if _, err := vp8.Unmarshal(pkt.Payload); err != nil {
+			return nil, err
+		}
+		if vp8.S == 1 && vp8.PID == 0 {
+			b.start(pkt.Timestamp, isVP8Keyframe(vp8.Payload))
+		}
+		b.data = append(b.data, vp8.Payload...)
+	case VP9:
+		vp9 := codecs.VP9Packet{}
+		if _, err := vp9.Unmarshal(pkt.Payload); err != nil {
+			return nil, err
+		}
+		if vp9.B && (!b.inFrame || b.timestamp != pkt.Timestamp) {
+			b.start(pkt.Timestamp, !vp9.P)
+		}
+		b.data = append(b.data, vp9.Payload...)
+	default:
+		return nil, fmt.Errorf("codec %s is not supported", b.codec)
+	}
+
+	if !pkt.Marker {
+		return nil, nil
+	}
+
+	defer b.reset()
+	if !b.inFrame || b.broken || len(b.data) == 0 {
+		// next frames depend on the lost one
+		b.waitKeyframe = true
+		return nil, nil
+	}
+	if b.waitKeyframe && !b.keyframe {
+		return nil, nil
+	}
+	b.waitKeyframe = false
+
+	frame := &Frame{
+		Data:      b.data,
+		Timestamp: b.timestamp,
+		Keyframe:  b.keyframe,
+	}
+	if b.codec == VP8 && frame.Keyframe {
+		frame.Width, frame.Height = vp8Size(frame.Data)
+	}
+	return frame, nil
+}
+
+func (b *FrameBuilder) start(timestamp uint32, keyframe bool) {
+	b.data = nil
+	b.timestamp = timestamp
+	b.inFrame = true
+	b.broken = false
+	b.keyframe = keyframe
+}
+
+func (b *FrameBuilder) reset() {
+	b.data = nil
+	b.inFrame = false
+	b.keyframe = false
+}
+
+// IsVP8Keyframe check rtp payload is the first packet of a vp8 keyframe
+func IsVP8Keyframe(payload []byte) bool {
+	vp8 := codecs.VP8Packet{}
+	if _, err := vp8.Unmarshal(payload); err != nil {
+		return false
+	}
+	return vp8.S == 1 && vp8.PID == 0 && isVP8Keyframe(vp8.Payload)
+}
+
+// isVP8Keyframe check the frame tag of a vp8 frame (RFC 6386 9.1)
+func isVP8Keyframe(data []byte) bool {
+	return len(data) > 0 && data[0]&0x01 == 0
+}
+
+// vp8Size read width and height from vp8 keyframe header (RFC 6386 9.1)
+func vp8Size(data []byte) (uint16, uint16) {
+	if len(data) < 10 || data[3] != 0x9d || data[4] != 0x01 || data[5] != 0x2a {
+		return 0, 0
+	}
+	return binary.LittleEndian.Uint16(data[6:8]) & 0x3fff, binary.LittleEndian.Uint16(data[8:10]) & 0x3fff
+}
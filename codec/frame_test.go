@@ -0,0 +1,51 @@
+package codec
+
+import (
+	"testing"
+
+	"github.com/pion/rtp"
+)
+
+// vp8Packet single packet frame with a vp8 payload descriptor
+func vp8Packet(seq uint16, timestamp uint32, keyframe bool, marker bool) *rtp.Packet {
+	tag := byte(0x01)
+	if keyframe {
+		tag = 0x00
+	}
+	return &rtp.Packet{
+		Header: rtp.Header{
+			SequenceNumber: seq,
+			Timestamp:      timestamp,
+			Marker:         marker,
+		},
+		Payload: []byte{0x10, tag, 0x02, 0x03},
+	}
+}
+
+func TestDropDeltaAfterLoss(t *testing.T) {
+	b := NewFrameBuilder(VP8)
+	steps := []struct {
+		pkt  *rtp.Packet
+		want bool
+	}{
+		{vp8Packet(1, 100, true, true), true},
+		{vp8Packet(2, 200, false, true), true},
+		// packet 3, a whole delta frame, is lost
+		{vp8Packet(4, 400, false, true), false},
+		{vp8Packet(5, 500, false, true), false},
+		{vp8Packet(6, 600, true, true), true},
+		// marker of the delta frame 700 is lost
+		{vp8Packet(7, 700, false, false), false},
+		{vp8Packet(8, 800, false, true), false},
+		{vp8Packet(9, 900, true, true), true},
+	}
+	for _, step := range steps {
+		frame, err := b.Push(step.pkt)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := frame != nil; got != step.want {
+			t.Fatalf("packet %d: expect frame %v, got %v", step.pkt.SequenceNumber, step.want, got)
+		}
+	}
+}
@@ -0,0 +1,134 @@
+package fec
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/pion/rtp"
+)
+
+func newPacket(seq uint16, ts uint32, payload []byte) *rtp.Packet {
+	return &rtp.Packet{
+		Header: rtp.Header{
+			Version:        2,
+			PayloadType:    96,
+			SequenceNumber: seq,
+			Timestamp:      ts,
+			SSRC:           1234,
+		},
+		Payload: payload,
+	}
+}
+
+func TestREDRoundTrip(t *testing.T) {
+	blocks := []*RedBlock{
+		{PayloadType: 111, TimestampOffset: 960, Payload: []byte{1, 2, 3}},
+		{PayloadType: 111, Payload: []byte{4, 5}},
+	}
+
+	raw, err := MarshalRED(blocks)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	parsed, err := ParseRED(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(parsed) != len(blocks) {
+		t.Fatalf("expect %d blocks, got %d", len(blocks), len(parsed))
+	}
+	for i := range blocks {
+		if parsed[i].PayloadType != blocks[i].PayloadType ||
+			parsed[i].TimestampOffset != blocks[i].TimestampOffset ||
+			!bytes.Equal(parsed[i].Payload, blocks[i].Payload) {
+			t.Fatalf("block %d mismatch: %+v", i, parsed[i])
+		}
+	}
+}
+
+func TestREDRecoverLostAudio(t *testing.T) {
+	sender := NewSender(63, 0, 1, 0)
+	receiver := NewReceiver(63, 0)
+
+	var out []*rtp.Packet
+	for i := 0; i < 3; i++ {
+		packets, err := sender.Packetize(newPacket(uint16(i), uint32(i*960), []byte{byte(i)}))
+		if err != nil {
+			t.Fatal(err)
+		}
+		// drop the second packet
+		if i == 1 {
+			continue
+		}
+		for _, pkt := range packets {
+			out = append(out, receiver.Push(pkt)...)
+		}
+	}
+
+	if len(out) != 3 {
+		t.Fatalf("expect 3 packets, got %d", len(out))
+	}
+	if out[1].Payload[0] != 1 || out[1].Timestamp-out[0].Timestamp != 960 {
+		t.Fatalf("wrong recovered packet: %+v", out[1])
+	}
+}
+
+func TestREDDropDuplicates(t *testing.T) {
+	sender := NewSender(63, 0, 2, 0)
+	receiver := NewReceiver(63, 0)
+
+	var out []*rtp.Packet
+	for i := 0; i < 5; i++ {
+		packets, err := sender.Packetize(newPacket(uint16(i), uint32(i*960), []byte{byte(i)}))
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, pkt := range packets {
+			out = append(out, receiver.Push(pkt)...)
+		}
+	}
+
+	// redundant blocks of packets already released are not released again
+	if len(out) != 5 {
+		t.Fatalf("expect 5 packets, got %d", len(out))
+	}
+	for i, pkt := range out {
+		if pkt.SequenceNumber != out[0].SequenceNumber+uint16(i) || pkt.Payload[0] != byte(i) {
+			t.Fatalf("unexpected packet %d: %+v", i, pkt)
+		}
+	}
+}
+
+func TestULPFECRecoverLostVideo(t *testing.T) {
+	sender := NewSender(116, 117, 0, 4)
+	receiver := NewReceiver(116, 117)
+
+	var out []*rtp.Packet
+	for i := 0; i < 4; i++ {
+		pkt := newPacket(uint16(i), 3000, bytes.Repeat([]byte{byte(i)}, 10+i))
+		pkt.Marker = i == 3
+		packets, err := sender.Packetize(pkt)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// drop the third media packet, keep the fec one
+		if i == 2 {
+			continue
+		}
+		for _, p := range packets {
+			out = append(out, receiver.Push(p)...)
+		}
+	}
+
+	if len(out) != 4 {
+		t.Fatalf("expect 4 packets, got %d", len(out))
+	}
+	recovered := out[3]
+	if !bytes.Equal(recovered.Payload, bytes.Repeat([]byte{2}, 12)) {
+		t.Fatalf("wrong recovered payload: %v", recovered.Payload)
+	}
+	if recovered.PayloadType != 96 || recovered.SequenceNumber != out[1].SequenceNumber+1 || recovered.Marker {
+		t.Fatalf("wrong recovered header: %+v", recovered.Header)
+	}
+}
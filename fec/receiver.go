@@ -0,0 +1,173 @@
+package fec
+
+import (
+	"sync"
+
+	"github.com/lamhai1401/gologs/logs"
+	"github.com/pion/rtp"
+)
+
+const (
+	historySize = 256 // number of media packets kept to drop duplicates and for ulpfec recovery
+	maxFECs     = 32  // number of pending ulpfec packets
+)
+
+// Receiver unwrap red and recover lost packets with red redundancy or ulpfec
+type Receiver struct {
+	redPT   uint8
+	fecPT   uint8
+	history map[uint16]*rtp.Packet // seq - media packet
+	order   []uint16               // insert order of history
+	fecs    []*ulpfecPacket
+	mediaPT uint8 // payload type of the last media packet, never red or ulpfec
+	mutex   sync.Mutex
+}
+
+// NewReceiver linter, 0 payload type means not negotiated
+func NewReceiver(redPT, fecPT uint8) *Receiver {
+	return &Receiver{
+		redPT:   redPT,
+		fecPT:   fecPT,
+		history: make(map[uint16]*rtp.Packet),
+		order:   make([]uint16, 0, historySize),
+		fecs:    make([]*ulpfecPacket, 0, maxFECs),
+	}
+}
+
+// Push an incoming packet and return all media packets ready to use
+// including the ones recovered by redundancy or ulpfec
+func (r *Receiver) Push(pkt *rtp.Packet) []*rtp.Packet {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	out := make([]*rtp.Packet, 0, 1)
+
+	switch {
+	case r.redPT != 0 && pkt.PayloadType == r.redPT:
+		blocks, err := ParseRED(pkt.Payload)
+		if err != nil {
+			logs.Warn("Parse red payload err: ", err.Error())
+			return out
+		}
+		for i, block := range blocks {
+			if r.fecPT != 0 && block.PayloadType == r.fecPT {
+				r.addFEC(block.Payload)
+				continue
+			}
+			// redundant blocks are the previous packets of the same stream
+			distance := uint16(len(blocks) - 1 - i)
+			seq := pkt.SequenceNumber - distance
+			if distance > 0 && r.has(seq) {
+				continue
+			}
+			media := &rtp.Packet{
+				Header:  pkt.Header,
+				Payload: block.Payload,
+			}
+			media.PayloadType = block.PayloadType
+			media.SequenceNumber = seq
+			media.Timestamp = pkt.Timestamp - uint32(block.TimestampOffset)
+			if distance > 0 {
+				media.Marker = false
+			}
+			if r.addMedia(media) {
+				out = append(out, media)
+			}
+		}
+	case r.fecPT != 0 && pkt.PayloadType == r.fecPT:
+		r.addFEC(pkt.Payload)
+	default:
+		if r.addMedia(pkt) {
+			out = append(out, pkt)
+		}
+	}
+
+	return append(out, r.recover()...)
+}
+
+func (r *Receiver) has(seq uint16) bool {
+	_, ok := r.history[seq]
+	return ok
+}
+
+// addMedia remember a released packet, false if it was already released
+func (r *Receiver) addMedia(pkt *rtp.Packet) bool {
+	if r.has(pkt.SequenceNumber) {
+		return false
+	}
+
+	if len(r.order) >= historySize {
+		delete(r.history, r.order[0])
+		r.order = r.order[1:]
+	}
+	r.history[pkt.SequenceNumber] = pkt
+	r.order = append(r.order, pkt.SequenceNumber)
+	r.mediaPT = pkt.PayloadType
+	return true
+}
+
+// GetMediaPT payload type of the media carried by the track once red is unwrapped,
+// 0 before the first media packet
+func (r *Receiver) GetMediaPT() uint8 {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return r.mediaPT
+}
+
+func (r *Receiver) addFEC(payload []byte) {
+	f, err := parseULPFEC(payload)
+	if err != nil {
+		logs.Warn("Parse ulpfec payload err: ", err.Error())
+		return
+	}
+	if len(r.fecs) >= maxFECs {
+		r.fecs = r.fecs[1:]
+	}
+	r.fecs = append(r.fecs, f)
+}
+
+// recover try every pending ulpfec until nothing more can be rebuilt
+func (r *Receiver) recover() []*rtp.Packet {
+	recovered := make([]*rtp.Packet, 0)
+	if len(r.fecs) == 0 || len(r.order) == 0 {
+		return recovered
+	}
+	ssrc := r.history[r.order[len(r.order)-1]].SSRC
+
+	for progress := true; progress; {
+		progress = false
+		pending := r.fecs[:0]
+
+		for _, f := range r.fecs {
+			var missing []uint16
+			others := make([]*rtp.Packet, 0)
+			for _, seq := range f.sequences() {
+				if pkt, ok := r.history[seq]; ok {
+					others = append(others, pkt)
+				} else {
+					missing = append(missing, seq)
+				}
+			}
+
+			switch len(missing) {
+			case 0:
+				// nothing lost, drop it
+			case 1:
+				pkt, err := f.recover(missing[0], ssrc, others)
+				if err != nil {
+					logs.Warn("Recover packet with ulpfec err: ", err.Error())
+					break
+				}
+				if r.addMedia(pkt) {
+					recovered = append(recovered, pkt)
+				}
+				progress = true
+			default:
+				pending = append(pending, f)
+			}
+		}
+		r.fecs = pending
+	}
+
+	return recovered
+}
@@ -0,0 +1,108 @@
+package fec
+
+import (
+	"fmt"
+)
+
+const (
+	redHeaderLength      = 4
+	redFinalHeaderLength = 1
+	redMaxBlockLength    = 1<<10 - 1
+	redMaxTimestampDelta = 1<<14 - 1
+)
+
+// RedBlock a single block inside a RFC 2198 redundant payload
+type RedBlock struct {
+	PayloadType     uint8
+	TimestampOffset uint16 // offset back from the primary timestamp
+	Payload         []byte
+}
+
+// ParseRED split a RED payload into blocks, primary block is the last one
+func ParseRED(payload []byte) ([]*RedBlock, error) {
+	blocks := make([]*RedBlock, 0)
+	offset := 0
+
+	// read headers
+	for {
+		if offset >= len(payload) {
+			return nil, fmt.Errorf("red payload too short for header")
+		}
+
+		if payload[offset]&0x80 == 0 {
+			blocks = append(blocks, &RedBlock{
+				PayloadType: payload[offset] & 0x7f,
+			})
+			offset += redFinalHeaderLength
+			break
+		}
+
+		if offset+redHeaderLength > len(payload) {
+			return nil, fmt.Errorf("red payload too short for block header")
+		}
+
+		blocks = append(blocks, &RedBlock{
+			PayloadType:     payload[offset] & 0x7f,
+			TimestampOffset: uint16(payload[offset+1])<<6 | uint16(payload[offset+2])>>2,
+			Payload:         make([]byte, int(payload[offset+2]&0x03)<<8|int(payload[offset+3])),
+		})
+		offset += redHeaderLength
+	}
+
+	// read data
+	for i, block := range blocks {
+		if i == len(blocks)-1 {
+			block.Payload = append([]byte{}, payload[offset:]...)
+			break
+		}
+		length := len(block.Payload)
+		if offset+length > len(payload) {
+			return nil, fmt.Errorf("red block %d length %d out of range", i, length)
+		}
+		copy(block.Payload, payload[offset:offset+length])
+		offset += length
+	}
+
+	return blocks, nil
+}
+
+// MarshalRED build a RED payload, primary block must be the last one
+func MarshalRED(blocks []*RedBlock) ([]byte, error) {
+	if len(blocks) == 0 {
+		return nil, fmt.Errorf("red payload need at least one block")
+	}
+
+	size := redFinalHeaderLength
+	for i, block := range blocks {
+		if i != len(blocks)-1 {
+			if len(block.Payload) > redMaxBlockLength {
+				return nil, fmt.Errorf("red block %d too long: %d", i, len(block.Payload))
+			}
+			if block.TimestampOffset > redMaxTimestampDelta {
+				return nil, fmt.Errorf("red block %d timestamp offset too large: %d", i, block.TimestampOffset)
+			}
+			size += redHeaderLength
+		}
+		size += len(block.Payload)
+	}
+
+	out := make([]byte, 0, size)
+	for i, block := range blocks {
+		if i == len(blocks)-1 {
+			out = append(out, block.PayloadType&0x7f)
+			break
+		}
+		length := len(block.Payload)
+		out = append(out,
+			0x80|block.PayloadType&0x7f,
+			byte(block.TimestampOffset>>6),
+			byte(block.TimestampOffset<<2)|byte(length>>8),
+			byte(length),
+		)
+	}
+
+	for _, block := range blocks {
+		out = append(out, block.Payload...)
+	}
+	return out, nil
+}
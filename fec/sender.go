@@ -0,0 +1,144 @@
+package fec
+
+import (
+	"math/rand"
+	"sync"
+
+	"github.com/pion/rtp"
+)
+
+// Sender add red redundancy and ulpfec packets to an outgoing stream.
+// Sequence numbers are rewritten since fec packets share the media sequence space
+type Sender struct {
+	redPT     uint8
+	fecPT     uint8
+	distance  int // number of previous payloads carried in each red packet
+	groupSize int // number of media packets protected by one ulpfec packet
+	sequence  uint16
+	previous  []*rtp.Packet
+	group     []*rtp.Packet
+	mutex     sync.Mutex
+}
+
+// NewSender linter, 0 payload type means not negotiated
+func NewSender(redPT, fecPT uint8, distance, groupSize int) *Sender {
+	if groupSize > ulpfecMaxMaskLength {
+		groupSize = ulpfecMaxMaskLength
+	}
+	return &Sender{
+		redPT:     redPT,
+		fecPT:     fecPT,
+		distance:  distance,
+		groupSize: groupSize,
+		sequence:  uint16(rand.Uint32()),
+		previous:  make([]*rtp.Packet, 0, distance),
+		group:     make([]*rtp.Packet, 0, groupSize),
+	}
+}
+
+// Packetize return packets to write in place of the given media packet
+func (s *Sender) Packetize(pkt *rtp.Packet) ([]*rtp.Packet, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	media := &rtp.Packet{
+		Header:  pkt.Header,
+		Payload: pkt.Payload,
+	}
+	media.SequenceNumber = s.nextSequence()
+
+	out := make([]*rtp.Packet, 0, 2)
+
+	red, err := s.wrapRED(media, s.previous)
+	if err != nil {
+		return nil, err
+	}
+	out = append(out, red)
+
+	if s.distance > 0 {
+		if len(s.previous) >= s.distance {
+			s.previous = s.previous[1:]
+		}
+		s.previous = append(s.previous, media)
+	}
+
+	if s.fecPT != 0 && s.groupSize > 0 {
+		s.group = append(s.group, media)
+		if len(s.group) >= s.groupSize {
+			fec, err := s.buildFEC()
+			if err != nil {
+				return nil, err
+			}
+			out = append(out, fec)
+		}
+	}
+
+	return out, nil
+}
+
+func (s *Sender) nextSequence() uint16 {
+	seq := s.sequence
+	s.sequence++
+	return seq
+}
+
+// wrapRED encapsulate a packet with its redundancy, do nothing if red is not negotiated
+func (s *Sender) wrapRED(pkt *rtp.Packet, redundancy []*rtp.Packet) (*rtp.Packet, error) {
+	if s.redPT == 0 {
+		return pkt, nil
+	}
+
+	blocks := make([]*RedBlock, 0, len(redundancy)+1)
+	for _, prev := range redundancy {
+		offset := pkt.Timestamp - prev.Timestamp
+		if offset > redMaxTimestampDelta || len(prev.Payload) > redMaxBlockLength {
+			continue
+		}
+		blocks = append(blocks, &RedBlock{
+			PayloadType:     prev.PayloadType,
+			TimestampOffset: uint16(offset),
+			Payload:         prev.Payload,
+		})
+	}
+	blocks = append(blocks, &RedBlock{
+		PayloadType: pkt.PayloadType,
+		Payload:     pkt.Payload,
+	})
+
+	payload, err := MarshalRED(blocks)
+	if err != nil {
+		return nil, err
+	}
+
+	red := &rtp.Packet{
+		Header:  pkt.Header,
+		Payload: payload,
+	}
+	red.PayloadType = s.redPT
+	return red, nil
+}
+
+func (s *Sender) buildFEC() (*rtp.Packet, error) {
+	defer func() {
+		s.group = s.group[:0]
+	}()
+
+	payload, err := EncodeULPFEC(s.group)
+	if err != nil {
+		return nil, err
+	}
+
+	last := s.group[len(s.group)-1]
+	fec := &rtp.Packet{
+		Header:  last.Header,
+		Payload: payload,
+	}
+	fec.PayloadType = s.fecPT
+	fec.Marker = false
+	fec.SequenceNumber = s.nextSequence()
+
+	if s.redPT == 0 {
+		return fec, nil
+	}
+	return s.wrapRED(fec, nil)
+}
@@ -0,0 +1,188 @@
+package fec
+
+import (
+	"encoding/binary"
+	"fmt"
+
+	"github.com/pion/rtp"
+)
+
+const (
+	ulpfecHeaderLength      = 10
+	ulpfecLevelHeaderLength = 4 // short mask, L bit = 0
+	ulpfecMaxMaskLength     = 16
+	rtpHeaderLength         = 12
+)
+
+// protect is the part of a media packet covered by ulpfec (RFC 5109 section 7.3)
+type protect struct {
+	head      [2]byte // P, X, CC, M, PT
+	timestamp uint32
+	length    uint16 // length of everything after the fixed rtp header
+	payload   []byte
+}
+
+func toProtect(pkt *rtp.Packet) (*protect, error) {
+	raw, err := pkt.Marshal()
+	if err != nil {
+		return nil, err
+	}
+	if len(raw) < rtpHeaderLength {
+		return nil, fmt.Errorf("rtp packet too short: %d", len(raw))
+	}
+	return &protect{
+		head:      [2]byte{raw[0], raw[1]},
+		timestamp: binary.BigEndian.Uint32(raw[4:8]),
+		length:    uint16(len(raw) - rtpHeaderLength),
+		payload:   raw[rtpHeaderLength:],
+	}, nil
+}
+
+// EncodeULPFEC build a ulpfec payload protecting all packets (max 16 consecutive sequence numbers)
+func EncodeULPFEC(packets []*rtp.Packet) ([]byte, error) {
+	if len(packets) == 0 {
+		return nil, fmt.Errorf("ulpfec need at least one packet")
+	}
+
+	base := packets[0].SequenceNumber
+	var mask uint16
+	var head [2]byte
+	var timestamp uint32
+	var length uint16
+	var payload []byte
+
+	for _, pkt := range packets {
+		delta := pkt.SequenceNumber - base
+		if delta >= ulpfecMaxMaskLength {
+			return nil, fmt.Errorf("ulpfec sequence %d out of mask range from base %d", pkt.SequenceNumber, base)
+		}
+		mask |= 0x8000 >> delta
+
+		p, err := toProtect(pkt)
+		if err != nil {
+			return nil, err
+		}
+		head[0] ^= p.head[0]
+		head[1] ^= p.head[1]
+		timestamp ^= p.timestamp
+		length ^= p.length
+		payload = xorInto(payload, p.payload)
+	}
+
+	out := make([]byte, ulpfecHeaderLength+ulpfecLevelHeaderLength+len(payload))
+	out[0] = head[0] & 0x3f // E = 0, L = 0
+	out[1] = head[1]
+	binary.BigEndian.PutUint16(out[2:4], base)
+	binary.BigEndian.PutUint32(out[4:8], timestamp)
+	binary.BigEndian.PutUint16(out[8:10], length)
+	binary.BigEndian.PutUint16(out[10:12], uint16(len(payload)))
+	binary.BigEndian.PutUint16(out[12:14], mask)
+	copy(out[14:], payload)
+	return out, nil
+}
+
+// ulpfecPacket parsed ulpfec payload
+type ulpfecPacket struct {
+	head      [2]byte
+	base      uint16
+	timestamp uint32
+	length    uint16
+	mask      uint64
+	maskBits  int
+	payload   []byte
+}
+
+func parseULPFEC(data []byte) (*ulpfecPacket, error) {
+	if len(data) < ulpfecHeaderLength+ulpfecLevelHeaderLength {
+		return nil, fmt.Errorf("ulpfec payload too short: %d", len(data))
+	}
+
+	f := &ulpfecPacket{
+		head:      [2]byte{data[0], data[1]},
+		base:      binary.BigEndian.Uint16(data[2:4]),
+		timestamp: binary.BigEndian.Uint32(data[4:8]),
+		length:    binary.BigEndian.Uint16(data[8:10]),
+	}
+
+	offset := ulpfecHeaderLength
+	protectLength := int(binary.BigEndian.Uint16(data[offset : offset+2]))
+	if data[0]&0x40 != 0 {
+		// long mask
+		if len(data) < offset+8 {
+			return nil, fmt.Errorf("ulpfec payload too short for long mask")
+		}
+		f.mask = uint64(binary.BigEndian.Uint16(data[offset+2:offset+4]))<<32 | uint64(binary.BigEndian.Uint32(data[offset+4:offset+8]))
+		f.maskBits = 48
+		offset += 8
+	} else {
+		f.mask = uint64(binary.BigEndian.Uint16(data[offset+2 : offset+4]))
+		f.maskBits = 16
+		offset += 4
+	}
+
+	if len(data) < offset+protectLength {
+		return nil, fmt.Errorf("ulpfec protection length %d out of range", protectLength)
+	}
+	f.payload = data[offset : offset+protectLength]
+	return f, nil
+}
+
+// sequences return all sequence numbers protected by this packet
+func (f *ulpfecPacket) sequences() []uint16 {
+	seqs := make([]uint16, 0, f.maskBits)
+	for i := 0; i < f.maskBits; i++ {
+		if f.mask&(1<<uint(f.maskBits-1-i)) != 0 {
+			seqs = append(seqs, f.base+uint16(i))
+		}
+	}
+	return seqs
+}
+
+// recover rebuild the missing packet from all other protected packets
+func (f *ulpfecPacket) recover(seq uint16, ssrc uint32, others []*rtp.Packet) (*rtp.Packet, error) {
+	head := f.head
+	timestamp := f.timestamp
+	length := f.length
+	payload := append([]byte{}, f.payload...)
+
+	for _, pkt := range others {
+		p, err := toProtect(pkt)
+		if err != nil {
+			return nil, err
+		}
+		head[0] ^= p.head[0]
+		head[1] ^= p.head[1]
+		timestamp ^= p.timestamp
+		length ^= p.length
+		payload = xorInto(payload, p.payload)
+	}
+
+	if int(length) > len(payload) {
+		return nil, fmt.Errorf("ulpfec recovered length %d bigger than protection length %d", length, len(payload))
+	}
+
+	raw := make([]byte, rtpHeaderLength+int(length))
+	raw[0] = 0x80 | head[0]&0x3f
+	raw[1] = head[1]
+	binary.BigEndian.PutUint16(raw[2:4], seq)
+	binary.BigEndian.PutUint32(raw[4:8], timestamp)
+	binary.BigEndian.PutUint32(raw[8:12], ssrc)
+	copy(raw[rtpHeaderLength:], payload[:length])
+
+	pkt := &rtp.Packet{}
+	if err := pkt.Unmarshal(raw); err != nil {
+		return nil, err
+	}
+	return pkt, nil
+}
+
+// xorInto xor src into dst, growing dst if needed
+func xorInto(dst []byte, src []byte) []byte {
+	if len(src) > len(dst) {
+		dst = append(dst, make([]byte, len(src)-len(dst))...)
+	}
+	for i := range src {
+		dst[i] ^= src[i]
+	}
+	return dst
+}
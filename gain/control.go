@@ -0,0 +1,194 @@
+package gain
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/lamhai1401/gologs/logs"
+	"github.com/pion/rtp"
+)
+
+const (
+	// MinGain lowest gain in dB, -40 is about inaudible
+	MinGain = -40.0
+	// MaxGain highest gain in dB
+	MaxGain = 20.0
+)
+
+// stream state of a participant audio being changed
+type stream struct {
+	transcoder *transcoder
+	normalizer *Normalizer
+	applied    float64 // gain at the end of the previous packet
+	failed     bool    // codec could not be made, packets pass through
+	mutex      sync.Mutex
+}
+
+// Control gain of each participant audio before mixing. Streams at 0 dB without
+// normalization are passed through untouched, the others are transcoded
+type Control struct {
+	channels  int
+	newCodec  newCodecFunc
+	gains     map[string]float64 // signalID - dB, kept after the participant left
+	normalize bool
+	streams   map[string]*stream
+	mutex     sync.RWMutex
+}
+
+// NewControl transcode participant audio to channels, normalize is the initial loudness normalization
+func NewControl(channels int, normalize bool) *Control {
+	return newControl(channels, normalize, newOpusCodec)
+}
+
+func newControl(channels int, normalize bool, newCodec newCodecFunc) *Control {
+	return &Control{
+		channels:  channels,
+		newCodec:  newCodec,
+		gains:     make(map[string]float64),
+		normalize: normalize,
+		streams:   make(map[string]*stream),
+	}
+}
+
+// SetGain of signalID in dB, 0 is unchanged
+func (c *Control) SetGain(signalID string, db float64) error {
+	if db < MinGain || db > MaxGain {
+		return fmt.Errorf("Gain %.1f dB is outside %.0f to %.0f dB", db, MinGain, MaxGain)
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if db == 0 {
+		delete(c.gains, signalID)
+	} else {
+		c.gains[signalID] = db
+	}
+	return nil
+}
+
+// GetGain of signalID in dB
+func (c *Control) GetGain(signalID string) float64 {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	return c.gains[signalID]
+}
+
+// GetGains signalIDs with a gain other than 0 dB
+func (c *Control) GetGains() map[string]float64 {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	gains := make(map[string]float64, len(c.gains))
+	for id, db := range c.gains {
+		gains[id] = db
+	}
+	return gains
+}
+
+// SetNormalize turn loudness normalization of every participant on or off
+func (c *Control) SetNormalize(normalize bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.normalize = normalize
+}
+
+// IsNormalize linter
+func (c *Control) IsNormalize() bool {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	return c.normalize
+}
+
+// Process return pkt of signalID at its gain, pkt itself if nothing is to change or it can not be transcoded
+func (c *Control) Process(signalID string, pkt *rtp.Packet) *rtp.Packet {
+	c.mutex.RLock()
+	db, normalize := c.gains[signalID], c.normalize
+	s := c.streams[signalID]
+	c.mutex.RUnlock()
+
+	if db == 0 && !normalize {
+		return pkt
+	}
+	if s == nil {
+		s = c.getStream(signalID)
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.failed {
+		return pkt
+	}
+	if s.transcoder == nil {
+		transcoder, err := newTranscoder(c.channels, c.newCodec)
+		if err != nil {
+			logs.Error(fmt.Sprintf("Gain of %s err: %v", signalID, err))
+			s.failed = true
+			return pkt
+		}
+		s.transcoder = transcoder
+	}
+
+	out, err := s.transcoder.process(pkt, func(samples []int16) {
+		gain := FromDB(db)
+		if normalize {
+			gain *= s.normalizer.Gain(samples)
+		}
+		apply(samples, s.applied, gain)
+		s.applied = gain
+	})
+	if err != nil {
+		logs.Warn(fmt.Sprintf("Gain of %s err: %v", signalID, err))
+		return pkt
+	}
+	return out
+}
+
+// Remove transcoding state of signalID, its gain is kept for when it joins again
+func (c *Control) Remove(signalID string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	delete(c.streams, signalID)
+}
+
+func (c *Control) getStream(signalID string) *stream {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	s, has := c.streams[signalID]
+	if !has {
+		s = &stream{
+			normalizer: NewNormalizer(),
+			applied:    1,
+		}
+		c.streams[signalID] = s
+	}
+	return s
+}
+
+// MixLimiter keep mixed audio from clipping
+type MixLimiter struct {
+	transcoder *transcoder
+	limiter    *Limiter
+	mutex      sync.Mutex
+}
+
+// NewMixLimiter for mixed opus of channels
+func NewMixLimiter(channels int) (*MixLimiter, error) {
+	transcoder, err := newTranscoder(channels, newOpusCodec)
+	if err != nil {
+		return nil, err
+	}
+	return &MixLimiter{
+		transcoder: transcoder,
+		limiter:    NewLimiter(),
+	}, nil
+}
+
+// Process return pkt limited, or pkt itself if it can not be transcoded
+func (m *MixLimiter) Process(pkt *rtp.Packet) *rtp.Packet {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	out, err := m.transcoder.process(pkt, m.limiter.Process)
+	if err != nil {
+		logs.Warn(fmt.Sprintf("Limit mixed audio err: %v", err))
+		return pkt
+	}
+	return out
+}
@@ -0,0 +1,133 @@
+package gain
+
+import (
+	"math"
+)
+
+const (
+	fullScale = 32767.0
+
+	// normalization aim at -20 dBFS rms, within +-12 dB of the input
+	targetLevel    = 0.1 * fullScale
+	minAutoGain    = 0.25
+	maxAutoGain    = 4.0
+	gateLevel      = 0.003 * fullScale // about -50 dBFS, quieter frames are not speech
+	levelSmoothing = 0.05              // level follows speech over about 20 frames
+	gainSmoothing  = 0.1               // gain glides over about 10 frames
+
+	// limiter keep peaks under -1 dBFS
+	limitThreshold = 0.89 * fullScale
+	limitRelease   = 0.05 // gain recovers over about 20 frames
+)
+
+// FromDB linear gain of a dB value
+func FromDB(db float64) float64 {
+	return math.Pow(10, db/20)
+}
+
+// Normalizer bring speech toward the same loudness, silence is not boosted
+type Normalizer struct {
+	level float64 // smoothed rms of speech, 0 before any
+	gain  float64
+}
+
+// NewNormalizer linter
+func NewNormalizer() *Normalizer {
+	return &Normalizer{gain: 1}
+}
+
+// Gain to apply to samples, updated by their loudness
+func (n *Normalizer) Gain(samples []int16) float64 {
+	if level := rms(samples); level > gateLevel {
+		if n.level == 0 {
+			n.level = level
+		} else {
+			n.level += (level - n.level) * levelSmoothing
+		}
+	}
+
+	want := 1.0
+	if n.level > 0 {
+		want = clamp(targetLevel/n.level, minAutoGain, maxAutoGain)
+	}
+	n.gain += (want - n.gain) * gainSmoothing
+	return n.gain
+}
+
+// Limiter lower the gain of loud frames at once and raise it back slowly
+type Limiter struct {
+	gain float64
+}
+
+// NewLimiter linter
+func NewLimiter() *Limiter {
+	return &Limiter{gain: 1}
+}
+
+// Process limit samples in place
+func (l *Limiter) Process(samples []int16) {
+	want := 1.0
+	if p := peak(samples); p > limitThreshold {
+		want = limitThreshold / p
+	}
+
+	from := l.gain
+	if want < l.gain {
+		// attack within the frame would let its start through
+		from, l.gain = want, want
+	} else {
+		l.gain += (want - l.gain) * limitRelease
+	}
+	apply(samples, from, l.gain)
+}
+
+// apply a gain moving from start to end over samples, so changes do not click
+func apply(samples []int16, start, end float64) {
+	if start == 1 && end == 1 {
+		return
+	}
+	step := 0.0
+	if len(samples) > 1 {
+		step = (end - start) / float64(len(samples)-1)
+	}
+	g := start
+	for i, s := range samples {
+		samples[i] = saturate(float64(s) * g)
+		g += step
+	}
+}
+
+func saturate(value float64) int16 {
+	if value > math.MaxInt16 {
+		return math.MaxInt16
+	}
+	if value < math.MinInt16 {
+		return math.MinInt16
+	}
+	return int16(math.Round(value))
+}
+
+func rms(samples []int16) float64 {
+	if len(samples) == 0 {
+		return 0
+	}
+	sum := 0.0
+	for _, s := range samples {
+		sum += float64(s) * float64(s)
+	}
+	return math.Sqrt(sum / float64(len(samples)))
+}
+
+func peak(samples []int16) float64 {
+	max := 0.0
+	for _, s := range samples {
+		if v := math.Abs(float64(s)); v > max {
+			max = v
+		}
+	}
+	return max
+}
+
+func clamp(value, min, max float64) float64 {
+	return math.Max(min, math.Min(max, value))
+}
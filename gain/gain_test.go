@@ -0,0 +1,110 @@
+package gain
+
+import (
+	"encoding/binary"
+	"math"
+	"testing"
+
+	"github.com/pion/rtp"
+)
+
+// rawCodec carry int16 samples as little endian bytes instead of opus
+type rawCodec struct{}
+
+func (rawCodec) Decode(data []byte, pcm []int16) (int, error) {
+	n := len(data) / 2
+	for i := 0; i < n; i++ {
+		pcm[i] = int16(binary.LittleEndian.Uint16(data[2*i:]))
+	}
+	return n, nil
+}
+
+func (rawCodec) Encode(pcm []int16, data []byte) (int, error) {
+	for i, s := range pcm {
+		binary.LittleEndian.PutUint16(data[2*i:], uint16(s))
+	}
+	return 2 * len(pcm), nil
+}
+
+func newRawCodec(channels int) (Decoder, Encoder, error) {
+	return rawCodec{}, rawCodec{}, nil
+}
+
+func packet(samples []int16) *rtp.Packet {
+	payload := make([]byte, 2*len(samples))
+	rawCodec{}.Encode(samples, payload)
+	return &rtp.Packet{Header: rtp.Header{SequenceNumber: 7}, Payload: payload}
+}
+
+func samplesOf(pkt *rtp.Packet) []int16 {
+	pcm := make([]int16, len(pkt.Payload)/2)
+	rawCodec{}.Decode(pkt.Payload, pcm)
+	return pcm
+}
+
+func tone(amplitude float64, n int) []int16 {
+	samples := make([]int16, n)
+	for i := range samples {
+		samples[i] = int16(amplitude * math.Sin(float64(i)/5))
+	}
+	return samples
+}
+
+func TestControlGain(t *testing.T) {
+	c := newControl(1, false, newRawCodec)
+	in := packet(tone(1000, 480))
+	if c.Process("a", in) != in {
+		t.Fatal("0 dB without normalization should pass through")
+	}
+
+	if err := c.SetGain("a", 30); err == nil {
+		t.Fatal("gain above max should be refused")
+	}
+	c.SetGain("a", 6)
+	// first packet glides from 0 dB, the next one is at gain
+	c.Process("a", in)
+	out := c.Process("a", in)
+	if out.SequenceNumber != 7 {
+		t.Fatal("header should be kept")
+	}
+	if ratio := peak(samplesOf(out)) / peak(samplesOf(in)); math.Abs(ratio-FromDB(6)) > 0.01 {
+		t.Fatalf("peak ratio %.3f, want %.3f", ratio, FromDB(6))
+	}
+}
+
+func TestNormalizer(t *testing.T) {
+	n := NewNormalizer()
+	quiet := tone(300, 960)
+	var gain float64
+	for i := 0; i < 200; i++ {
+		gain = n.Gain(quiet)
+	}
+	if gain < 3 || gain > maxAutoGain {
+		t.Fatalf("quiet speech gain %.2f, want close to %.2f", gain, maxAutoGain)
+	}
+
+	n = NewNormalizer()
+	for i := 0; i < 200; i++ {
+		gain = n.Gain(make([]int16, 960))
+	}
+	if gain != 1 {
+		t.Fatalf("silence gain %.2f, want 1", gain)
+	}
+}
+
+func TestLimiter(t *testing.T) {
+	l := NewLimiter()
+	loud := tone(32767, 960)
+	l.Process(loud)
+	if p := peak(loud); p > limitThreshold+1 {
+		t.Fatalf("peak %.0f over threshold %.0f", p, limitThreshold)
+	}
+
+	// gain comes back once it is quiet again
+	for i := 0; i < 200; i++ {
+		l.Process(tone(1000, 960))
+	}
+	if l.gain < 0.99 {
+		t.Fatalf("gain %.3f did not recover", l.gain)
+	}
+}
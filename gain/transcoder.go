@@ -0,0 +1,97 @@
+package gain
+
+import (
+	"fmt"
+
+	"github.com/pion/rtp"
+	"gopkg.in/hraban/opus.v2"
+)
+
+const (
+	sampleRate = 48000
+	// bitrate of re-encoded audio, high enough to not be the weak link
+	bitrate = 64000
+	// maxFrame the longest opus frame the encoder accepts is 60ms
+	maxFrame = sampleRate * 60 / 1000
+	// maxPacket the longest opus packet is 120ms
+	maxPacket = sampleRate * 120 / 1000
+	maxBytes  = 1500
+)
+
+// Decoder decode opus to interleaved int16 samples
+type Decoder interface {
+	Decode(data []byte, pcm []int16) (int, error)
+}
+
+// Encoder encode interleaved int16 samples to opus
+type Encoder interface {
+	Encode(pcm []int16, data []byte) (int, error)
+}
+
+// newCodecFunc make both sides of a transcoder at 48kHz and channels
+type newCodecFunc func(channels int) (Decoder, Encoder, error)
+
+func newOpusCodec(channels int) (Decoder, Encoder, error) {
+	decoder, err := opus.NewDecoder(sampleRate, channels)
+	if err != nil {
+		return nil, nil, fmt.Errorf("New opus decoder err: %v", err)
+	}
+	encoder, err := opus.NewEncoder(sampleRate, channels, opus.AppVoIP)
+	if err != nil {
+		return nil, nil, fmt.Errorf("New opus encoder err: %v", err)
+	}
+	if err := encoder.SetBitrate(bitrate); err != nil {
+		return nil, nil, fmt.Errorf("Set opus bitrate err: %v", err)
+	}
+	return decoder, encoder, nil
+}
+
+// transcoder decode opus packets, change their samples and encode them again
+type transcoder struct {
+	channels int
+	decoder  Decoder
+	encoder  Encoder
+	pcm      []int16
+	data     []byte
+}
+
+func newTranscoder(channels int, newCodec newCodecFunc) (*transcoder, error) {
+	decoder, encoder, err := newCodec(channels)
+	if err != nil {
+		return nil, err
+	}
+	return &transcoder{
+		channels: channels,
+		decoder:  decoder,
+		encoder:  encoder,
+		pcm:      make([]int16, maxPacket*channels),
+		data:     make([]byte, maxBytes),
+	}, nil
+}
+
+// process return a copy of pkt with samples changed by fn, header is kept so
+// sequence and timestamps still line up with untouched packets
+func (t *transcoder) process(pkt *rtp.Packet, fn func(samples []int16)) (*rtp.Packet, error) {
+	n, err := t.decoder.Decode(pkt.Payload, t.pcm)
+	if err != nil {
+		return nil, fmt.Errorf("Decode opus err: %v", err)
+	}
+	if n > maxFrame {
+		return nil, fmt.Errorf("Opus packet of %d samples is too long to encode", n)
+	}
+
+	samples := t.pcm[:n*t.channels]
+	fn(samples)
+
+	size, err := t.encoder.Encode(samples, t.data)
+	if err != nil {
+		return nil, fmt.Errorf("Encode opus err: %v", err)
+	}
+
+	out := &rtp.Packet{
+		Header:  pkt.Header,
+		Payload: make([]byte, size),
+	}
+	copy(out.Payload, t.data[:size])
+	return out, nil
+}
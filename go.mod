@@ -13,4 +13,6 @@ require (
 	github.com/pion/rtp v1.6.1
 	github.com/pion/webrtc/v2 v2.2.26
 	github.com/segmentio/ksuid v1.0.3
+	golang.org/x/image v0.0.0-20201208152932-35266b937fa6
+	gopkg.in/hraban/opus.v2 v2.0.0-20201025103112-d779bb1cc5a2
 )
@@ -0,0 +1,276 @@
+package hls
+
+// fragmented mp4 (CMAF) boxes for vp8 and opus, see ISO/IEC 14496-12,
+// https://www.webmproject.org/vp9/mp4/ and https://opus-codec.org/docs/opus_in_isobmff.html
+
+const (
+	videoTrackID   = 1
+	audioTrackID   = 2
+	videoTimescale = 90000
+	audioTimescale = 48000
+	movieTimescale = 1000
+
+	// trun flags: data offset, sample duration, size and flags present
+	trunFlags = 0x000701
+	// tfhd flags: default base is moof
+	tfhdFlags = 0x020000
+
+	keyframeFlags    = 0x02000000 // sample_depends_on = 2
+	nonKeyframeFlags = 0x01010000 // sample_depends_on = 1, is_non_sync_sample
+)
+
+var unityMatrix = []uint32{0x00010000, 0, 0, 0, 0x00010000, 0, 0, 0, 0x40000000}
+
+// sample one frame in a fragment
+type sample struct {
+	data     []byte
+	dts      uint64 // in track timescale
+	duration uint32
+	keyframe bool
+}
+
+func u8(b []byte, v uint8) []byte {
+	return append(b, v)
+}
+
+func u16(b []byte, v uint16) []byte {
+	return append(b, byte(v>>8), byte(v))
+}
+
+func u32(b []byte, v uint32) []byte {
+	return append(b, byte(v>>24), byte(v>>16), byte(v>>8), byte(v))
+}
+
+func u64(b []byte, v uint64) []byte {
+	return u32(u32(b, uint32(v>>32)), uint32(v))
+}
+
+func zeros(b []byte, n int) []byte {
+	return append(b, make([]byte, n)...)
+}
+
+func box(typ string, payloads ...[]byte) []byte {
+	size := 8
+	for _, p := range payloads {
+		size += len(p)
+	}
+
+	b := make([]byte, 0, size)
+	b = u32(b, uint32(size))
+	b = append(b, typ...)
+	for _, p := range payloads {
+		b = append(b, p...)
+	}
+	return b
+}
+
+func fullBox(typ string, version uint8, flags uint32, payloads ...[]byte) []byte {
+	header := u32(nil, uint32(version)<<24|flags&0xffffff)
+	return box(typ, append([][]byte{header}, payloads...)...)
+}
+
+// initSegment ftyp and moov of a vp8 + opus stream
+func initSegment(width, height uint16, channels uint16) []byte {
+	ftyp := []byte("iso6")
+	ftyp = u32(ftyp, 0)
+	ftyp = append(ftyp, "iso6cmfcmp41"...)
+
+	mvhd := u32(nil, 0) // creation time
+	mvhd = u32(mvhd, 0) // modification time
+	mvhd = u32(mvhd, movieTimescale)
+	mvhd = u32(mvhd, 0)          // duration
+	mvhd = u32(mvhd, 0x00010000) // rate
+	mvhd = u16(mvhd, 0x0100)     // volume
+	mvhd = zeros(mvhd, 10)
+	for _, v := range unityMatrix {
+		mvhd = u32(mvhd, v)
+	}
+	mvhd = zeros(mvhd, 24)
+	mvhd = u32(mvhd, audioTrackID+1) // next track id
+
+	return append(box("ftyp", ftyp), box("moov",
+		fullBox("mvhd", 0, 0, mvhd),
+		videoTrak(width, height),
+		audioTrak(channels),
+		box("mvex",
+			trex(videoTrackID),
+			trex(audioTrackID),
+		),
+	)...)
+}
+
+func tkhd(trackID uint32, volume uint16, width, height uint16) []byte {
+	b := u32(nil, 0) // creation time
+	b = u32(b, 0)    // modification time
+	b = u32(b, trackID)
+	b = zeros(b, 4)
+	b = u32(b, 0) // duration
+	b = zeros(b, 8)
+	b = u16(b, 0) // layer
+	b = u16(b, 0) // alternate group
+	b = u16(b, volume)
+	b = zeros(b, 2)
+	for _, v := range unityMatrix {
+		b = u32(b, v)
+	}
+	b = u32(b, uint32(width)<<16)
+	b = u32(b, uint32(height)<<16)
+	return fullBox("tkhd", 0, 0x000003, b) // enabled, in movie
+}
+
+func mdhd(timescale uint32) []byte {
+	b := u32(nil, 0) // creation time
+	b = u32(b, 0)    // modification time
+	b = u32(b, timescale)
+	b = u32(b, 0)      // duration
+	b = u16(b, 0x55c4) // und
+	b = u16(b, 0)
+	return fullBox("mdhd", 0, 0, b)
+}
+
+func hdlr(handler, name string) []byte {
+	b := u32(nil, 0)
+	b = append(b, handler...)
+	b = zeros(b, 12)
+	b = append(b, name...)
+	b = append(b, 0)
+	return fullBox("hdlr", 0, 0, b)
+}
+
+func dinf() []byte {
+	return box("dinf", fullBox("dref", 0, 0, u32(nil, 1), fullBox("url ", 0, 0x000001)))
+}
+
+// stbl with sample entry only, samples are in fragments
+func stbl(entry []byte) []byte {
+	return box("stbl",
+		fullBox("stsd", 0, 0, u32(nil, 1), entry),
+		fullBox("stts", 0, 0, u32(nil, 0)),
+		fullBox("stsc", 0, 0, u32(nil, 0)),
+		fullBox("stsz", 0, 0, u32(u32(nil, 0), 0)),
+		fullBox("stco", 0, 0, u32(nil, 0)),
+	)
+}
+
+func videoTrak(width, height uint16) []byte {
+	entry := zeros(nil, 6)
+	entry = u16(entry, 1) // data reference index
+	entry = zeros(entry, 16)
+	entry = u16(entry, width)
+	entry = u16(entry, height)
+	entry = u32(entry, 0x00480000) // 72 dpi
+	entry = u32(entry, 0x00480000)
+	entry = zeros(entry, 4)
+	entry = u16(entry, 1) // frame count
+	entry = zeros(entry, 32)
+	entry = u16(entry, 0x0018) // depth
+	entry = u16(entry, 0xffff)
+
+	// profile 0, level 0, 8 bit 4:2:0 colocated, bt.709
+	vpcc := []byte{0, 0, 0x82, 1, 1, 1}
+	vpcc = u16(vpcc, 0)
+
+	vmhd := u16(nil, 0)
+	vmhd = zeros(vmhd, 6)
+
+	return box("trak",
+		tkhd(videoTrackID, 0, width, height),
+		box("mdia",
+			mdhd(videoTimescale),
+			hdlr("vide", "VideoHandler"),
+			box("minf",
+				fullBox("vmhd", 0, 0x000001, vmhd),
+				dinf(),
+				stbl(box("vp08", entry, fullBox("vpcC", 1, 0, vpcc))),
+			),
+		),
+	)
+}
+
+func audioTrak(channels uint16) []byte {
+	entry := zeros(nil, 6)
+	entry = u16(entry, 1) // data reference index
+	entry = zeros(entry, 8)
+	entry = u16(entry, channels)
+	entry = u16(entry, 16) // sample size
+	entry = zeros(entry, 4)
+	entry = u32(entry, audioTimescale<<16)
+
+	dops := u8(nil, 0) // version
+	dops = u8(dops, uint8(channels))
+	dops = u16(dops, 0) // pre skip
+	dops = u32(dops, audioTimescale)
+	dops = u16(dops, 0) // output gain
+	dops = u8(dops, 0)  // channel mapping family
+
+	return box("trak",
+		tkhd(audioTrackID, 0x0100, 0, 0),
+		box("mdia",
+			mdhd(audioTimescale),
+			hdlr("soun", "SoundHandler"),
+			box("minf",
+				fullBox("smhd", 0, 0, zeros(nil, 4)),
+				dinf(),
+				stbl(box("Opus", entry, box("dOps", dops))),
+			),
+		),
+	)
+}
+
+func trex(trackID uint32) []byte {
+	b := u32(nil, trackID)
+	b = u32(b, 1) // sample description index
+	b = u32(b, 0)
+	b = u32(b, 0)
+	b = u32(b, 0)
+	return fullBox("trex", 0, 0, b)
+}
+
+// fragment moof and mdat of samples, a track without samples is left out
+func fragment(sequence uint32, video, audio []*sample) []byte {
+	build := func(videoOffset, audioOffset uint32) []byte {
+		payloads := [][]byte{fullBox("mfhd", 0, 0, u32(nil, sequence))}
+		if len(video) > 0 {
+			payloads = append(payloads, traf(videoTrackID, video, videoOffset))
+		}
+		if len(audio) > 0 {
+			payloads = append(payloads, traf(audioTrackID, audio, audioOffset))
+		}
+		return box("moof", payloads...)
+	}
+
+	// sizes do not depend on offsets, build once to know where mdat starts
+	moofSize := uint32(len(build(0, 0)))
+	videoSize := uint32(0)
+	data := make([][]byte, 0, len(video)+len(audio))
+	for _, s := range video {
+		videoSize += uint32(len(s.data))
+		data = append(data, s.data)
+	}
+	for _, s := range audio {
+		data = append(data, s.data)
+	}
+
+	moof := build(moofSize+8, moofSize+8+videoSize)
+	return append(moof, box("mdat", data...)...)
+}
+
+func traf(trackID uint32, samples []*sample, dataOffset uint32) []byte {
+	run := u32(nil, uint32(len(samples)))
+	run = u32(run, dataOffset)
+	for _, s := range samples {
+		run = u32(run, s.duration)
+		run = u32(run, uint32(len(s.data)))
+		if s.keyframe {
+			run = u32(run, keyframeFlags)
+		} else {
+			run = u32(run, nonKeyframeFlags)
+		}
+	}
+
+	return box("traf",
+		fullBox("tfhd", 0, tfhdFlags, u32(nil, trackID)),
+		fullBox("tfdt", 1, 0, u64(nil, samples[0].dts)),
+		fullBox("trun", 0, trunFlags, run),
+	)
+}
@@ -0,0 +1,88 @@
+package hls
+
+import (
+	"fmt"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ServeHTTP serve index.m3u8, init.mp4, segN.m4s and segN.partM.m4s,
+// strip any path prefix before it
+func (p *Packager) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	// blocking requests wait at most 3 target durations
+	timeout := 3 * p.config.SegmentDuration
+	name := path.Base(r.URL.Path)
+
+	switch {
+	case name == "index.m3u8":
+		if p.IsLowLatency() {
+			if err := p.blockReload(r, timeout); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+		}
+
+		playlist := p.Playlist()
+		if playlist == "" {
+			http.Error(w, "stream is not started", http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", "application/vnd.apple.mpegurl")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.Write([]byte(playlist))
+	case name == "init.mp4":
+		writeMP4(w, p.getInit())
+	case strings.Contains(name, ".part"):
+		var sequence, index int
+		if _, err := fmt.Sscanf(name, "seg%d.part%d.m4s", &sequence, &index); err != nil {
+			http.NotFound(w, r)
+			return
+		}
+		// preload hint of next part is held until ready
+		p.wait(sequence, index, timeout)
+		writeMP4(w, p.getPart(sequence, index))
+	default:
+		var sequence int
+		if _, err := fmt.Sscanf(name, "seg%d.m4s", &sequence); err != nil {
+			http.NotFound(w, r)
+			return
+		}
+		writeMP4(w, p.getSegment(sequence))
+	}
+}
+
+// blockReload hold playlist request until _HLS_msn and _HLS_part are available
+func (p *Packager) blockReload(r *http.Request, timeout time.Duration) error {
+	query := r.URL.Query()
+	rawMSN := query.Get("_HLS_msn")
+	if rawMSN == "" {
+		return nil
+	}
+
+	msn, err := strconv.Atoi(rawMSN)
+	if err != nil {
+		return fmt.Errorf("invalid _HLS_msn: %s", rawMSN)
+	}
+
+	part := -1
+	if rawPart := query.Get("_HLS_part"); rawPart != "" {
+		if part, err = strconv.Atoi(rawPart); err != nil {
+			return fmt.Errorf("invalid _HLS_part: %s", rawPart)
+		}
+	}
+
+	p.wait(msn, part, timeout)
+	return nil
+}
+
+func writeMP4(w http.ResponseWriter, data []byte) {
+	if data == nil {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "video/mp4")
+	w.Write(data)
+}
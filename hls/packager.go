@@ -0,0 +1,386 @@
+package hls
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/lamhai1401/testrtc/codec"
+	"github.com/pion/rtp"
+)
+
+const (
+	defaultVideoDuration = videoTimescale / 30 // 30 fps
+	defaultAudioDuration = audioTimescale / 50 // 20 ms opus frame
+	audioChannels        = 2
+	partsInPlaylist      = 2 // complete segments that still list their parts
+)
+
+// Config linter
+type Config struct {
+	SegmentDuration time.Duration // target duration, segments are cut at the next keyframe after it
+	PartDuration    time.Duration // low latency partial segments, 0 is disabled
+	WindowSize      int           // segments kept in playlist
+}
+
+type part struct {
+	data        []byte
+	duration    float64 // seconds
+	independent bool    // starts with a keyframe
+}
+
+type segment struct {
+	sequence int
+	parts    []*part
+	duration float64 // seconds
+	data     []byte  // set when complete
+}
+
+// timeline map rtp timestamps of one track to decode times from start of packager
+type timeline struct {
+	timescale uint32
+	lastTS    uint32
+	dts       uint64
+	started   bool
+}
+
+func (t *timeline) next(timestamp uint32, arrival, start time.Time) uint64 {
+	if !t.started {
+		t.started = true
+		t.lastTS = timestamp
+		t.dts = uint64(arrival.Sub(start).Seconds() * float64(t.timescale))
+		return t.dts
+	}
+
+	delta := int64(int32(timestamp - t.lastTS))
+	t.lastTS = timestamp
+	if delta < 0 && uint64(-delta) > t.dts {
+		delta = -int64(t.dts)
+	}
+	t.dts = uint64(int64(t.dts) + delta)
+	return t.dts
+}
+
+// Packager segment mixer output (vp8 and opus) to fmp4 hls with a rolling playlist
+type Packager struct {
+	config       Config
+	builder      *codec.FrameBuilder
+	videoClock   *timeline
+	audioClock   *timeline
+	startTime    time.Time
+	init         []byte
+	segments     []*segment // complete segments in window
+	current      *segment
+	lastVideo    *sample // waiting for next frame to know its duration
+	lastAudio    *sample
+	partVideo    []*sample
+	partAudio    []*sample
+	partDuration uint64 // video timescale units in current part
+	fragmentSeq  uint32
+	changed      chan struct{} // closed and replaced on every new part
+	isClosed     bool
+	mutex        sync.Mutex
+}
+
+// NewPackager linter
+func NewPackager(config Config) *Packager {
+	if config.SegmentDuration <= 0 {
+		config.SegmentDuration = 2 * time.Second
+	}
+	if config.WindowSize <= 0 {
+		config.WindowSize = 6
+	}
+	if config.PartDuration >= config.SegmentDuration {
+		config.PartDuration = 0
+	}
+
+	return &Packager{
+		config:     config,
+		builder:    codec.NewFrameBuilder(codec.VP8),
+		videoClock: &timeline{timescale: videoTimescale},
+		audioClock: &timeline{timescale: audioTimescale},
+		startTime:  time.Now(),
+		segments:   make([]*segment, 0),
+		changed:    make(chan struct{}),
+	}
+}
+
+// IsLowLatency linter
+func (p *Packager) IsLowLatency() bool {
+	return p.config.PartDuration > 0
+}
+
+// PushVideo a mixed vp8 packet
+func (p *Packager) PushVideo(pkt *rtp.Packet) error {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	if p.isClosed {
+		return fmt.Errorf("hls packager was closed")
+	}
+
+	frame, err := p.builder.Push(pkt)
+	if err != nil || frame == nil {
+		return err
+	}
+
+	if p.init == nil {
+		if !frame.Keyframe || frame.Width == 0 || frame.Height == 0 {
+			return nil
+		}
+		p.init = initSegment(frame.Width, frame.Height, audioChannels)
+		p.current = &segment{sequence: 0}
+	}
+
+	dts := p.videoClock.next(frame.Timestamp, time.Now(), p.startTime)
+	if last := p.lastVideo; last != nil {
+		last.duration = defaultVideoDuration
+		if dts > last.dts {
+			last.duration = uint32(dts - last.dts)
+		}
+		p.partVideo = append(p.partVideo, last)
+		p.partDuration += uint64(last.duration)
+
+		if frame.Keyframe && p.segmentDuration() >= p.config.SegmentDuration.Seconds() {
+			p.cutSegment()
+		} else if p.config.PartDuration > 0 && p.partDuration >= uint64(p.config.PartDuration.Seconds()*videoTimescale) {
+			p.flushPart()
+		}
+	}
+
+	p.lastVideo = &sample{
+		data:     frame.Data,
+		dts:      dts,
+		keyframe: frame.Keyframe,
+	}
+	return nil
+}
+
+// PushAudio a mixed opus packet, audio before first video keyframe is dropped
+func (p *Packager) PushAudio(pkt *rtp.Packet) error {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	if p.isClosed {
+		return fmt.Errorf("hls packager was closed")
+	}
+	if p.init == nil {
+		return nil
+	}
+
+	dts := p.audioClock.next(pkt.Timestamp, time.Now(), p.startTime)
+	if last := p.lastAudio; last != nil {
+		last.duration = defaultAudioDuration
+		if dts > last.dts {
+			last.duration = uint32(dts - last.dts)
+		}
+		p.partAudio = append(p.partAudio, last)
+	}
+
+	p.lastAudio = &sample{
+		data:     append([]byte{}, pkt.Payload...),
+		dts:      dts,
+		keyframe: true,
+	}
+	return nil
+}
+
+// seconds of current segment including unflushed part
+func (p *Packager) segmentDuration() float64 {
+	return p.current.duration + float64(p.partDuration)/videoTimescale
+}
+
+func (p *Packager) flushPart() {
+	if len(p.partVideo) == 0 {
+		return
+	}
+
+	p.fragmentSeq++
+	part := &part{
+		data:        fragment(p.fragmentSeq, p.partVideo, p.partAudio),
+		duration:    float64(p.partDuration) / videoTimescale,
+		independent: p.partVideo[0].keyframe,
+	}
+	p.current.parts = append(p.current.parts, part)
+	p.current.duration += part.duration
+
+	p.partVideo = nil
+	p.partAudio = nil
+	p.partDuration = 0
+	p.notify()
+}
+
+func (p *Packager) cutSegment() {
+	p.flushPart()
+
+	done := p.current
+	for _, part := range done.parts {
+		done.data = append(done.data, part.data...)
+	}
+	p.segments = append(p.segments, done)
+	if len(p.segments) > p.config.WindowSize {
+		p.segments = p.segments[len(p.segments)-p.config.WindowSize:]
+	}
+
+	p.current = &segment{sequence: done.sequence + 1}
+	p.notify()
+}
+
+func (p *Packager) notify() {
+	close(p.changed)
+	p.changed = make(chan struct{})
+}
+
+// Close wake up blocked requests, packets after it are rejected
+func (p *Packager) Close() {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	if p.isClosed {
+		return
+	}
+	p.isClosed = true
+	p.notify()
+}
+
+// hasPart check segment sequence has at least part + 1 parts, part < 0 means segment is complete
+func (p *Packager) hasPart(sequence, part int) bool {
+	if p.current == nil {
+		return false
+	}
+	if sequence < p.current.sequence {
+		return true
+	}
+	if sequence > p.current.sequence {
+		return false
+	}
+	return part >= 0 && part < len(p.current.parts)
+}
+
+// wait until hasPart or timeout, return false on timeout
+func (p *Packager) wait(sequence, part int, timeout time.Duration) bool {
+	deadline := time.After(timeout)
+	for {
+		p.mutex.Lock()
+		ok := p.hasPart(sequence, part)
+		closed := p.isClosed
+		changed := p.changed
+		p.mutex.Unlock()
+
+		if ok {
+			return true
+		}
+		if closed {
+			return false
+		}
+
+		select {
+		case <-changed:
+		case <-deadline:
+			return false
+		}
+	}
+}
+
+// getInit linter
+func (p *Packager) getInit() []byte {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	return p.init
+}
+
+// getSegment return complete segment data
+func (p *Packager) getSegment(sequence int) []byte {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	for _, s := range p.segments {
+		if s.sequence == sequence {
+			return s.data
+		}
+	}
+	return nil
+}
+
+// getPart return part data of a complete or current segment
+func (p *Packager) getPart(sequence, index int) []byte {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	segments := p.segments
+	if p.current != nil {
+		segments = append(segments[:len(segments):len(segments)], p.current)
+	}
+	for _, s := range segments {
+		if s.sequence == sequence && index >= 0 && index < len(s.parts) {
+			return s.parts[index].data
+		}
+	}
+	return nil
+}
+
+// Playlist render media playlist, empty before first keyframe
+func (p *Packager) Playlist() string {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	if p.current == nil {
+		return ""
+	}
+
+	lowLatency := p.config.PartDuration > 0
+	target := p.config.SegmentDuration.Seconds()
+	for _, s := range p.segments {
+		target = math.Max(target, s.duration)
+	}
+
+	b := &strings.Builder{}
+	b.WriteString("#EXTM3U\n")
+	if lowLatency {
+		partTarget := p.config.PartDuration.Seconds()
+		for _, s := range p.segments {
+			for _, part := range s.parts {
+				partTarget = math.Max(partTarget, part.duration)
+			}
+		}
+		b.WriteString("#EXT-X-VERSION:9\n")
+		fmt.Fprintf(b, "#EXT-X-TARGETDURATION:%d\n", int(math.Ceil(target)))
+		fmt.Fprintf(b, "#EXT-X-SERVER-CONTROL:CAN-BLOCK-RELOAD=YES,PART-HOLD-BACK=%.3f\n", 3*partTarget)
+		fmt.Fprintf(b, "#EXT-X-PART-INF:PART-TARGET=%.3f\n", partTarget)
+	} else {
+		b.WriteString("#EXT-X-VERSION:7\n")
+		fmt.Fprintf(b, "#EXT-X-TARGETDURATION:%d\n", int(math.Ceil(target)))
+	}
+
+	first := p.current.sequence
+	if len(p.segments) > 0 {
+		first = p.segments[0].sequence
+	}
+	fmt.Fprintf(b, "#EXT-X-MEDIA-SEQUENCE:%d\n", first)
+	b.WriteString("#EXT-X-MAP:URI=\"init.mp4\"\n")
+
+	for i, s := range p.segments {
+		if lowLatency && i >= len(p.segments)-partsInPlaylist {
+			writeParts(b, s)
+		}
+		fmt.Fprintf(b, "#EXTINF:%.3f,\n", s.duration)
+		fmt.Fprintf(b, "seg%d.m4s\n", s.sequence)
+	}
+
+	if lowLatency {
+		writeParts(b, p.current)
+		fmt.Fprintf(b, "#EXT-X-PRELOAD-HINT:TYPE=PART,URI=\"%s\"\n", partName(p.current.sequence, len(p.current.parts)))
+	}
+	return b.String()
+}
+
+func writeParts(b *strings.Builder, s *segment) {
+	for i, part := range s.parts {
+		fmt.Fprintf(b, "#EXT-X-PART:DURATION=%.3f,URI=\"%s\"", part.duration, partName(s.sequence, i))
+		if part.independent {
+			b.WriteString(",INDEPENDENT=YES")
+		}
+		b.WriteString("\n")
+	}
+}
+
+func partName(sequence, index int) string {
+	return fmt.Sprintf("seg%d.part%d.m4s", sequence, index)
+}
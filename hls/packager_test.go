@@ -0,0 +1,71 @@
+package hls
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pion/rtp"
+)
+
+func vp8Packet(seq uint16, keyframe bool) *rtp.Packet {
+	payload := []byte{0x10} // start of partition 0
+	if keyframe {
+		payload = append(payload, 0x00, 0x00, 0x00, 0x9d, 0x01, 0x2a, 0x80, 0x02, 0xe0, 0x01)
+	} else {
+		payload = append(payload, 0x01, 0x00, 0x00, 0xff)
+	}
+
+	return &rtp.Packet{
+		Header: rtp.Header{
+			SequenceNumber: seq,
+			Timestamp:      uint32(seq) * 3000,
+			Marker:         true,
+		},
+		Payload: payload,
+	}
+}
+
+func TestPackager(t *testing.T) {
+	p := NewPackager(Config{
+		SegmentDuration: time.Second,
+		PartDuration:    200 * time.Millisecond,
+		WindowSize:      2,
+	})
+
+	for seq := uint16(0); seq < 100; seq++ {
+		if err := p.PushVideo(vp8Packet(seq, seq%30 == 0)); err != nil {
+			t.Fatal(err)
+		}
+		if err := p.PushAudio(&rtp.Packet{
+			Header:  rtp.Header{SequenceNumber: seq, Timestamp: uint32(seq) * 1600},
+			Payload: []byte{0xfc},
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if init := p.getInit(); len(init) < 8 || string(init[4:8]) != "ftyp" {
+		t.Fatalf("init segment does not start with ftyp")
+	}
+
+	playlist := p.Playlist()
+	for _, line := range []string{
+		"#EXT-X-MEDIA-SEQUENCE:1",
+		"#EXTINF:1.000,\nseg1.m4s",
+		"#EXTINF:1.000,\nseg2.m4s",
+		"#EXT-X-PART:DURATION=0.200,URI=\"seg3.part0.m4s\",INDEPENDENT=YES",
+		"#EXT-X-PRELOAD-HINT:TYPE=PART,URI=\"seg3.part1.m4s\"",
+	} {
+		if !strings.Contains(playlist, line) {
+			t.Fatalf("playlist misses %q:\n%s", line, playlist)
+		}
+	}
+
+	if seg := p.getSegment(2); len(seg) < 8 || string(seg[4:8]) != "moof" {
+		t.Fatalf("segment does not start with moof")
+	}
+	if p.getSegment(0) != nil {
+		t.Fatalf("segment 0 should be out of window")
+	}
+}
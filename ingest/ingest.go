@@ -0,0 +1,49 @@
+package ingest
+
+import (
+	"fmt"
+)
+
+// Ingest a virtual participant made of plain rtp sources
+type Ingest struct {
+	signalID string
+	sources  []*Source
+}
+
+// NewIngest listen on every stream of sdp, packets are handled under signalID
+func NewIngest(signalID, sdp string, handler Handler) (*Ingest, error) {
+	streams, err := ParseSDP(sdp)
+	if err != nil {
+		return nil, err
+	}
+
+	i := &Ingest{
+		signalID: signalID,
+		sources:  make([]*Source, 0, len(streams)),
+	}
+	for _, stream := range streams {
+		source, err := NewSource(stream, handler)
+		if err != nil {
+			i.Close()
+			return nil, fmt.Errorf("listen %s on port %d err: %v", stream.Kind, stream.Port, err)
+		}
+		i.sources = append(i.sources, source)
+	}
+
+	for _, source := range i.sources {
+		source.Start()
+	}
+	return i, nil
+}
+
+// GetSignalID linter
+func (i *Ingest) GetSignalID() string {
+	return i.signalID
+}
+
+// Close stop all sources
+func (i *Ingest) Close() {
+	for _, source := range i.sources {
+		source.Close()
+	}
+}
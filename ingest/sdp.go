@@ -0,0 +1,145 @@
+package ingest
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/lamhai1401/testrtc/codec"
+)
+
+// Stream one media line of an ingest sdp
+type Stream struct {
+	Kind        string // audio or video
+	Port        int
+	PayloadType uint8
+	Codec       string // lower case codec name
+	ClockRate   uint32
+	Channels    uint16
+	SSRC        uint32 // 0 is any ssrc
+	Control     string // rtsp track url
+}
+
+// ParseSDP read audio and video streams of a plain rtp sdp
+func ParseSDP(raw string) ([]*Stream, error) {
+	streams, err := ParseMedia(raw)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, stream := range streams {
+		if stream.Port <= 0 {
+			return nil, fmt.Errorf("%s stream has no port", stream.Kind)
+		}
+		if err := stream.Validate(); err != nil {
+			return nil, err
+		}
+	}
+	return streams, nil
+}
+
+// ParseMedia read audio and video media lines without checking codecs,
+// the first payload type of every m= line is used
+func ParseMedia(raw string) ([]*Stream, error) {
+	streams := make([]*Stream, 0, 2)
+	var current *Stream
+
+	for _, line := range strings.Split(raw, "\n") {
+		line = strings.TrimSpace(line)
+		switch {
+		case strings.HasPrefix(line, "m="):
+			fields := strings.Fields(strings.TrimPrefix(line, "m="))
+			if len(fields) < 4 {
+				return nil, fmt.Errorf("invalid media line: %s", line)
+			}
+			if fields[0] != "audio" && fields[0] != "video" {
+				current = nil
+				continue
+			}
+
+			port, err := strconv.Atoi(fields[1])
+			if err != nil || port < 0 || port > 65535 {
+				return nil, fmt.Errorf("invalid media port: %s", line)
+			}
+			pt, err := strconv.ParseUint(fields[3], 10, 7)
+			if err != nil {
+				return nil, fmt.Errorf("invalid payload type: %s", line)
+			}
+
+			current = &Stream{
+				Kind:        fields[0],
+				Port:        port,
+				PayloadType: uint8(pt),
+			}
+			streams = append(streams, current)
+		case current == nil:
+			continue
+		case strings.HasPrefix(line, "a=rtpmap:"):
+			if err := current.setRTPMap(strings.TrimPrefix(line, "a=rtpmap:")); err != nil {
+				return nil, err
+			}
+		case strings.HasPrefix(line, "a=control:"):
+			current.Control = strings.TrimPrefix(line, "a=control:")
+		case strings.HasPrefix(line, "a=ssrc:"):
+			fields := strings.Fields(strings.TrimPrefix(line, "a=ssrc:"))
+			if len(fields) == 0 {
+				continue
+			}
+			ssrc, err := strconv.ParseUint(fields[0], 10, 32)
+			if err != nil {
+				return nil, fmt.Errorf("invalid ssrc: %s", line)
+			}
+			current.SSRC = uint32(ssrc)
+		}
+	}
+
+	if len(streams) == 0 {
+		return nil, fmt.Errorf("sdp has no audio or video stream")
+	}
+	return streams, nil
+}
+
+// setRTPMap read "<pt> <codec>/<clock rate>[/<channels>]" of stream payload type
+func (s *Stream) setRTPMap(value string) error {
+	fields := strings.Fields(value)
+	if len(fields) != 2 {
+		return fmt.Errorf("invalid rtpmap: %s", value)
+	}
+	if pt, err := strconv.ParseUint(fields[0], 10, 7); err != nil || uint8(pt) != s.PayloadType {
+		return nil
+	}
+
+	parts := strings.Split(fields[1], "/")
+	if len(parts) < 2 {
+		return fmt.Errorf("invalid rtpmap: %s", value)
+	}
+	rate, err := strconv.ParseUint(parts[1], 10, 32)
+	if err != nil {
+		return fmt.Errorf("invalid clock rate: %s", value)
+	}
+
+	s.Codec = strings.ToLower(parts[0])
+	s.ClockRate = uint32(rate)
+	s.Channels = 1
+	if len(parts) > 2 {
+		channels, err := strconv.ParseUint(parts[2], 10, 16)
+		if err != nil {
+			return fmt.Errorf("invalid channels: %s", value)
+		}
+		s.Channels = uint16(channels)
+	}
+	return nil
+}
+
+// Validate the mixer decodes vp8 video and opus audio only
+func (s *Stream) Validate() error {
+	switch {
+	case s.Codec == "":
+		return fmt.Errorf("%s payload type %d has no rtpmap", s.Kind, s.PayloadType)
+	case s.Kind == "video" && s.Codec != codec.VP8:
+		return fmt.Errorf("video codec %s is not supported, use vp8", s.Codec)
+	case s.Kind == "audio" && s.Codec != codec.Opus:
+		return fmt.Errorf("audio codec %s is not supported, use opus", s.Codec)
+	}
+	return nil
+}
@@ -0,0 +1,37 @@
+package ingest
+
+import (
+	"testing"
+)
+
+func TestParseSDP(t *testing.T) {
+	streams, err := ParseSDP(`v=0
+o=- 0 0 IN IP4 127.0.0.1
+s=camera
+c=IN IP4 127.0.0.1
+t=0 0
+m=video 5004 RTP/AVP 96
+a=rtpmap:96 VP8/90000
+a=ssrc:1234 cname:camera
+m=audio 5006 RTP/AVP 111 0
+a=rtpmap:111 opus/48000/2
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(streams) != 2 {
+		t.Fatalf("expect 2 streams, got %d", len(streams))
+	}
+
+	video, audio := streams[0], streams[1]
+	if video.Kind != "video" || video.Port != 5004 || video.PayloadType != 96 || video.Codec != "vp8" || video.ClockRate != 90000 || video.SSRC != 1234 {
+		t.Fatalf("wrong video stream: %+v", video)
+	}
+	if audio.Kind != "audio" || audio.Port != 5006 || audio.PayloadType != 111 || audio.Codec != "opus" || audio.Channels != 2 || audio.SSRC != 0 {
+		t.Fatalf("wrong audio stream: %+v", audio)
+	}
+
+	if _, err := ParseSDP("m=video 5004 RTP/AVP 96\na=rtpmap:96 H264/90000\n"); err == nil {
+		t.Fatalf("expect unsupported codec err")
+	}
+}
@@ -0,0 +1,118 @@
+package ingest
+
+import (
+	"fmt"
+	"net"
+	"sync"
+
+	"github.com/lamhai1401/gologs/logs"
+	"github.com/lamhai1401/testrtc/jitter"
+	"github.com/lamhai1401/testrtc/utils"
+	"github.com/pion/rtp"
+)
+
+const (
+	maxPacketSize = 1500
+)
+
+// Handler receive packets of a stream in sequence order
+type Handler func(stream *Stream, pkt *rtp.Packet)
+
+// Source receive plain rtp of one stream on a udp port
+type Source struct {
+	stream   *Stream
+	conn     *net.UDPConn
+	buffer   *jitter.Buffer
+	handler  Handler
+	allowed  []*net.IPNet // networks packets may come from
+	isClosed bool
+	mutex    sync.RWMutex
+}
+
+// NewSource listen on stream port, packets from outside INGESTSOURCES are dropped
+func NewSource(stream *Stream, handler Handler) (*Source, error) {
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{Port: stream.Port})
+	if err != nil {
+		return nil, err
+	}
+
+	return &Source{
+		stream:  stream,
+		conn:    conn,
+		buffer:  jitter.NewBuffer(utils.GetJitterSize(), utils.GetJitterLatency()),
+		handler: handler,
+		allowed: utils.GetIngestSources(),
+	}, nil
+}
+
+// Start reading packets until closed
+func (s *Source) Start() {
+	go s.serve()
+}
+
+// GetStream linter
+func (s *Source) GetStream() *Stream {
+	return s.stream
+}
+
+func (s *Source) serve() {
+	releaser := jitter.NewReleaser(s.buffer, func(pkt *rtp.Packet) {
+		s.handler(s.stream, pkt)
+	})
+	defer releaser.Close()
+
+	buf := make([]byte, maxPacketSize)
+	for {
+		n, addr, err := s.conn.ReadFromUDP(buf)
+		if err != nil {
+			if !s.checkClose() {
+				logs.Error(fmt.Sprintf("Read %s ingest on port %d err: %v", s.stream.Kind, s.stream.Port, err))
+			}
+			return
+		}
+
+		if !s.isAllowed(addr.IP) {
+			continue
+		}
+
+		pkt := &rtp.Packet{}
+		if err := pkt.Unmarshal(append([]byte{}, buf[:n]...)); err != nil {
+			continue
+		}
+		if pkt.PayloadType != s.stream.PayloadType {
+			continue
+		}
+		if s.stream.SSRC != 0 && pkt.SSRC != s.stream.SSRC {
+			continue
+		}
+
+		releaser.Push(pkt)
+	}
+}
+
+func (s *Source) isAllowed(ip net.IP) bool {
+	for _, network := range s.allowed {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *Source) checkClose() bool {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	return s.isClosed
+}
+
+// Close stop listening
+func (s *Source) Close() error {
+	s.mutex.Lock()
+	if s.isClosed {
+		s.mutex.Unlock()
+		return nil
+	}
+	s.isClosed = true
+	s.mutex.Unlock()
+	return s.conn.Close()
+}
@@ -0,0 +1,40 @@
+package ingest
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/pion/rtp"
+)
+
+func TestDropOutsideSources(t *testing.T) {
+	received := make(chan uint16, 10)
+	source, err := NewSource(&Stream{Kind: "audio", PayloadType: 111}, func(stream *Stream, pkt *rtp.Packet) {
+		received <- pkt.SequenceNumber
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer source.Close()
+	_, other, _ := net.ParseCIDR("192.0.2.0/24")
+	source.allowed = []*net.IPNet{other}
+	source.Start()
+
+	conn, err := net.Dial("udp", source.conn.LocalAddr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	for seq := uint16(1); seq <= 3; seq++ {
+		pkt := &rtp.Packet{Header: rtp.Header{Version: 2, PayloadType: 111, SequenceNumber: seq}, Payload: []byte{1}}
+		data, _ := pkt.Marshal()
+		conn.Write(data)
+	}
+
+	select {
+	case seq := <-received:
+		t.Fatalf("packet %d from loopback was ingested", seq)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
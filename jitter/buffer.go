@@ -0,0 +1,182 @@
+package jitter
+
+import (
+	"sync"
+	"time"
+
+	"github.com/pion/rtp"
+)
+
+// sequence jump bigger than this is a stream restart, not reordering
+const resetThreshold = 3000
+
+// Stats linter
+type Stats struct {
+	Depth    int    `json:"depth"`    // packets waiting in buffer
+	Received uint64 `json:"received"` // all pushed packets
+	Late     uint64 `json:"late"`     // packets arrived after their turn, discarded
+	Lost     uint64 `json:"lost"`     // sequence numbers skipped
+	Dropped  uint64 `json:"dropped"`  // duplicated packets
+}
+
+type item struct {
+	pkt     *rtp.Packet
+	arrival time.Time
+}
+
+// Buffer reorder rtp packets by sequence number
+type Buffer struct {
+	size    int           // max packets waiting for a missing one
+	latency time.Duration // max time a packet waits for a missing one
+	packets map[uint16]*item
+	next    uint16 // next sequence number to release
+	started bool
+	stats   Stats
+	mutex   sync.RWMutex
+}
+
+// NewBuffer linter
+func NewBuffer(size int, latency time.Duration) *Buffer {
+	if size < 1 {
+		size = 1
+	}
+	return &Buffer{
+		size:    size,
+		latency: latency,
+		packets: make(map[uint16]*item),
+	}
+}
+
+// Push packet and return packets ready in order
+func (b *Buffer) Push(pkt *rtp.Packet) []*rtp.Packet {
+	return b.push(pkt, time.Now())
+}
+
+func (b *Buffer) push(pkt *rtp.Packet, now time.Time) []*rtp.Packet {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	b.stats.Received++
+	out := make([]*rtp.Packet, 0, 1)
+
+	if !b.started {
+		b.started = true
+		b.next = pkt.SequenceNumber
+	}
+
+	diff := int16(pkt.SequenceNumber - b.next)
+	switch {
+	case diff > resetThreshold || diff < -resetThreshold:
+		// sender restarted, release everything and start again
+		out = append(out, b.flush()...)
+		b.next = pkt.SequenceNumber
+	case diff < 0:
+		b.stats.Late++
+		return b.release(out, now)
+	}
+
+	if _, ok := b.packets[pkt.SequenceNumber]; ok {
+		b.stats.Dropped++
+		return b.release(out, now)
+	}
+
+	b.packets[pkt.SequenceNumber] = &item{
+		pkt:     pkt,
+		arrival: now,
+	}
+	return b.release(out, now)
+}
+
+// Flush return all waiting packets in order and skip the gaps
+func (b *Buffer) Flush() []*rtp.Packet {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return b.flush()
+}
+
+// Expire return the packets released by latency alone, for streams that paused
+// and push nothing that would release them
+func (b *Buffer) Expire() []*rtp.Packet {
+	return b.expire(time.Now())
+}
+
+func (b *Buffer) expire(now time.Time) []*rtp.Packet {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return b.release(make([]*rtp.Packet, 0), now)
+}
+
+// GetLatency linter
+func (b *Buffer) GetLatency() time.Duration {
+	return b.latency
+}
+
+// Stats return current statistics
+func (b *Buffer) Stats() Stats {
+	b.mutex.RLock()
+	defer b.mutex.RUnlock()
+	stats := b.stats
+	stats.Depth = len(b.packets)
+	return stats
+}
+
+func (b *Buffer) flush() []*rtp.Packet {
+	out := make([]*rtp.Packet, 0, len(b.packets))
+	for len(b.packets) > 0 {
+		out = b.releaseInOrder(out)
+		if len(b.packets) > 0 {
+			b.skip()
+		}
+	}
+	return out
+}
+
+// release packets in order, skip a gap if buffer is full or waited too long
+func (b *Buffer) release(out []*rtp.Packet, now time.Time) []*rtp.Packet {
+	for {
+		out = b.releaseInOrder(out)
+		if len(b.packets) == 0 {
+			return out
+		}
+		if len(b.packets) <= b.size && now.Sub(b.oldest()) < b.latency {
+			return out
+		}
+		b.skip()
+	}
+}
+
+func (b *Buffer) releaseInOrder(out []*rtp.Packet) []*rtp.Packet {
+	for {
+		it, ok := b.packets[b.next]
+		if !ok {
+			return out
+		}
+		delete(b.packets, b.next)
+		out = append(out, it.pkt)
+		b.next++
+	}
+}
+
+// skip the missing sequence numbers up to the closest waiting packet
+func (b *Buffer) skip() {
+	closest := -1
+	for seq := range b.packets {
+		if distance := int(seq - b.next); closest < 0 || distance < closest {
+			closest = distance
+		}
+	}
+	if closest > 0 {
+		b.stats.Lost += uint64(closest)
+		b.next += uint16(closest)
+	}
+}
+
+func (b *Buffer) oldest() time.Time {
+	var oldest time.Time
+	for _, it := range b.packets {
+		if oldest.IsZero() || it.arrival.Before(oldest) {
+			oldest = it.arrival
+		}
+	}
+	return oldest
+}
@@ -0,0 +1,129 @@
+package jitter
+
+import (
+	"testing"
+	"time"
+
+	"github.com/pion/rtp"
+)
+
+func newPacket(seq uint16) *rtp.Packet {
+	return &rtp.Packet{
+		Header: rtp.Header{
+			SequenceNumber: seq,
+		},
+	}
+}
+
+func sequences(packets []*rtp.Packet) []uint16 {
+	seqs := make([]uint16, 0, len(packets))
+	for _, pkt := range packets {
+		seqs = append(seqs, pkt.SequenceNumber)
+	}
+	return seqs
+}
+
+func equal(a, b []uint16) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestReorderWithWraparound(t *testing.T) {
+	b := NewBuffer(10, time.Second)
+	now := time.Now()
+
+	var out []*rtp.Packet
+	for _, seq := range []uint16{65534, 0, 65535, 2, 1} {
+		out = append(out, b.push(newPacket(seq), now)...)
+	}
+
+	want := []uint16{65534, 65535, 0, 1, 2}
+	if got := sequences(out); !equal(got, want) {
+		t.Fatalf("expect %v, got %v", want, got)
+	}
+	if stats := b.Stats(); stats.Depth != 0 || stats.Lost != 0 || stats.Received != 5 {
+		t.Fatalf("wrong stats: %+v", stats)
+	}
+}
+
+func TestDiscardLateAndSkipLost(t *testing.T) {
+	b := NewBuffer(2, time.Second)
+	now := time.Now()
+
+	var out []*rtp.Packet
+	for _, seq := range []uint16{10, 12, 13, 14, 11} {
+		out = append(out, b.push(newPacket(seq), now)...)
+	}
+
+	want := []uint16{10, 12, 13, 14}
+	if got := sequences(out); !equal(got, want) {
+		t.Fatalf("expect %v, got %v", want, got)
+	}
+	if stats := b.Stats(); stats.Lost != 1 || stats.Late != 1 {
+		t.Fatalf("wrong stats: %+v", stats)
+	}
+}
+
+func TestReleaseAfterLatency(t *testing.T) {
+	b := NewBuffer(10, 100*time.Millisecond)
+	now := time.Now()
+
+	b.push(newPacket(1), now)
+	if out := b.push(newPacket(3), now); len(out) != 0 {
+		t.Fatalf("expect packet 3 to wait, got %v", sequences(out))
+	}
+
+	out := b.push(newPacket(4), now.Add(200*time.Millisecond))
+	want := []uint16{3, 4}
+	if got := sequences(out); !equal(got, want) {
+		t.Fatalf("expect %v, got %v", want, got)
+	}
+}
+
+func TestExpireWithoutNewPacket(t *testing.T) {
+	b := NewBuffer(10, 100*time.Millisecond)
+	now := time.Now()
+
+	b.push(newPacket(1), now)
+	b.push(newPacket(3), now)
+	if out := b.expire(now.Add(50 * time.Millisecond)); len(out) != 0 {
+		t.Fatalf("expect packet 3 to wait, got %v", sequences(out))
+	}
+
+	out := b.expire(now.Add(200 * time.Millisecond))
+	want := []uint16{3}
+	if got := sequences(out); !equal(got, want) {
+		t.Fatalf("expect %v, got %v", want, got)
+	}
+	if stats := b.Stats(); stats.Lost != 1 || stats.Depth != 0 {
+		t.Fatalf("wrong stats: %+v", stats)
+	}
+}
+
+func TestReleaserExpires(t *testing.T) {
+	released := make(chan uint16, 10)
+	r := NewReleaser(NewBuffer(10, 20*time.Millisecond), func(pkt *rtp.Packet) {
+		released <- pkt.SequenceNumber
+	})
+	defer r.Close()
+
+	r.Push(newPacket(1))
+	r.Push(newPacket(3))
+	for _, want := range []uint16{1, 3} {
+		select {
+		case got := <-released:
+			if got != want {
+				t.Fatalf("expect %d, got %d", want, got)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("packet %d was not released", want)
+		}
+	}
+}
@@ -0,0 +1,81 @@
+package jitter
+
+import (
+	"sync"
+	"time"
+
+	"github.com/pion/rtp"
+)
+
+// least interval between two expiries of a releaser
+const minExpireInterval = 10 * time.Millisecond
+
+// Releaser hand the packets of a buffer to handler in order. A timer releases packets
+// held past the latency, so they do not wait for the next packet when the stream pauses
+type Releaser struct {
+	buffer   *Buffer
+	handler  func(pkt *rtp.Packet)
+	closed   chan struct{}
+	isClosed bool
+	mutex    sync.Mutex // handler is called under it, one packet at a time
+}
+
+// NewReleaser start the timer, Close stops it
+func NewReleaser(buffer *Buffer, handler func(pkt *rtp.Packet)) *Releaser {
+	r := &Releaser{
+		buffer:  buffer,
+		handler: handler,
+		closed:  make(chan struct{}),
+	}
+	go r.serve()
+	return r
+}
+
+func (r *Releaser) serve() {
+	interval := r.buffer.GetLatency() / 2
+	if interval < minExpireInterval {
+		interval = minExpireInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-r.closed:
+			return
+		case <-ticker.C:
+			r.mutex.Lock()
+			if !r.isClosed {
+				r.handle(r.buffer.Expire())
+			}
+			r.mutex.Unlock()
+		}
+	}
+}
+
+// Push packet to the buffer and handle the packets it releases
+func (r *Releaser) Push(pkt *rtp.Packet) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if r.isClosed {
+		return
+	}
+	r.handle(r.buffer.Push(pkt))
+}
+
+func (r *Releaser) handle(pkts []*rtp.Packet) {
+	for _, pkt := range pkts {
+		r.handler(pkt)
+	}
+}
+
+// Close stop the timer and handle every waiting packet
+func (r *Releaser) Close() {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if r.isClosed {
+		return
+	}
+	r.isClosed = true
+	close(r.closed)
+	r.handle(r.buffer.Flush())
+}
@@ -0,0 +1,120 @@
+package layout
+
+import (
+	"reflect"
+	"sync"
+)
+
+// Controller keep the layout of a room and recompute regions when layout, participants or dominant speaker change
+type Controller struct {
+	width        int
+	height       int
+	layout       *Layout
+	participants []string                             // join order
+	order        func(participants []string) []string // nil keeps join order
+	dominant     string
+	regions      []*Region
+	handler      func(regions []*Region) // called with regions after every change
+	mutex        sync.Mutex
+}
+
+// NewController start with a grid on a width x height canvas
+func NewController(width, height int, handler func(regions []*Region)) *Controller {
+	return &Controller{
+		width:   width,
+		height:  height,
+		layout:  &Layout{Preset: PresetGrid},
+		handler: handler,
+	}
+}
+
+// GetLayout linter
+func (c *Controller) GetLayout() *Layout {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.layout
+}
+
+// GetRegions last computed regions
+func (c *Controller) GetRegions() []*Region {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.regions
+}
+
+// SetLayout replace the layout, an invalid one is rejected and the current is kept
+func (c *Controller) SetLayout(layout *Layout) error {
+	if err := layout.Validate(c.width, c.height); err != nil {
+		return err
+	}
+
+	c.mutex.Lock()
+	c.layout = layout
+	c.mutex.Unlock()
+	c.update()
+	return nil
+}
+
+// SetOrder place participants in the order returned by order instead of join order,
+// order is called under the lock and must not call back
+func (c *Controller) SetOrder(order func(participants []string) []string) {
+	c.mutex.Lock()
+	c.order = order
+	c.mutex.Unlock()
+	c.update()
+}
+
+// Reorder recompute regions after the order of participants changed
+func (c *Controller) Reorder() {
+	c.update()
+}
+
+// Add participant with video at the end of join order
+func (c *Controller) Add(signalID string) {
+	c.mutex.Lock()
+	for _, id := range c.participants {
+		if id == signalID {
+			c.mutex.Unlock()
+			return
+		}
+	}
+	c.participants = append(c.participants, signalID)
+	c.mutex.Unlock()
+	c.update()
+}
+
+// Remove participant that left
+func (c *Controller) Remove(signalID string) {
+	c.mutex.Lock()
+	c.participants = without(c.participants, signalID)
+	c.mutex.Unlock()
+	c.update()
+}
+
+// SetDominant follow the dominant speaker in speaker and pip presets
+func (c *Controller) SetDominant(signalID string) {
+	c.mutex.Lock()
+	c.dominant = signalID
+	c.mutex.Unlock()
+	c.update()
+}
+
+// update recompute and call handler only when regions changed, in order of changes
+func (c *Controller) update() {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	participants := c.participants
+	if c.order != nil {
+		participants = c.order(participants)
+	}
+	regions := Compute(c.layout, c.width, c.height, participants, c.dominant)
+	if reflect.DeepEqual(regions, c.regions) {
+		return
+	}
+	c.regions = regions
+
+	if c.handler != nil {
+		c.handler(regions)
+	}
+}
@@ -0,0 +1,228 @@
+package layout
+
+import (
+	"fmt"
+	"math"
+)
+
+const (
+	// PresetGrid every video in equal tiles
+	PresetGrid = "grid"
+	// PresetSpeaker focused video large with everyone else in a strip below
+	PresetSpeaker = "speaker"
+	// PresetPiP focused video full canvas with everyone else in small insets
+	PresetPiP = "pip"
+	// PresetCustom only explicit regions are shown
+	PresetCustom = "custom"
+
+	stripRatio = 5  // speaker strip is 1/5 of canvas height
+	insetRatio = 4  // pip insets are 1/4 of canvas size
+	margin     = 16 // gap between pip insets and canvas edge
+)
+
+// Region where a video is drawn on the mixed canvas in pixels, higher Z is drawn on top, zero size is hidden
+type Region struct {
+	SignalID string `json:"signalID" mapstructure:"signalID"`
+	X        int    `json:"x" mapstructure:"x"`
+	Y        int    `json:"y" mapstructure:"y"`
+	Width    int    `json:"width" mapstructure:"width"`
+	Height   int    `json:"height" mapstructure:"height"`
+	Z        int    `json:"z" mapstructure:"z"`
+}
+
+// Layout requested composition of the mixed video
+type Layout struct {
+	Preset  string    `json:"preset" mapstructure:"preset"`
+	Focus   string    `json:"focus" mapstructure:"focus"`     // signalID shown large, empty follows the dominant speaker
+	Regions []*Region `json:"regions" mapstructure:"regions"` // pinned videos, placed on top of the preset
+}
+
+// Validate preset and that every region is inside a width x height canvas
+func (l *Layout) Validate(width, height int) error {
+	switch l.Preset {
+	case PresetGrid, PresetSpeaker, PresetPiP, PresetCustom:
+	default:
+		return fmt.Errorf("Invalid layout preset: %s", l.Preset)
+	}
+
+	for _, region := range l.Regions {
+		if region.SignalID == "" {
+			return fmt.Errorf("Layout region without signalID")
+		}
+		if region.Width <= 0 || region.Height <= 0 ||
+			region.X < 0 || region.Y < 0 ||
+			region.X+region.Width > width || region.Y+region.Height > height {
+			return fmt.Errorf("Layout region of %s is outside %dx%d canvas", region.SignalID, width, height)
+		}
+	}
+	return nil
+}
+
+// Compute regions of participants in join order on a width x height canvas
+func Compute(layout *Layout, width, height int, participants []string, dominant string) []*Region {
+	pinned := make(map[string]*Region)
+	for _, region := range layout.Regions {
+		pinned[region.SignalID] = region
+	}
+
+	// preset places everyone not pinned
+	others := make([]string, 0, len(participants))
+	for _, id := range participants {
+		if _, has := pinned[id]; !has {
+			others = append(others, id)
+		}
+	}
+
+	var regions []*Region
+	switch layout.Preset {
+	case PresetGrid:
+		regions = grid(others, 0, 0, width, height)
+	case PresetSpeaker:
+		regions = speaker(others, focusOf(layout.Focus, dominant, others), width, height)
+	case PresetPiP:
+		regions = pip(others, focusOf(layout.Focus, dominant, others), width, height)
+	}
+
+	// pinned regions of present participants on top
+	top := 0
+	placed := make(map[string]bool)
+	for _, region := range regions {
+		placed[region.SignalID] = true
+		if region.Z >= top {
+			top = region.Z + 1
+		}
+	}
+	for _, id := range participants {
+		if region, has := pinned[id]; has {
+			pin := *region
+			pin.Z += top
+			regions = append(regions, &pin)
+			placed[id] = true
+		}
+	}
+
+	// everyone else is hidden
+	for _, id := range participants {
+		if !placed[id] {
+			regions = append(regions, &Region{SignalID: id})
+		}
+	}
+	return regions
+}
+
+// focusOf pick the requested focus, then the dominant speaker, then the first participant
+func focusOf(focus, dominant string, participants []string) string {
+	for _, candidate := range []string{focus, dominant} {
+		for _, id := range participants {
+			if candidate != "" && id == candidate {
+				return id
+			}
+		}
+	}
+	if len(participants) > 0 {
+		return participants[0]
+	}
+	return ""
+}
+
+// grid tile ids in rows inside a box, an incomplete last row is centered
+func grid(ids []string, x, y, width, height int) []*Region {
+	n := len(ids)
+	if n == 0 {
+		return nil
+	}
+	cols := int(math.Ceil(math.Sqrt(float64(n))))
+	rows := (n + cols - 1) / cols
+	tileWidth, tileHeight := width/cols, height/rows
+
+	regions := make([]*Region, 0, n)
+	for i, id := range ids {
+		row, col := i/cols, i%cols
+		offset := 0
+		if row == rows-1 {
+			offset = (cols - (n - row*cols)) * tileWidth / 2
+		}
+		regions = append(regions, &Region{
+			SignalID: id,
+			X:        x + offset + col*tileWidth,
+			Y:        y + row*tileHeight,
+			Width:    tileWidth,
+			Height:   tileHeight,
+		})
+	}
+	return regions
+}
+
+// strip tile ids in one centered row of fixed size tiles
+func strip(ids []string, y, width, tileWidth, tileHeight, z int) []*Region {
+	if len(ids) == 0 {
+		return nil
+	}
+	if len(ids)*tileWidth > width {
+		tileWidth = width / len(ids)
+	}
+	x := (width - len(ids)*tileWidth) / 2
+
+	regions := make([]*Region, 0, len(ids))
+	for i, id := range ids {
+		regions = append(regions, &Region{
+			SignalID: id,
+			X:        x + i*tileWidth,
+			Y:        y,
+			Width:    tileWidth,
+			Height:   tileHeight,
+			Z:        z,
+		})
+	}
+	return regions
+}
+
+func without(ids []string, exclude string) []string {
+	result := make([]string, 0, len(ids))
+	for _, id := range ids {
+		if id != exclude {
+			result = append(result, id)
+		}
+	}
+	return result
+}
+
+func speaker(ids []string, focus string, width, height int) []*Region {
+	if focus == "" {
+		return nil
+	}
+	others := without(ids, focus)
+	if len(others) == 0 {
+		return []*Region{{SignalID: focus, Width: width, Height: height}}
+	}
+
+	stripHeight := height / stripRatio
+	regions := []*Region{{SignalID: focus, Width: width, Height: height - stripHeight}}
+	return append(regions, strip(others, height-stripHeight, width, width/stripRatio, stripHeight, 0)...)
+}
+
+func pip(ids []string, focus string, width, height int) []*Region {
+	if focus == "" {
+		return nil
+	}
+	regions := []*Region{{SignalID: focus, Width: width, Height: height}}
+
+	// insets from the bottom right corner leftward, as many as fit
+	insetWidth, insetHeight := width/insetRatio, height/insetRatio
+	x := width - margin - insetWidth
+	for _, id := range without(ids, focus) {
+		if x < margin {
+			break
+		}
+		regions = append(regions, &Region{
+			SignalID: id,
+			X:        x,
+			Y:        height - margin - insetHeight,
+			Width:    insetWidth,
+			Height:   insetHeight,
+			Z:        1,
+		})
+		x -= insetWidth + margin
+	}
+	return regions
+}
@@ -0,0 +1,80 @@
+package layout
+
+import (
+	"testing"
+)
+
+func find(regions []*Region, signalID string) *Region {
+	for _, region := range regions {
+		if region.SignalID == signalID {
+			return region
+		}
+	}
+	return nil
+}
+
+func TestGrid(t *testing.T) {
+	regions := Compute(&Layout{Preset: PresetGrid}, 1280, 720, []string{"a", "b", "c"}, "")
+	if len(regions) != 3 {
+		t.Fatalf("got %d regions", len(regions))
+	}
+
+	// 2x2 grid with the last row centered
+	want := map[string]Region{
+		"a": {SignalID: "a", X: 0, Y: 0, Width: 640, Height: 360},
+		"b": {SignalID: "b", X: 640, Y: 0, Width: 640, Height: 360},
+		"c": {SignalID: "c", X: 320, Y: 360, Width: 640, Height: 360},
+	}
+	for id, region := range want {
+		if got := find(regions, id); got == nil || *got != region {
+			t.Fatalf("region of %s is %+v, want %+v", id, got, region)
+		}
+	}
+}
+
+func TestSpeakerFollowDominant(t *testing.T) {
+	participants := []string{"a", "b", "c"}
+	regions := Compute(&Layout{Preset: PresetSpeaker}, 1280, 720, participants, "b")
+	if focus := find(regions, "b"); focus.Width != 1280 || focus.Height != 576 {
+		t.Fatalf("dominant speaker region is %+v", focus)
+	}
+	if other := find(regions, "a"); other.Y != 576 || other.Height != 144 {
+		t.Fatalf("strip region is %+v", other)
+	}
+
+	// focus pin the presenter whoever speaks
+	regions = Compute(&Layout{Preset: PresetSpeaker, Focus: "c"}, 1280, 720, participants, "b")
+	if focus := find(regions, "c"); focus.Height != 576 {
+		t.Fatalf("focus region is %+v", focus)
+	}
+}
+
+func TestPinnedAndHidden(t *testing.T) {
+	data := &Layout{
+		Preset:  PresetPiP,
+		Focus:   "a",
+		Regions: []*Region{{SignalID: "c", X: 10, Y: 10, Width: 100, Height: 100}},
+	}
+	if err := data.Validate(1280, 720); err != nil {
+		t.Fatal(err)
+	}
+	regions := Compute(data, 1280, 720, []string{"a", "b", "c"}, "")
+	if pin := find(regions, "c"); pin.X != 10 || pin.Z != 2 {
+		t.Fatalf("pinned region is %+v", pin)
+	}
+	if inset := find(regions, "b"); inset.Z != 1 || inset.Width != 320 {
+		t.Fatalf("inset region is %+v", inset)
+	}
+
+	// custom only show pinned videos
+	data.Preset = PresetCustom
+	regions = Compute(data, 1280, 720, []string{"a", "b", "c"}, "")
+	if hidden := find(regions, "a"); hidden.Width != 0 {
+		t.Fatalf("unpinned region is %+v", hidden)
+	}
+
+	data.Regions[0].Width = 2000
+	if err := data.Validate(1280, 720); err == nil {
+		t.Fatal("region outside canvas is valid")
+	}
+}
@@ -0,0 +1,273 @@
+package mixer
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/lamhai1401/gologs/logs"
+	"github.com/pion/rtp"
+	"gopkg.in/hraban/opus.v2"
+)
+
+const (
+	audioChannels    = 2
+	audioFrame       = 20 * time.Millisecond
+	audioPayloadType = 111
+	audioClockRate   = 48000 // of opus rtp timestamps whatever the sample rate
+	audioBitrate     = 64000
+	maxOpusBytes     = 1500
+	// prebuffer frames queued before a source is mixed, so jitter does not starve it
+	prebuffer = 2
+	// maxQueue frames queued for a source, older are dropped to bound the delay
+	maxQueue = 10
+)
+
+// Decoder decode opus to interleaved int16 samples
+type Decoder interface {
+	Decode(data []byte, pcm []int16) (int, error)
+}
+
+// Encoder encode interleaved int16 samples to opus
+type Encoder interface {
+	Encode(pcm []int16, data []byte) (int, error)
+}
+
+// codecFuncs make opus decoders for sources and the encoder of the mix
+type codecFuncs struct {
+	newDecoder func(sampleRate, channels int) (Decoder, error)
+	newEncoder func(sampleRate, channels int) (Encoder, error)
+}
+
+var opusCodec = codecFuncs{
+	newDecoder: func(sampleRate, channels int) (Decoder, error) {
+		return opus.NewDecoder(sampleRate, channels)
+	},
+	newEncoder: func(sampleRate, channels int) (Encoder, error) {
+		encoder, err := opus.NewEncoder(sampleRate, channels, opus.AppVoIP)
+		if err != nil {
+			return nil, err
+		}
+		if err := encoder.SetBitrate(audioBitrate); err != nil {
+			return nil, err
+		}
+		return encoder, nil
+	},
+}
+
+// audioSource decoded audio of a participant waiting to be mixed
+type audioSource struct {
+	decoder   Decoder
+	queue     []int16
+	buffering bool
+}
+
+// AudioMixer decode, sum and encode opus without any video pipeline.
+// Video pushed to it is dropped
+type AudioMixer struct {
+	sampleRate int
+	inputs     int
+	codec      codecFuncs
+	encoder    Encoder
+	sources    map[string]*audioSource
+	decoded    []int16
+	sum        []int32 // a frame of every channel
+	frame      []int16
+	data       []byte
+	header     rtp.Header
+	video      chan *rtp.Packet
+	audio      chan *rtp.Packet
+	closed     chan struct{}
+	closeOnce  sync.Once
+	mutex      sync.Mutex
+}
+
+// NewAudioMixer mix up to config inputs at config sample rate
+func NewAudioMixer(config *Config) (*AudioMixer, error) {
+	return newAudioMixer(config, opusCodec)
+}
+
+func newAudioMixer(config *Config, codec codecFuncs) (*AudioMixer, error) {
+	encoder, err := codec.newEncoder(config.SampleRate, audioChannels)
+	if err != nil {
+		return nil, fmt.Errorf("New opus encoder err: %v", err)
+	}
+
+	frameSamples := int(int64(config.SampleRate) * int64(audioFrame) / int64(time.Second))
+	return &AudioMixer{
+		sampleRate: config.SampleRate,
+		inputs:     config.Inputs,
+		codec:      codec,
+		encoder:    encoder,
+		sources:    make(map[string]*audioSource),
+		// the longest opus packet is 120ms
+		decoded: make([]int16, 6*frameSamples*audioChannels),
+		sum:     make([]int32, frameSamples*audioChannels),
+		frame:   make([]int16, frameSamples*audioChannels),
+		data:    make([]byte, maxOpusBytes),
+		header: rtp.Header{
+			Version:        2,
+			PayloadType:    audioPayloadType,
+			SequenceNumber: uint16(rand.Uint32()),
+			Timestamp:      rand.Uint32(),
+			SSRC:           rand.Uint32(),
+		},
+		video:  make(chan *rtp.Packet, outputSize),
+		audio:  make(chan *rtp.Packet, outputSize),
+		closed: make(chan struct{}),
+	}, nil
+}
+
+// Start mixing a frame every 20ms
+func (m *AudioMixer) Start() error {
+	go m.serve()
+	return nil
+}
+
+func (m *AudioMixer) serve() {
+	ticker := time.NewTicker(audioFrame)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-m.closed:
+			return
+		case <-ticker.C:
+			m.tick()
+		}
+	}
+}
+
+func (m *AudioMixer) tick() {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	// outputs are closed under mutex
+	select {
+	case <-m.closed:
+		return
+	default:
+	}
+
+	pkt, err := m.mix()
+	if err != nil {
+		logs.Error("Mix audio err: ", err.Error())
+		return
+	}
+	send(m.audio, pkt)
+}
+
+// mix a frame of every source having audio, mutex must be held
+func (m *AudioMixer) mix() (*rtp.Packet, error) {
+	for i := range m.sum {
+		m.sum[i] = 0
+	}
+
+	size := len(m.sum)
+	for _, source := range m.sources {
+		if source.buffering {
+			if len(source.queue) < prebuffer*size {
+				continue
+			}
+			source.buffering = false
+		}
+		if len(source.queue) < size {
+			// starved, wait for a few frames again
+			source.buffering = true
+			continue
+		}
+		for i, s := range source.queue[:size] {
+			m.sum[i] += int32(s)
+		}
+		source.queue = source.queue[size:]
+	}
+
+	for i, s := range m.sum {
+		switch {
+		case s > math.MaxInt16:
+			m.frame[i] = math.MaxInt16
+		case s < math.MinInt16:
+			m.frame[i] = math.MinInt16
+		default:
+			m.frame[i] = int16(s)
+		}
+	}
+
+	n, err := m.encoder.Encode(m.frame, m.data)
+	if err != nil {
+		return nil, fmt.Errorf("Encode opus err: %v", err)
+	}
+
+	pkt := &rtp.Packet{
+		Header:  m.header,
+		Payload: append([]byte{}, m.data[:n]...),
+	}
+	m.header.SequenceNumber++
+	m.header.Timestamp += uint32(audioClockRate * audioFrame / time.Second)
+	return pkt, nil
+}
+
+// PushVideoStream dropped, there is no video to mix
+func (m *AudioMixer) PushVideoStream(id string, pkt *rtp.Packet) {}
+
+// RemoveVideoStream linter
+func (m *AudioMixer) RemoveVideoStream(id string) {}
+
+// PushAudioStream decode pkt into the queue of id, sources over the inputs are dropped
+func (m *AudioMixer) PushAudioStream(id string, pkt *rtp.Packet) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	source, has := m.sources[id]
+	if !has {
+		if len(m.sources) >= m.inputs {
+			return
+		}
+		decoder, err := m.codec.newDecoder(m.sampleRate, audioChannels)
+		if err != nil {
+			logs.Error(fmt.Sprintf("New opus decoder of %s err: %v", id, err))
+			return
+		}
+		source = &audioSource{decoder: decoder, buffering: true}
+		m.sources[id] = source
+	}
+
+	n, err := source.decoder.Decode(pkt.Payload, m.decoded)
+	if err != nil {
+		logs.Warn(fmt.Sprintf("Decode opus of %s err: %v", id, err))
+		return
+	}
+	source.queue = append(source.queue, m.decoded[:n*audioChannels]...)
+	if max := maxQueue * len(m.sum); len(source.queue) > max {
+		source.queue = append(source.queue[:0], source.queue[len(source.queue)-max:]...)
+	}
+}
+
+// RemoveAudioStream linter
+func (m *AudioMixer) RemoveAudioStream(id string) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	delete(m.sources, id)
+}
+
+// GetMixedVideo never written
+func (m *AudioMixer) GetMixedVideo() chan *rtp.Packet {
+	return m.video
+}
+
+// GetMixedAudio linter
+func (m *AudioMixer) GetMixedAudio() chan *rtp.Packet {
+	return m.audio
+}
+
+// Close stop mixing and close the outputs
+func (m *AudioMixer) Close() {
+	m.closeOnce.Do(func() {
+		close(m.closed)
+		m.mutex.Lock()
+		defer m.mutex.Unlock()
+		close(m.video)
+		close(m.audio)
+	})
+}
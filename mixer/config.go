@@ -0,0 +1,266 @@
+package mixer
+
+import (
+	"fmt"
+	"io/ioutil"
+	"strconv"
+	"strings"
+
+	"github.com/lamhai1401/gologs/logs"
+	"github.com/lamhai1401/testrtc/utils"
+)
+
+const (
+	// DefaultRoom config of rooms without their own
+	DefaultRoom = "default"
+	// DefaultRendition name of the only rendition of a config without renditions
+	DefaultRendition = "main"
+
+	maxInputs  = 64
+	maxWidth   = 3840
+	maxHeight  = 2160
+	maxFPS     = 60
+	minBitrate = 100
+	maxBitrate = 20000
+
+	// every rendition runs its own mixer decoding all inputs, so they cost as many full mixes
+	maxRenditions = 4
+)
+
+// Config how a room is mixed
+type Config struct {
+	Backend    string `json:"backend"`    // v2, passthrough or audio
+	Inputs     int    `json:"inputs"`     // most streams mixed at once
+	StreamID   string `json:"streamID"`   // id of the mixed stream
+	Width      int    `json:"width"`      // of mixed video
+	Height     int    `json:"height"`     // of mixed video
+	FrameRate  int    `json:"frameRate"`  // of mixed video
+	Bitrate    int    `json:"bitrate"`    // of mixed video in kbps
+	SampleRate int    `json:"sampleRate"` // of mixed audio
+	Video      bool   `json:"video"`      // mix video of participants
+	Audio      bool   `json:"audio"`      // mix audio of participants
+	// Renditions bitrates of the mixed video, the first is the output every other
+	// consumer gets. Empty is one encoding at Bitrate
+	Renditions []Rendition `json:"renditions"`
+}
+
+// Rendition an encoding of the mixed video for viewers of a given bandwidth. mixer-v2 only
+// sets the bitrate of its output, so every rendition has the resolution of the config
+type Rendition struct {
+	Name    string `json:"name"`
+	Bitrate int    `json:"bitrate"` // kbps
+}
+
+// ParseRenditions read name=kbps pairs split by comma, such as hd=1500,sd=400
+func ParseRenditions(raw string) ([]Rendition, error) {
+	var renditions []Rendition
+	for _, pair := range strings.Split(raw, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+
+		kv := strings.SplitN(pair, "=", 2)
+		if len(kv) != 2 {
+			return nil, fmt.Errorf("Invalid rendition %s, want name=kbps", pair)
+		}
+		bitrate, err := strconv.Atoi(kv[1])
+		if err != nil {
+			return nil, fmt.Errorf("Invalid bitrate of rendition %s: %v", kv[0], err)
+		}
+		renditions = append(renditions, Rendition{Name: kv[0], Bitrate: bitrate})
+	}
+	return renditions, nil
+}
+
+// DefaultConfig config from env
+func DefaultConfig() *Config {
+	renditions, err := ParseRenditions(utils.GetMixerRenditions())
+	if err != nil {
+		logs.Error("Get mixer renditions err: ", err.Error())
+	}
+	config := &Config{
+		Backend:    utils.GetMixerBackend(),
+		Inputs:     utils.GetMixerLength(),
+		StreamID:   utils.GetMixerStreamID(),
+		Width:      utils.GetMixerWidth(),
+		Height:     utils.GetMixerHeight(),
+		FrameRate:  utils.GetMixerFrameRate(),
+		Bitrate:    utils.GetMixerBitrate(),
+		SampleRate: utils.GetMixerSampleRate(),
+		Video:      utils.IsMixerVideo(),
+		Audio:      utils.IsMixerAudio(),
+		Renditions: renditions,
+	}
+	fixV2(config)
+	return config
+}
+
+// Validate every value can be given to a mixer
+func (c *Config) Validate() error {
+	switch c.Backend {
+	case BackendV2, BackendPassThrough:
+	case BackendAudio:
+		if c.Video {
+			return fmt.Errorf("Audio mixer can not mix video")
+		}
+	default:
+		return fmt.Errorf("Unknown mixer backend: %s", c.Backend)
+	}
+
+	if c.Inputs < 1 || c.Inputs > maxInputs {
+		return fmt.Errorf("Mixer inputs %d is outside 1 to %d", c.Inputs, maxInputs)
+	}
+	if c.StreamID == "" {
+		return fmt.Errorf("Missing mixer stream ID")
+	}
+	if !c.Video && !c.Audio {
+		return fmt.Errorf("Mixer must mix video, audio or both")
+	}
+
+	if c.Video {
+		if err := validateEncoding(c.Width, c.Height, c.Bitrate); err != nil {
+			return err
+		}
+		if c.FrameRate < 1 || c.FrameRate > maxFPS {
+			return fmt.Errorf("Mixer frame rate %d is outside 1 to %d", c.FrameRate, maxFPS)
+		}
+	}
+
+	if len(c.Renditions) > 0 {
+		// only mixers encoding video themselves can encode it several times
+		if c.Backend != BackendV2 || !c.Video {
+			return fmt.Errorf("Renditions need the %s backend mixing video", BackendV2)
+		}
+		if len(c.Renditions) > maxRenditions {
+			return fmt.Errorf("Mixer has %d renditions, at most %d", len(c.Renditions), maxRenditions)
+		}
+		names := make(map[string]bool, len(c.Renditions))
+		for _, r := range c.Renditions {
+			if r.Name == "" || names[r.Name] {
+				return fmt.Errorf("Rendition name %q is empty or used twice", r.Name)
+			}
+			names[r.Name] = true
+			if r.Bitrate < minBitrate || r.Bitrate > maxBitrate {
+				return fmt.Errorf("Bitrate of rendition %s %d kbps is outside %d to %d", r.Name, r.Bitrate, minBitrate, maxBitrate)
+			}
+		}
+	}
+
+	if c.Audio {
+		switch c.SampleRate {
+		case 8000, 12000, 16000, 24000, 48000:
+		default:
+			return fmt.Errorf("Unsupported mixer sample rate %d", c.SampleRate)
+		}
+	}
+
+	if c.Backend == BackendV2 {
+		return validateV2(c)
+	}
+	return nil
+}
+
+func validateEncoding(width, height, bitrate int) error {
+	if width <= 0 || height <= 0 || width > maxWidth || height > maxHeight || width%2 != 0 || height%2 != 0 {
+		return fmt.Errorf("Invalid mixer resolution %dx%d, must be even and up to %dx%d", width, height, maxWidth, maxHeight)
+	}
+	if bitrate < minBitrate || bitrate > maxBitrate {
+		return fmt.Errorf("Mixer bitrate %d kbps is outside %d to %d", bitrate, minBitrate, maxBitrate)
+	}
+	return nil
+}
+
+// GetRenditions renditions of the mixed video, the one of the config itself without any
+func (c *Config) GetRenditions() []Rendition {
+	if len(c.Renditions) > 0 {
+		return c.Renditions
+	}
+	return []Rendition{{
+		Name:    DefaultRendition,
+		Bitrate: c.Bitrate,
+	}}
+}
+
+// Configs mixer config of each room
+type Configs map[string]*Config
+
+// LoadConfigs read a json object of room - config. Values missing in a room are taken from
+// its default entry then from env, every config is validated
+func LoadConfigs(path string) (Configs, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var raw map[string]interface{}
+	if err := utils.ToJSON(data, &raw); err != nil {
+		return nil, fmt.Errorf("Parse mixer configs %s err: %v", path, err)
+	}
+
+	// rooms start from the default entry, which starts from env
+	base := DefaultConfig()
+	if value, has := raw[DefaultRoom]; has {
+		if err := override(base, value); err != nil {
+			return nil, fmt.Errorf("Invalid mixer config of %s: %v", DefaultRoom, err)
+		}
+	}
+
+	configs := Configs{DefaultRoom: base}
+	for room, value := range raw {
+		if room == DefaultRoom {
+			continue
+		}
+		// renditions of a room replace the default ones instead of merging into them
+		config := *base
+		config.Renditions = nil
+		if err := override(&config, value); err != nil {
+			return nil, fmt.Errorf("Invalid mixer config of %s: %v", room, err)
+		}
+		if config.Renditions == nil {
+			config.Renditions = append([]Rendition(nil), base.Renditions...)
+		}
+		configs[room] = &config
+	}
+
+	for room, config := range configs {
+		fixV2(config)
+		if err := config.Validate(); err != nil {
+			return nil, fmt.Errorf("Invalid mixer config of %s: %v", room, err)
+		}
+	}
+	return configs, nil
+}
+
+// RoomConfig config of room in the MIXERCONFIG file, the one from env without a file
+func RoomConfig(room string) (*Config, error) {
+	path := utils.GetMixerConfig()
+	if path == "" {
+		return DefaultConfig(), nil
+	}
+	configs, err := LoadConfigs(path)
+	if err != nil {
+		return nil, err
+	}
+	return configs.Get(room), nil
+}
+
+// override set fields of config present in value
+func override(config *Config, value interface{}) error {
+	data, err := utils.ToByte(value)
+	if err != nil {
+		return err
+	}
+	return utils.ToJSON(data, config)
+}
+
+// Get config of room, or the default one
+func (c Configs) Get(room string) *Config {
+	if config, has := c[room]; has {
+		return config
+	}
+	if config, has := c[DefaultRoom]; has {
+		return config
+	}
+	return DefaultConfig()
+}
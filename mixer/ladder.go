@@ -0,0 +1,144 @@
+package mixer
+
+import (
+	"fmt"
+
+	"github.com/lamhai1401/gologs/logs"
+	"github.com/pion/rtp"
+)
+
+// Ladder a mixer encoding the mixed video once per rendition,
+// GetMixedVideo is the output of the first one
+type Ladder interface {
+	Mixer
+	GetRenditions() []Rendition
+	// GetRenditionVideo output of rendition name, nil if there is none
+	GetRenditionVideo(name string) chan *rtp.Packet
+	// RequestKeyframe of rendition name, for a viewer switching to it
+	RequestKeyframe(name string)
+}
+
+// ladder run a mixer-v2 per rendition and push every input to all of them. mixer-v2 has
+// no way to encode its composition several times, so each rendition decodes and composes
+// every input again, which Validate bounds with maxRenditions. Audio is the same whatever
+// the rendition, so only the first one mixes it
+type ladder struct {
+	renditions []Rendition
+	mixers     []*v2Mixer // by rendition
+}
+
+// newLadder build every mixer, it can not fail so none is left running
+func newLadder(config *Config) Mixer {
+	l := &ladder{
+		renditions: config.Renditions,
+	}
+
+	for i, r := range config.Renditions {
+		c := *config
+		c.Renditions = nil
+		c.Bitrate = r.Bitrate
+		c.StreamID = config.StreamID + "_" + r.Name
+		c.Audio = config.Audio && i == 0
+
+		l.mixers = append(l.mixers, newV2(&c))
+	}
+	return l
+}
+
+// Start every mixer
+func (l *ladder) Start() error {
+	for _, m := range l.mixers {
+		if err := m.Start(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// PushVideoStream give every mixer its own copy, mixer-v2 may change the packets it is given
+func (l *ladder) PushVideoStream(id string, pkt *rtp.Packet) {
+	copies := make([]*rtp.Packet, len(l.mixers))
+	copies[0] = pkt
+	for i := 1; i < len(l.mixers); i++ {
+		copied, err := clone(pkt)
+		if err != nil {
+			logs.Warn(fmt.Sprintf("Copy video of %s err: %v", id, err))
+			return
+		}
+		copies[i] = copied
+	}
+	for i, m := range l.mixers {
+		m.PushVideoStream(id, copies[i])
+	}
+}
+
+// PushAudioStream linter
+func (l *ladder) PushAudioStream(id string, pkt *rtp.Packet) {
+	l.mixers[0].PushAudioStream(id, pkt)
+}
+
+// RemoveVideoStream linter
+func (l *ladder) RemoveVideoStream(id string) {
+	for _, m := range l.mixers {
+		m.RemoveVideoStream(id)
+	}
+}
+
+// RemoveAudioStream linter
+func (l *ladder) RemoveAudioStream(id string) {
+	l.mixers[0].RemoveAudioStream(id)
+}
+
+// GetMixedVideo output of the first rendition
+func (l *ladder) GetMixedVideo() chan *rtp.Packet {
+	return l.mixers[0].GetMixedVideo()
+}
+
+// GetMixedAudio linter
+func (l *ladder) GetMixedAudio() chan *rtp.Packet {
+	return l.mixers[0].GetMixedAudio()
+}
+
+// GetRenditions linter
+func (l *ladder) GetRenditions() []Rendition {
+	return l.renditions
+}
+
+// GetRenditionVideo linter
+func (l *ladder) GetRenditionVideo(name string) chan *rtp.Packet {
+	for i, r := range l.renditions {
+		if r.Name == name {
+			return l.mixers[i].GetMixedVideo()
+		}
+	}
+	return nil
+}
+
+// RequestKeyframe linter
+func (l *ladder) RequestKeyframe(name string) {
+	for i, r := range l.renditions {
+		if r.Name == name {
+			l.mixers[i].RequestKeyframe()
+		}
+	}
+}
+
+// Close every mixer
+func (l *ladder) Close() {
+	for _, m := range l.mixers {
+		m.Close()
+	}
+}
+
+// clone pkt with nothing shared, header extensions included
+func clone(pkt *rtp.Packet) (*rtp.Packet, error) {
+	raw, err := pkt.Marshal()
+	if err != nil {
+		return nil, err
+	}
+	copied := &rtp.Packet{}
+	if err := copied.Unmarshal(raw); err != nil {
+		return nil, err
+	}
+	return copied, nil
+}
@@ -0,0 +1,76 @@
+package mixer
+
+import (
+	"fmt"
+	"image"
+
+	"github.com/pion/rtp"
+)
+
+const (
+	// BackendV2 compose video and audio with mixer-v2
+	BackendV2 = "v2"
+	// BackendPassThrough forward one selected participant as it is
+	BackendPassThrough = "passthrough"
+	// BackendAudio mix opus audio only
+	BackendAudio = "audio"
+
+	// outputSize packets buffered for each output, more are dropped
+	outputSize = 100
+)
+
+// Mixer mix streams of the participants of a room into one video and one audio output
+type Mixer interface {
+	Start() error
+	PushVideoStream(id string, pkt *rtp.Packet)
+	PushAudioStream(id string, pkt *rtp.Packet)
+	RemoveVideoStream(id string)
+	RemoveAudioStream(id string)
+	// GetMixedVideo output channel, never written by mixers without video
+	GetMixedVideo() chan *rtp.Packet
+	GetMixedAudio() chan *rtp.Packet
+	Close()
+}
+
+// Placer a mixer placing every video by region itself, mixers without it keep their own composition
+type Placer interface {
+	SetVideoRegion(id string, rect image.Rectangle, z int) error
+}
+
+// KeyframeRequester a mixer able to encode its next video frame as a keyframe
+type KeyframeRequester interface {
+	RequestKeyframe()
+}
+
+// Selector a mixer forwarding one participant at a time
+type Selector interface {
+	// Select signalID to forward, empty forwards the first one pushing
+	Select(signalID string)
+	// GetSelected participant being forwarded, empty when none
+	GetSelected() string
+}
+
+// New start the backend of config
+func New(config *Config) (Mixer, error) {
+	switch config.Backend {
+	case BackendV2:
+		if len(config.Renditions) > 0 {
+			return newLadder(config), nil
+		}
+		return newV2(config), nil
+	case BackendPassThrough:
+		return NewPassThrough(), nil
+	case BackendAudio:
+		return NewAudioMixer(config)
+	default:
+		return nil, fmt.Errorf("Unknown mixer backend: %s", config.Backend)
+	}
+}
+
+// send pkt to out without blocking the participant pushing it
+func send(out chan *rtp.Packet, pkt *rtp.Packet) {
+	select {
+	case out <- pkt:
+	default:
+	}
+}
@@ -0,0 +1,220 @@
+package mixer
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/pion/rtp"
+)
+
+func writeConfigs(t *testing.T, content string) string {
+	dir, err := ioutil.TempDir("", "mixer")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	path := filepath.Join(dir, "mixer.json")
+	if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadConfigs(t *testing.T) {
+	path := writeConfigs(t, `{
+		"default": {"bitrate": 2000},
+		"small": {"inputs": 4, "streamID": "small"},
+		"podcast": {"video": false}
+	}`)
+	configs, err := LoadConfigs(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	small := configs.Get("small")
+	if small.Inputs != 4 || small.StreamID != "small" || small.Bitrate != 2000 || small.Width != DefaultConfig().Width {
+		t.Fatalf("unexpected small config %+v", small)
+	}
+	if podcast := configs.Get("podcast"); podcast.Video || !podcast.Audio {
+		t.Fatalf("unexpected podcast config %+v", podcast)
+	}
+	if other := configs.Get("other"); other.Bitrate != 2000 || other.Inputs != DefaultConfig().Inputs {
+		t.Fatalf("room without config should get default %+v", other)
+	}
+}
+
+func TestLoadConfigsInvalid(t *testing.T) {
+	for _, content := range []string{
+		`{"big": {"inputs": 1000}}`,
+		`{"odd": {"backend": "passthrough", "width": 641}}`,
+		`{"smooth": {"backend": "passthrough", "frameRate": 90}}`,
+		`{"mute": {"video": false, "audio": false}}`,
+		`{"radio": {"backend": "audio", "video": false, "sampleRate": 44100}}`,
+		`{"broken": {"inputs": "four"}}`,
+		`{"podcast": {"backend": "audio"}}`,
+		`{"other": {"backend": "gstreamer"}}`,
+		`{"same": {"renditions": [{"name": "sd", "bitrate": 400}, {"name": "sd", "bitrate": 200}]}}`,
+		`{"forward": {"backend": "passthrough", "renditions": [{"name": "sd", "bitrate": 400}]}}`,
+		`{"many": {"renditions": [{"name": "a", "bitrate": 400}, {"name": "b", "bitrate": 500}, {"name": "c", "bitrate": 600}, {"name": "d", "bitrate": 700}, {"name": "e", "bitrate": 800}]}}`,
+	} {
+		if _, err := LoadConfigs(writeConfigs(t, content)); err == nil {
+			t.Fatalf("%s should be refused", content)
+		}
+	}
+}
+
+func TestLoadConfigsFixV2Format(t *testing.T) {
+	path := writeConfigs(t, `{
+		"small": {"width": 640, "height": 360, "frameRate": 15, "sampleRate": 16000},
+		"forward": {"backend": "passthrough", "width": 640, "height": 360}
+	}`)
+	configs, err := LoadConfigs(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if small := configs.Get("small"); small.Width != v2Width || small.Height != v2Height || small.FrameRate != v2FrameRate || small.SampleRate != v2SampleRate {
+		t.Fatalf("mixer-v2 format should be kept, got %+v", small)
+	}
+	if forward := configs.Get("forward"); forward.Width != 640 || forward.Height != 360 {
+		t.Fatalf("passthrough format should be the configured one, got %+v", forward)
+	}
+}
+
+func TestRenditions(t *testing.T) {
+	renditions, err := ParseRenditions("hd=1500, sd=400")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(renditions) != 2 || renditions[1] != (Rendition{Name: "sd", Bitrate: 400}) {
+		t.Fatalf("unexpected renditions %+v", renditions)
+	}
+	if _, err := ParseRenditions("sd"); err == nil {
+		t.Fatal("rendition without bitrate should be refused")
+	}
+
+	path := writeConfigs(t, `{
+		"default": {"renditions": [{"name": "hd", "bitrate": 1500}]},
+		"mobile": {"renditions": [{"name": "sd", "bitrate": 400}]},
+		"other": {"inputs": 4}
+	}`)
+	configs, err := LoadConfigs(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := configs.Get("mobile").GetRenditions(); len(got) != 1 || got[0].Name != "sd" {
+		t.Fatalf("mobile renditions %+v", got)
+	}
+	if got := configs.Get("other").GetRenditions(); len(got) != 1 || got[0].Name != "hd" {
+		t.Fatalf("renditions of default should be kept, got %+v", got)
+	}
+	if got := configs.Get(DefaultRoom).GetRenditions(); got[0].Name != "hd" || got[0].Bitrate != 1500 {
+		t.Fatalf("default renditions were changed by a room: %+v", got)
+	}
+}
+
+func vp8Packet(ssrc uint32, seq uint16, ts uint32, keyframe bool) *rtp.Packet {
+	// descriptor with S set, then the frame tag whose low bit is 0 for keyframes
+	tag := byte(0x01)
+	if keyframe {
+		tag = 0x00
+	}
+	return &rtp.Packet{
+		Header:  rtp.Header{SSRC: ssrc, SequenceNumber: seq, Timestamp: ts},
+		Payload: []byte{0x10, tag, 0, 0},
+	}
+}
+
+func TestPassThroughSwitch(t *testing.T) {
+	p := NewPassThrough()
+	defer p.Close()
+
+	p.PushVideoStream("a", vp8Packet(1, 100, 1000, false))
+	p.PushVideoStream("a", vp8Packet(1, 101, 1000, true))
+	p.PushVideoStream("b", vp8Packet(2, 500, 9000, true))
+	first := <-p.GetMixedVideo()
+	if first.SequenceNumber != 101 || len(p.GetMixedVideo()) != 0 {
+		t.Fatal("first pushing should be forwarded from its keyframe")
+	}
+
+	// b is forwarded from its next keyframe, continuing a's numbering
+	p.Select("b")
+	p.PushVideoStream("b", vp8Packet(2, 501, 12000, false))
+	p.PushVideoStream("b", vp8Packet(2, 502, 15000, true))
+	second := <-p.GetMixedVideo()
+	if second.SSRC != first.SSRC || second.SequenceNumber != 102 || second.Timestamp != 1000+videoStep {
+		t.Fatalf("unexpected switched packet %+v", second.Header)
+	}
+}
+
+func TestCloneShareNothing(t *testing.T) {
+	pkt := vp8Packet(1, 100, 1000, true)
+	pkt.Version = 2
+	pkt.Marker = true
+	if err := pkt.SetExtension(1, []byte{7}); err != nil {
+		t.Fatal(err)
+	}
+	copied, err := clone(pkt)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	copied.Payload[1] = 0xff
+	copied.SetExtension(1, []byte{9})
+	if pkt.Payload[1] == 0xff || pkt.GetExtension(1)[0] != 7 {
+		t.Fatal("changing the copy changed the packet")
+	}
+	if copied.SequenceNumber != pkt.SequenceNumber || copied.Timestamp != pkt.Timestamp || !copied.Marker {
+		t.Fatalf("unexpected copy %+v", copied.Header)
+	}
+}
+
+type fakeDecoder struct{}
+
+// Decode a 20ms stereo frame at 48kHz of the payload first byte
+func (fakeDecoder) Decode(data []byte, pcm []int16) (int, error) {
+	for i := 0; i < 1920; i++ {
+		pcm[i] = int16(data[0]) * 100
+	}
+	return 960, nil
+}
+
+type fakeEncoder struct{ last []int16 }
+
+func (e *fakeEncoder) Encode(pcm []int16, data []byte) (int, error) {
+	e.last = append(e.last[:0], pcm...)
+	return 1, nil
+}
+
+func TestAudioMixerSum(t *testing.T) {
+	encoder := &fakeEncoder{}
+	config := DefaultConfig()
+	config.Inputs = 2
+	m, err := newAudioMixer(config, codecFuncs{
+		newDecoder: func(sampleRate, channels int) (Decoder, error) { return fakeDecoder{}, nil },
+		newEncoder: func(sampleRate, channels int) (Encoder, error) { return encoder, nil },
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < prebuffer; i++ {
+		m.PushAudioStream("a", &rtp.Packet{Payload: []byte{1}})
+		m.PushAudioStream("b", &rtp.Packet{Payload: []byte{2}})
+		m.PushAudioStream("c", &rtp.Packet{Payload: []byte{3}})
+	}
+	pkt, err := m.mix()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if encoder.last[0] != 300 {
+		t.Fatalf("mixed sample %d, want 300 from the first two inputs", encoder.last[0])
+	}
+
+	next, _ := m.mix()
+	if next.SequenceNumber != pkt.SequenceNumber+1 || next.Timestamp != pkt.Timestamp+960 {
+		t.Fatal("mixed packets should follow each other")
+	}
+}
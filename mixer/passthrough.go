@@ -0,0 +1,205 @@
+package mixer
+
+import (
+	"math/rand"
+	"sync"
+
+	"github.com/lamhai1401/testrtc/codec"
+	"github.com/pion/rtp"
+)
+
+const (
+	// gap left in timestamps when the forwarded participant changes
+	videoStep = 90000 / 30
+	audioStep = 48000 / 50
+)
+
+// Rewriter give packets of changing sources one continuous ssrc, sequence and timestamp
+type Rewriter struct {
+	ssrc      uint32
+	step      uint32
+	source    uint32 // ssrc of current source
+	seqOffset uint16
+	tsOffset  uint32
+	lastSeq   uint16
+	lastTS    uint32
+	started   bool // a source was forwarded
+	switched  bool // offsets are set for current source
+}
+
+// NewRewriter step is the timestamp gap left when the source changes
+func NewRewriter(step uint32) *Rewriter {
+	return &Rewriter{
+		ssrc: rand.Uint32(),
+		step: step,
+	}
+}
+
+// SetStep timestamp gap left at the next source change
+func (r *Rewriter) SetStep(step uint32) {
+	r.step = step
+}
+
+// Reset continue output from the next packet of any source
+func (r *Rewriter) Reset() {
+	r.switched = false
+}
+
+// Rewrite pkt of the current source, a packet of another source makes it current
+func (r *Rewriter) Rewrite(pkt *rtp.Packet) *rtp.Packet {
+	if !r.switched || pkt.SSRC != r.source {
+		r.source = pkt.SSRC
+		r.switched = true
+		if r.started {
+			r.seqOffset = r.lastSeq + 1 - pkt.SequenceNumber
+			r.tsOffset = r.lastTS + r.step - pkt.Timestamp
+		} else {
+			r.seqOffset, r.tsOffset = 0, 0
+		}
+	}
+
+	out := &rtp.Packet{
+		Header:  pkt.Header,
+		Payload: pkt.Payload,
+	}
+	out.SSRC = r.ssrc
+	out.SequenceNumber = pkt.SequenceNumber + r.seqOffset
+	out.Timestamp = pkt.Timestamp + r.tsOffset
+
+	r.started = true
+	r.lastSeq, r.lastTS = out.SequenceNumber, out.Timestamp
+	return out
+}
+
+// PassThrough forward the audio and video of one participant without decoding them,
+// only headers are rewritten so the output stays one stream when the participant changes
+type PassThrough struct {
+	selected     string
+	pinned       bool // selected by Select, not the first one pushing
+	video        chan *rtp.Packet
+	audio        chan *rtp.Packet
+	videoOut     *Rewriter
+	audioOut     *Rewriter
+	waitKeyframe bool // video of a new participant starts at a vp8 keyframe
+	closed       bool
+	mutex        sync.Mutex
+}
+
+// NewPassThrough linter
+func NewPassThrough() *PassThrough {
+	return &PassThrough{
+		video:        make(chan *rtp.Packet, outputSize),
+		audio:        make(chan *rtp.Packet, outputSize),
+		videoOut:     NewRewriter(videoStep),
+		audioOut:     NewRewriter(audioStep),
+		waitKeyframe: true,
+	}
+}
+
+// Start nothing, packets are forwarded as they are pushed
+func (p *PassThrough) Start() error {
+	return nil
+}
+
+// Select signalID to forward, empty forwards the first one pushing
+func (p *PassThrough) Select(signalID string) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.pinned = signalID != ""
+	if p.selected == signalID {
+		return
+	}
+	p.selected = signalID
+	p.videoOut.Reset()
+	p.audioOut.Reset()
+	p.waitKeyframe = true
+}
+
+// GetSelected participant being forwarded
+func (p *PassThrough) GetSelected() string {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	return p.selected
+}
+
+// forward check id is forwarded, the first pushing is picked when none is
+func (p *PassThrough) forward(id string) bool {
+	if p.closed {
+		return false
+	}
+	if p.selected == "" {
+		p.selected = id
+	}
+	return p.selected == id
+}
+
+// PushVideoStream linter
+func (p *PassThrough) PushVideoStream(id string, pkt *rtp.Packet) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	if !p.forward(id) {
+		return
+	}
+	if p.waitKeyframe {
+		if !codec.IsVP8Keyframe(pkt.Payload) {
+			return
+		}
+		p.waitKeyframe = false
+	}
+	send(p.video, p.videoOut.Rewrite(pkt))
+}
+
+// PushAudioStream linter
+func (p *PassThrough) PushAudioStream(id string, pkt *rtp.Packet) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	if !p.forward(id) {
+		return
+	}
+	send(p.audio, p.audioOut.Rewrite(pkt))
+}
+
+// RemoveVideoStream video of id starts again at a keyframe
+func (p *PassThrough) RemoveVideoStream(id string) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	if p.selected == id {
+		p.videoOut.Reset()
+		p.waitKeyframe = true
+	}
+}
+
+// RemoveAudioStream a participant picked for pushing first hand over to the next one pushing,
+// one picked by Select stays until another is
+func (p *PassThrough) RemoveAudioStream(id string) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	if p.selected == id && !p.pinned {
+		p.selected = ""
+		p.videoOut.Reset()
+		p.audioOut.Reset()
+		p.waitKeyframe = true
+	}
+}
+
+// GetMixedVideo linter
+func (p *PassThrough) GetMixedVideo() chan *rtp.Packet {
+	return p.video
+}
+
+// GetMixedAudio linter
+func (p *PassThrough) GetMixedAudio() chan *rtp.Packet {
+	return p.audio
+}
+
+// Close the outputs
+func (p *PassThrough) Close() {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	if p.closed {
+		return
+	}
+	p.closed = true
+	close(p.video)
+	close(p.audio)
+}
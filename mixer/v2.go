@@ -0,0 +1,63 @@
+package mixer
+
+import (
+	"fmt"
+
+	v2 "github.com/beowulflab/mixer-v2/v2"
+	"github.com/lamhai1401/gologs/logs"
+)
+
+// mixer-v2 composes at a fixed format, only its inputs, stream id and bitrate are set
+const (
+	v2Width      = 1280
+	v2Height     = 720
+	v2FrameRate  = 30
+	v2SampleRate = 48000
+)
+
+// v2Mixer mixer-v2 behind Mixer
+type v2Mixer struct {
+	v2.Mixer
+}
+
+// Close nothing, mixer-v2 can not be stopped
+func (m *v2Mixer) Close() {}
+
+// RequestKeyframe of mixer-v2 when it takes requests, otherwise it sends keyframes at its own interval
+func (m *v2Mixer) RequestKeyframe() {
+	if requester, ok := m.Mixer.(KeyframeRequester); ok {
+		requester.RequestKeyframe()
+	}
+}
+
+// newV2 the last argument of v2.NewMixer is kept as it always was
+func newV2(config *Config) *v2Mixer {
+	return &v2Mixer{
+		Mixer: v2.NewMixer(config.Inputs, config.StreamID, config.Bitrate, true),
+	}
+}
+
+// fixV2 set the format mixer-v2 outputs, it is not a setting of that backend
+func fixV2(config *Config) {
+	if config.Backend != BackendV2 {
+		return
+	}
+	if (config.Video && (config.Width != v2Width || config.Height != v2Height || config.FrameRate != v2FrameRate)) ||
+		(config.Audio && config.SampleRate != v2SampleRate) {
+		logs.Warn(fmt.Sprintf("Mixer %s of %s outputs %dx%d at %d fps and %d Hz, the configured format is ignored",
+			BackendV2, config.StreamID, v2Width, v2Height, v2FrameRate, v2SampleRate))
+	}
+	config.Width, config.Height, config.FrameRate = v2Width, v2Height, v2FrameRate
+	config.SampleRate = v2SampleRate
+}
+
+// validateV2 refuse a format mixer-v2 would not output, fixV2 gives the one it does
+func validateV2(config *Config) error {
+	if config.Video && (config.Width != v2Width || config.Height != v2Height || config.FrameRate != v2FrameRate) {
+		return fmt.Errorf("Mixer %s only outputs %dx%d at %d fps", BackendV2, v2Width, v2Height, v2FrameRate)
+	}
+	if config.Audio && config.SampleRate != v2SampleRate {
+		return fmt.Errorf("Mixer %s only outputs audio at %d Hz", BackendV2, v2SampleRate)
+	}
+	return nil
+}
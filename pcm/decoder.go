@@ -0,0 +1,31 @@
+package pcm
+
+import (
+	"gopkg.in/hraban/opus.v2"
+)
+
+const (
+	// maxFrameDuration the longest opus packet is 120ms
+	maxFrameDuration = 120
+)
+
+// Decoder decode opus packets to interleaved int16 samples
+type Decoder interface {
+	// Decode return number of samples per channel written to pcm
+	Decode(data []byte, pcm []int16) (int, error)
+	// DecodePLC fill pcm with concealment of a lost packet
+	DecodePLC(pcm []int16) error
+}
+
+// newDecoderFunc make a decoder output at sampleRate and channels
+type newDecoderFunc func(sampleRate, channels int) (Decoder, error)
+
+// newOpusDecoder libopus resample and downmix by itself, sampleRate must be 8000, 12000, 16000, 24000 or 48000
+func newOpusDecoder(sampleRate, channels int) (Decoder, error) {
+	return opus.NewDecoder(sampleRate, channels)
+}
+
+// maxSamples buffer size to hold any opus packet
+func maxSamples(sampleRate, channels int) int {
+	return sampleRate * maxFrameDuration / 1000 * channels
+}
@@ -0,0 +1,136 @@
+package pcm
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/lamhai1401/gologs/logs"
+)
+
+const (
+	// frameHeaderSize timestamp(8) sample rate(4) channels(2) samples per channel(2)
+	frameHeaderSize = 16
+)
+
+// SocketServer stream frames of a tap over a unix socket.
+// A client write a signalID line, then read frames until the signalID left:
+// unix nano timestamp int64, sample rate uint32, channels uint16, samples per channel uint16
+// and the interleaved int16 samples, all little endian
+type SocketServer struct {
+	tap      *Tap
+	path     string
+	listener net.Listener
+	conns    map[net.Conn]*Subscription
+	mutex    sync.Mutex
+}
+
+// NewSocketServer listen on path, a stale socket file is removed
+func NewSocketServer(tap *Tap, path string) (*SocketServer, error) {
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("Remove old pcm socket err: %v", err)
+	}
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, fmt.Errorf("Listen pcm socket err: %v", err)
+	}
+	return &SocketServer{
+		tap:      tap,
+		path:     path,
+		listener: listener,
+		conns:    make(map[net.Conn]*Subscription),
+	}, nil
+}
+
+// GetPath linter
+func (s *SocketServer) GetPath() string {
+	return s.path
+}
+
+// Serve accept clients until closed
+func (s *SocketServer) Serve() {
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		go s.handle(conn)
+	}
+}
+
+func (s *SocketServer) handle(conn net.Conn) {
+	defer conn.Close()
+
+	reader := bufio.NewReader(conn)
+	line, err := reader.ReadString('\n')
+	if err != nil {
+		return
+	}
+	signalID := strings.TrimSpace(line)
+	if signalID == "" {
+		return
+	}
+
+	sub, err := s.tap.Subscribe(signalID)
+	if err != nil {
+		logs.Error(fmt.Sprintf("Subscribe pcm of %s err: %v", signalID, err))
+		return
+	}
+	s.mutex.Lock()
+	s.conns[conn] = sub
+	s.mutex.Unlock()
+	defer func() {
+		s.mutex.Lock()
+		delete(s.conns, conn)
+		s.mutex.Unlock()
+		s.tap.Unsubscribe(sub)
+	}()
+
+	// end the subscription as soon as the client hang up
+	go func() {
+		io.Copy(ioutil.Discard, reader)
+		s.tap.Unsubscribe(sub)
+	}()
+
+	logs.Info(fmt.Sprintf("Pcm client subscribed to %s", signalID))
+	writer := bufio.NewWriter(conn)
+	for frame := range sub.C() {
+		if err := writeFrame(writer, frame); err != nil {
+			logs.Warn(fmt.Sprintf("Write pcm of %s err: %v", signalID, err))
+			return
+		}
+	}
+}
+
+func writeFrame(w *bufio.Writer, frame *Frame) error {
+	buf := make([]byte, frameHeaderSize+len(frame.Samples)*2)
+	binary.LittleEndian.PutUint64(buf[0:], uint64(frame.Timestamp.UnixNano()))
+	binary.LittleEndian.PutUint32(buf[8:], uint32(frame.SampleRate))
+	binary.LittleEndian.PutUint16(buf[12:], uint16(frame.Channels))
+	binary.LittleEndian.PutUint16(buf[14:], uint16(len(frame.Samples)/frame.Channels))
+	for i, sample := range frame.Samples {
+		binary.LittleEndian.PutUint16(buf[frameHeaderSize+i*2:], uint16(sample))
+	}
+	if _, err := w.Write(buf); err != nil {
+		return err
+	}
+	return w.Flush()
+}
+
+// Close stop accepting, disconnect clients and remove the socket file
+func (s *SocketServer) Close() {
+	s.listener.Close()
+
+	s.mutex.Lock()
+	for conn, sub := range s.conns {
+		conn.Close()
+		s.tap.Unsubscribe(sub)
+	}
+	s.mutex.Unlock()
+}
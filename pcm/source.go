@@ -0,0 +1,185 @@
+package pcm
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/pion/rtp"
+)
+
+const (
+	// maxConceal lost packets in a row filled by plc, longer gaps restart timestamps
+	maxConceal = 5
+	// maxDrift restart timestamps when wall clock run ahead of decoded audio, e.g. after dtx or mute
+	maxDrift = 500 * time.Millisecond
+)
+
+// Frame fixed size chunk of decoded audio
+type Frame struct {
+	SignalID   string
+	Timestamp  time.Time // wall clock of first sample
+	SampleRate int
+	Channels   int
+	Samples    []int16 // interleaved, len is frame samples * channels
+}
+
+// Duration of audio in frame
+func (f *Frame) Duration() time.Duration {
+	return time.Duration(len(f.Samples)/f.Channels) * time.Second / time.Duration(f.SampleRate)
+}
+
+// source decode packets of a signalID and deliver frames to its subscriptions
+type source struct {
+	signalID      string
+	sampleRate    int
+	channels      int
+	frameSamples  int // per channel
+	decoder       Decoder
+	buf           []int16
+	pending       []int16
+	base          time.Time // wall clock of first sample of pending
+	lastSeq       uint16
+	lastSamples   int // per channel samples of previous packet, used to conceal
+	started       bool
+	subscriptions []*Subscription
+	mutex         sync.Mutex
+}
+
+func newSource(signalID string, sampleRate, channels int, frameDuration time.Duration, newDecoder newDecoderFunc) (*source, error) {
+	decoder, err := newDecoder(sampleRate, channels)
+	if err != nil {
+		return nil, fmt.Errorf("New opus decoder err: %v", err)
+	}
+	return &source{
+		signalID:     signalID,
+		sampleRate:   sampleRate,
+		channels:     channels,
+		frameSamples: int(int64(sampleRate) * int64(frameDuration) / int64(time.Second)),
+		decoder:      decoder,
+		buf:          make([]int16, maxSamples(sampleRate, channels)),
+	}, nil
+}
+
+// push decode a packet in sequence order and deliver completed frames
+func (s *source) push(pkt *rtp.Packet, now time.Time) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if len(s.subscriptions) == 0 || len(pkt.Payload) == 0 {
+		return nil
+	}
+
+	if s.started {
+		diff := pkt.SequenceNumber - s.lastSeq
+		switch {
+		case diff == 0 || diff > 0x8000:
+			// duplicate or late packet
+			return nil
+		case diff > maxConceal+1:
+			s.restart(now)
+		case diff > 1:
+			for i := uint16(1); i < diff; i++ {
+				s.conceal()
+			}
+		}
+	} else {
+		s.restart(now)
+		s.started = true
+	}
+	s.lastSeq = pkt.SequenceNumber
+
+	if now.Sub(s.base)-s.duration(len(s.pending)/s.channels) > maxDrift {
+		s.restart(now)
+	}
+
+	n, err := s.decoder.Decode(pkt.Payload, s.buf)
+	if err != nil {
+		return fmt.Errorf("Decode opus of %s err: %v", s.signalID, err)
+	}
+	s.lastSamples = n
+	s.pending = append(s.pending, s.buf[:n*s.channels]...)
+	s.deliver()
+	return nil
+}
+
+// conceal a lost packet with as many samples as the previous one
+func (s *source) conceal() {
+	if s.lastSamples == 0 {
+		return
+	}
+	samples := s.buf[:s.lastSamples*s.channels]
+	if err := s.decoder.DecodePLC(samples); err != nil {
+		return
+	}
+	s.pending = append(s.pending, samples...)
+}
+
+// restart drop partial frame and start timestamps over at now
+func (s *source) restart(now time.Time) {
+	s.pending = s.pending[:0]
+	s.base = now
+}
+
+func (s *source) duration(samples int) time.Duration {
+	return time.Duration(samples) * time.Second / time.Duration(s.sampleRate)
+}
+
+// deliver cut pending to fixed size frames, a full subscription drop frames instead of blocking
+func (s *source) deliver() {
+	size := s.frameSamples * s.channels
+	offset := 0
+	for len(s.pending)-offset >= size {
+		samples := make([]int16, size)
+		copy(samples, s.pending[offset:offset+size])
+		offset += size
+
+		frame := &Frame{
+			SignalID:   s.signalID,
+			Timestamp:  s.base,
+			SampleRate: s.sampleRate,
+			Channels:   s.channels,
+			Samples:    samples,
+		}
+		s.base = s.base.Add(s.duration(s.frameSamples))
+
+		for _, sub := range s.subscriptions {
+			select {
+			case sub.frames <- frame:
+			default:
+			}
+		}
+	}
+	// move the partial frame to the front to reuse the backing array
+	s.pending = s.pending[:copy(s.pending, s.pending[offset:])]
+}
+
+func (s *source) subscribe(sub *Subscription) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.subscriptions = append(s.subscriptions, sub)
+}
+
+// unsubscribe return number of subscriptions left
+func (s *source) unsubscribe(sub *Subscription) int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	for i, item := range s.subscriptions {
+		if item == sub {
+			s.subscriptions = append(s.subscriptions[:i], s.subscriptions[i+1:]...)
+			close(sub.frames)
+			break
+		}
+	}
+	return len(s.subscriptions)
+}
+
+// close end every subscriptions
+func (s *source) close() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	for _, sub := range s.subscriptions {
+		close(sub.frames)
+	}
+	s.subscriptions = nil
+}
@@ -0,0 +1,127 @@
+package pcm
+
+import (
+	"sync"
+	"time"
+
+	"github.com/lamhai1401/gologs/logs"
+	"github.com/lamhai1401/testrtc/utils"
+	"github.com/pion/rtp"
+)
+
+const (
+	// subscriptionBuffer frames queued per subscription before dropping
+	subscriptionBuffer = 50
+)
+
+// Subscription receive decoded frames of a signalID until unsubscribed or the signalID left
+type Subscription struct {
+	signalID string
+	frames   chan *Frame
+}
+
+// C frames in order, closed when the subscription ends
+func (s *Subscription) C() <-chan *Frame {
+	return s.frames
+}
+
+// GetSignalID linter
+func (s *Subscription) GetSignalID() string {
+	return s.signalID
+}
+
+// Tap decode opus of participants and mixer to pcm for subscribers, nothing is decoded without subscriptions
+type Tap struct {
+	sampleRate    int
+	channels      int
+	frameDuration time.Duration
+	newDecoder    newDecoderFunc
+	sources       *utils.AdvanceMap // signalID - *source
+	mutex         sync.Mutex        // guard adding and deleting sources
+}
+
+// NewTap output frames of frameDuration at sampleRate and channels
+func NewTap(sampleRate, channels int, frameDuration time.Duration) *Tap {
+	return &Tap{
+		sampleRate:    sampleRate,
+		channels:      channels,
+		frameDuration: frameDuration,
+		newDecoder:    newOpusDecoder,
+		sources:       utils.NewAdvanceMap(),
+	}
+}
+
+func (t *Tap) getSource(signalID string) *source {
+	if value, has := t.sources.Get(signalID); has {
+		if src, ok := value.(*source); ok {
+			return src
+		}
+	}
+	return nil
+}
+
+// Subscribe to decoded audio of signalID, the signalID does not need to be publishing yet
+func (t *Tap) Subscribe(signalID string) (*Subscription, error) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	src := t.getSource(signalID)
+	if src == nil {
+		var err error
+		src, err = newSource(signalID, t.sampleRate, t.channels, t.frameDuration, t.newDecoder)
+		if err != nil {
+			return nil, err
+		}
+		t.sources.Set(signalID, src)
+	}
+
+	sub := &Subscription{
+		signalID: signalID,
+		frames:   make(chan *Frame, subscriptionBuffer),
+	}
+	src.subscribe(sub)
+	return sub, nil
+}
+
+// Unsubscribe close C of sub, decoding of its signalID stop with the last subscription
+func (t *Tap) Unsubscribe(sub *Subscription) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	src := t.getSource(sub.signalID)
+	if src == nil {
+		return
+	}
+	if src.unsubscribe(sub) == 0 {
+		t.sources.Delete(sub.signalID)
+	}
+}
+
+// Push an opus packet of signalID in sequence order
+func (t *Tap) Push(signalID string, pkt *rtp.Packet) {
+	src := t.getSource(signalID)
+	if src == nil {
+		return
+	}
+	if err := src.push(pkt, time.Now()); err != nil {
+		logs.Warn(err.Error())
+	}
+}
+
+// Remove signalID that left, its subscriptions are closed and have to subscribe again
+func (t *Tap) Remove(signalID string) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	if src := t.getSource(signalID); src != nil {
+		t.sources.Delete(signalID)
+		src.close()
+	}
+}
+
+// Close end every subscriptions
+func (t *Tap) Close() {
+	for _, signalID := range t.sources.GetKeys() {
+		t.Remove(signalID)
+	}
+}
@@ -0,0 +1,128 @@
+package pcm
+
+import (
+	"testing"
+	"time"
+
+	"github.com/pion/rtp"
+)
+
+// fakeDecoder output 20ms of the first payload byte per packet and -1 for concealment
+type fakeDecoder struct {
+	samples int
+}
+
+func (d *fakeDecoder) Decode(data []byte, pcm []int16) (int, error) {
+	for i := 0; i < d.samples; i++ {
+		pcm[i] = int16(data[0])
+	}
+	return d.samples, nil
+}
+
+func (d *fakeDecoder) DecodePLC(pcm []int16) error {
+	for i := range pcm {
+		pcm[i] = -1
+	}
+	return nil
+}
+
+func newTestTap(frameDuration time.Duration) *Tap {
+	tap := NewTap(16000, 1, frameDuration)
+	tap.newDecoder = func(sampleRate, channels int) (Decoder, error) {
+		return &fakeDecoder{samples: sampleRate / 50}, nil
+	}
+	return tap
+}
+
+func pushPacket(t *testing.T, src *source, seq uint16, value byte, now time.Time) {
+	pkt := &rtp.Packet{Header: rtp.Header{SequenceNumber: seq}, Payload: []byte{value}}
+	if err := src.push(pkt, now); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestFixedFrames(t *testing.T) {
+	tap := newTestTap(30 * time.Millisecond)
+	sub, err := tap.Subscribe("a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	src := tap.getSource("a")
+
+	start := time.Now()
+	for i := 0; i < 3; i++ {
+		pushPacket(t, src, uint16(i), byte(i+1), start.Add(time.Duration(i)*20*time.Millisecond))
+	}
+
+	// 60ms decoded is two 30ms frames
+	for i := 0; i < 2; i++ {
+		select {
+		case frame := <-sub.C():
+			if len(frame.Samples) != 480 {
+				t.Fatalf("frame %d has %d samples", i, len(frame.Samples))
+			}
+			if want := start.Add(time.Duration(i) * 30 * time.Millisecond); !frame.Timestamp.Equal(want) {
+				t.Fatalf("frame %d at %v, want %v", i, frame.Timestamp, want)
+			}
+		default:
+			t.Fatalf("missing frame %d", i)
+		}
+	}
+	select {
+	case <-sub.C():
+		t.Fatal("unexpected frame")
+	default:
+	}
+}
+
+func TestConcealLoss(t *testing.T) {
+	tap := newTestTap(20 * time.Millisecond)
+	sub, _ := tap.Subscribe("a")
+	src := tap.getSource("a")
+
+	now := time.Now()
+	pushPacket(t, src, 10, 1, now)
+	pushPacket(t, src, 12, 3, now.Add(40*time.Millisecond))
+
+	want := []int16{1, -1, 3}
+	for i, value := range want {
+		frame := <-sub.C()
+		if frame.Samples[0] != value {
+			t.Fatalf("frame %d is %d, want %d", i, frame.Samples[0], value)
+		}
+	}
+
+	// late packet is dropped
+	pushPacket(t, src, 11, 2, now.Add(60*time.Millisecond))
+	select {
+	case <-sub.C():
+		t.Fatal("late packet delivered")
+	default:
+	}
+}
+
+func TestSubscriptionLifetime(t *testing.T) {
+	tap := newTestTap(20 * time.Millisecond)
+
+	// nothing decoded without subscriptions
+	tap.Push("a", &rtp.Packet{Payload: []byte{1}})
+	if tap.getSource("a") != nil {
+		t.Fatal("source without subscriptions")
+	}
+
+	first, _ := tap.Subscribe("a")
+	second, _ := tap.Subscribe("a")
+	tap.Unsubscribe(first)
+	if _, open := <-first.C(); open {
+		t.Fatal("unsubscribed channel is open")
+	}
+	if tap.getSource("a") == nil {
+		t.Fatal("source removed with a subscription left")
+	}
+
+	tap.Remove("a")
+	if _, open := <-second.C(); open {
+		t.Fatal("channel is open after remove")
+	}
+	tap.Unsubscribe(second)
+}
@@ -2,13 +2,23 @@ package peer
 
 import (
 	"fmt"
+	"io"
 	"math/rand"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/lamhai1401/gologs/logs"
+	"github.com/lamhai1401/testrtc/avsync"
+	"github.com/lamhai1401/testrtc/fec"
+	"github.com/lamhai1401/testrtc/jitter"
+	"github.com/lamhai1401/testrtc/rtpdump"
+	"github.com/lamhai1401/testrtc/stats"
 	"github.com/lamhai1401/testrtc/utils"
+	"github.com/mitchellh/mapstructure"
 	"github.com/pion/rtcp"
 	"github.com/pion/rtp"
+	"github.com/pion/rtp/codecs"
 	"github.com/pion/webrtc/v2"
 )
 
@@ -152,11 +162,387 @@ func (p *Peer) setClose(state bool) {
 	p.isClosed = state
 }
 
-func (p *Peer) writeRTP(packet *rtp.Packet, track *webrtc.Track) error {
+func (p *Peer) writeRTP(packet *rtp.Packet, track *webrtc.Track, sender *fec.Sender) error {
 	// packet.PayloadType = track.PayloadType()
 	packet.SSRC = track.SSRC()
 	packet.Header.PayloadType = track.PayloadType()
-	return track.WriteRTP(packet)
+	packets := []*rtp.Packet{packet}
+	if sender != nil {
+		var err error
+		if packets, err = sender.Packetize(packet); err != nil {
+			return err
+		}
+	}
+
+	reporter := p.getReporter(track.Kind().String())
+	outbound := p.getOutbound(track.Kind().String())
+	for _, pkt := range packets {
+		if err := track.WriteRTP(pkt); err != nil {
+			return err
+		}
+		now := time.Now()
+		if reporter != nil {
+			reporter.OnPacket(pkt, now)
+		}
+		if outbound != nil {
+			outbound.OnPacket(pkt, now)
+		}
+	}
+	return nil
+}
+
+func (p *Peer) getInbounds() *utils.AdvanceMap {
+	p.mutex.RLock()
+	defer p.mutex.RUnlock()
+	return p.inbounds
+}
+
+func (p *Peer) getInbound(kind string) *stats.Inbound {
+	if inbounds := p.getInbounds(); inbounds != nil {
+		if value, has := inbounds.Get(kind); has {
+			if inbound, ok := value.(*stats.Inbound); ok {
+				return inbound
+			}
+		}
+	}
+	return nil
+}
+
+func (p *Peer) getOutbounds() *utils.AdvanceMap {
+	p.mutex.RLock()
+	defer p.mutex.RUnlock()
+	return p.outbounds
+}
+
+func (p *Peer) getOutbound(kind string) *stats.Outbound {
+	if outbounds := p.getOutbounds(); outbounds != nil {
+		if value, has := outbounds.Get(kind); has {
+			if outbound, ok := value.(*stats.Outbound); ok {
+				return outbound
+			}
+		}
+	}
+	return nil
+}
+
+func (p *Peer) setOutbound(kind string, track *webrtc.Track) {
+	if outbounds := p.getOutbounds(); outbounds != nil {
+		outbounds.Set(kind, stats.NewOutbound(kind, track.SSRC(), track.Codec().ClockRate))
+	}
+}
+
+// readSenderRTCP read receiver reports about local track
+func (p *Peer) readSenderRTCP(kind string, sender *webrtc.RTPSender) {
+	for {
+		if p.checkClose() {
+			return
+		}
+
+		packets, err := sender.ReadRTCP()
+		if err != nil {
+			if err != io.EOF {
+				logs.Error(fmt.Sprintf("%s read %s sender rtcp err: %v", p.getSignalID(), kind, err))
+			}
+			return
+		}
+
+		outbound := p.getOutbound(kind)
+		if outbound == nil {
+			continue
+		}
+
+		now := time.Now()
+		for _, packet := range packets {
+			var reports []rtcp.ReceptionReport
+			switch pkt := packet.(type) {
+			case *rtcp.ReceiverReport:
+				reports = pkt.Reports
+			case *rtcp.SenderReport:
+				reports = pkt.Reports
+			case *rtcp.ReceiverEstimatedMaximumBitrate:
+				outbound.OnREMB(pkt.Bitrate, now)
+			}
+			for _, report := range reports {
+				if report.SSRC == outbound.GetSSRC() {
+					outbound.OnReceiverReport(report, now)
+				}
+			}
+		}
+	}
+}
+
+// getDTLSState return dtls transport state of connection
+func getDTLSState(conn *webrtc.PeerConnection) string {
+	for _, sender := range conn.GetSenders() {
+		if transport := sender.Transport(); transport != nil {
+			return transport.State().String()
+		}
+	}
+	return ""
+}
+
+// getCandidatePairStats return the nominated ice candidate pair
+func getCandidatePairStats(conn *webrtc.PeerConnection) *stats.CandidatePairStats {
+	report := conn.GetStats()
+	for _, value := range report {
+		pair, ok := value.(webrtc.ICECandidatePairStats)
+		if !ok || !pair.Nominated {
+			continue
+		}
+
+		result := &stats.CandidatePairStats{
+			State:                string(pair.State),
+			Nominated:            pair.Nominated,
+			BytesSent:            pair.BytesSent,
+			BytesReceived:        pair.BytesReceived,
+			CurrentRoundTripTime: pair.CurrentRoundTripTime,
+		}
+		if local, ok := report[pair.LocalCandidateID].(webrtc.ICECandidateStats); ok {
+			result.LocalAddress = fmt.Sprintf("%s:%d", local.IP, local.Port)
+			result.LocalType = local.CandidateType.String()
+			result.Protocol = local.Protocol
+		}
+		if remote, ok := report[pair.RemoteCandidateID].(webrtc.ICECandidateStats); ok {
+			result.RemoteAddress = fmt.Sprintf("%s:%d", remote.IP, remote.Port)
+			result.RemoteType = remote.CandidateType.String()
+		}
+		return result
+	}
+	return nil
+}
+
+func (p *Peer) getJitter(kind string) *jitter.Buffer {
+	p.mutex.RLock()
+	defer p.mutex.RUnlock()
+	switch kind {
+	case "audio":
+		return p.audioJitter
+	case "video":
+		return p.videoJitter
+	default:
+		return nil
+	}
+}
+
+func (p *Peer) setJitter(kind string, buffer *jitter.Buffer) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	switch kind {
+	case "audio":
+		p.audioJitter = buffer
+	case "video":
+		p.videoJitter = buffer
+	}
+}
+
+func (p *Peer) getCapture() *rtpdump.Capture {
+	p.mutex.RLock()
+	defer p.mutex.RUnlock()
+	return p.capture
+}
+
+func (p *Peer) setCapture(capture *rtpdump.Capture) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.capture = capture
+}
+
+func (p *Peer) getSynchronizer() *avsync.Synchronizer {
+	p.mutex.RLock()
+	defer p.mutex.RUnlock()
+	return p.synchronizer
+}
+
+func (p *Peer) getReporter(kind string) *avsync.Reporter {
+	p.mutex.RLock()
+	defer p.mutex.RUnlock()
+	switch kind {
+	case "audio":
+		return p.audioReporter
+	case "video":
+		return p.videoReporter
+	default:
+		return nil
+	}
+}
+
+func (p *Peer) setReporter(kind string, track *webrtc.Track) {
+	reporter := avsync.NewReporter(track.SSRC(), track.Codec().ClockRate)
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	switch kind {
+	case "audio":
+		p.audioReporter = reporter
+	case "video":
+		p.videoReporter = reporter
+	}
+}
+
+// sendSenderReports send ntp to rtp mapping of local tracks so receivers can lip sync
+func (p *Peer) sendSenderReports() {
+	ticker := time.NewTicker(time.Second * 1)
+	defer ticker.Stop()
+	for range ticker.C {
+		if p.checkClose() {
+			return
+		}
+
+		conn := p.getConn()
+		if conn == nil {
+			return
+		}
+
+		now := time.Now()
+		packets := make([]rtcp.Packet, 0, 2)
+		for _, kind := range []string{"audio", "video"} {
+			if reporter := p.getReporter(kind); reporter != nil {
+				if sr := reporter.Report(now); sr != nil {
+					packets = append(packets, sr)
+				}
+			}
+		}
+		if len(packets) == 0 {
+			continue
+		}
+
+		if errSend := conn.WriteRTCP(packets); errSend != nil {
+			logs.Error("Sender report write rtcp err: ", errSend.Error())
+		}
+	}
+}
+
+func (p *Peer) getAudioSender() *fec.Sender {
+	p.mutex.RLock()
+	defer p.mutex.RUnlock()
+	return p.audioSender
+}
+
+func (p *Peer) getVideoSender() *fec.Sender {
+	p.mutex.RLock()
+	defer p.mutex.RUnlock()
+	return p.videoSender
+}
+
+// getFECPayloadTypes return red and ulpfec payload types of this kind
+func (p *Peer) getFECPayloadTypes(kind string) (uint8, uint8) {
+	p.mutex.RLock()
+	defer p.mutex.RUnlock()
+	switch kind {
+	case "audio":
+		return p.redAudioPT, 0
+	case "video":
+		return p.redVideoPT, p.ulpfecPT
+	default:
+		return 0, 0
+	}
+}
+
+// decodeSDP convert sdp from signal to struct
+func decodeSDP(values interface{}) (*utils.SDPTemp, error) {
+	var data utils.SDPTemp
+	if err := mapstructure.Decode(values, &data); err != nil {
+		return nil, err
+	}
+	return &data, nil
+}
+
+// setFECPayloadTypes use red and ulpfec payload types of remote offer
+// so both sides agree without remapping
+func (p *Peer) setFECPayloadTypes(sdp string) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	for _, line := range strings.Split(sdp, "\n") {
+		line = strings.TrimSpace(line)
+		if !strings.HasPrefix(line, "a=rtpmap:") {
+			continue
+		}
+
+		fields := strings.Fields(strings.TrimPrefix(line, "a=rtpmap:"))
+		if len(fields) != 2 {
+			continue
+		}
+		pt, err := strconv.ParseUint(fields[0], 10, 7)
+		if err != nil {
+			continue
+		}
+
+		codec := strings.ToLower(fields[1])
+		switch {
+		case strings.HasPrefix(codec, "red/48000"):
+			p.redAudioPT = uint8(pt)
+		case strings.HasPrefix(codec, "red/90000"):
+			p.redVideoPT = uint8(pt)
+		case strings.HasPrefix(codec, "ulpfec/90000"):
+			p.ulpfecPT = uint8(pt)
+		}
+	}
+}
+
+func (p *Peer) getAudioLevelID() uint8 {
+	p.mutex.RLock()
+	defer p.mutex.RUnlock()
+	return p.audioLevelID
+}
+
+// setAudioLevelID use ssrc-audio-level extension id of remote offer
+func (p *Peer) setAudioLevelID(sdp string) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	for _, line := range strings.Split(sdp, "\n") {
+		line = strings.TrimSpace(line)
+		if !strings.HasPrefix(line, "a=extmap:") || !strings.HasSuffix(line, audioLevelURI) {
+			continue
+		}
+
+		// a=extmap:<id>[/direction] <uri>
+		fields := strings.Fields(strings.TrimPrefix(line, "a=extmap:"))
+		id, err := strconv.ParseUint(strings.Split(fields[0], "/")[0], 10, 8)
+		if err != nil || id == 0 || id > 14 {
+			continue
+		}
+		p.audioLevelID = uint8(id)
+		return
+	}
+}
+
+// addAudioLevelExtmap add ssrc-audio-level extension to audio section of local answer
+// pion v2 does not negotiate header extensions by itself
+func (p *Peer) addAudioLevelExtmap(sdp string) string {
+	id := p.getAudioLevelID()
+	if id == 0 {
+		return sdp
+	}
+
+	lines := strings.Split(sdp, "\r\n")
+	out := make([]string, 0, len(lines)+1)
+	inAudio := false
+	for _, line := range lines {
+		out = append(out, line)
+		if strings.HasPrefix(line, "m=") {
+			inAudio = strings.HasPrefix(line, "m=audio")
+			continue
+		}
+		if inAudio && strings.HasPrefix(line, "a=mid:") {
+			out = append(out, fmt.Sprintf("a=extmap:%d %s", id, audioLevelURI))
+			inAudio = false
+		}
+	}
+	return strings.Join(out, "\r\n")
+}
+
+// initFECSender wrap local tracks with red and ulpfec if negotiated
+func (p *Peer) initFECSender() {
+	redAudioPT, _ := p.getFECPayloadTypes("audio")
+	redVideoPT, ulpfecPT := p.getFECPayloadTypes("video")
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	if redAudioPT != 0 {
+		p.audioSender = fec.NewSender(redAudioPT, 0, 1, 0)
+	}
+	if redVideoPT != 0 && ulpfecPT != 0 {
+		p.videoSender = fec.NewSender(redVideoPT, ulpfecPT, 0, utils.GetFECGroupSize())
+	}
 }
 
 // CreateAudioTrack linter
@@ -167,11 +553,14 @@ func (p *Peer) createAudioTrack(trackID string, codesc uint8) error {
 			return err
 		}
 		// Add this newly created track to the PeerConnection
-		_, err = conn.AddTrack(localTrack)
+		sender, err := conn.AddTrack(localTrack)
 		if err != nil {
 			return err
 		}
 		p.setLocalAudioTrack(localTrack)
+		p.setReporter("audio", localTrack)
+		p.setOutbound("audio", localTrack)
+		go p.readSenderRTCP("audio", sender)
 		return nil
 	}
 	return fmt.Errorf("cannot create audio track because rtc connection is nil")
@@ -185,11 +574,14 @@ func (p *Peer) createVideoTrack(trackID string, codesc uint8) error {
 			return err
 		}
 		// Add this newly created track to the PeerConnection
-		_, err = conn.AddTrack(localTrack)
+		sender, err := conn.AddTrack(localTrack)
 		if err != nil {
 			return err
 		}
 		p.setLocalVideoTrack(localTrack)
+		p.setReporter("video", localTrack)
+		p.setOutbound("video", localTrack)
+		go p.readSenderRTCP("video", sender)
 		return nil
 	}
 	return fmt.Errorf("cannot create video track because rtc connection is nil")
@@ -238,7 +630,24 @@ func (p *Peer) addAPI() *webrtc.API {
 func (p *Peer) initMediaEngine() *webrtc.MediaEngine {
 	mediaEngine := &webrtc.MediaEngine{}
 	mediaEngine.RegisterCodec(webrtc.NewRTPOpusCodec(defaultAudioCodecs, 48000))
-	mediaEngine.RegisterCodec(webrtc.NewRTPVP8Codec(defaultVideoCodecs, 90000))
+	// remb tells which rendition of the mix the remote side can receive
+	mediaEngine.RegisterCodec(webrtc.NewRTPVP8CodecExt(defaultVideoCodecs, 90000, []webrtc.RTCPFeedback{
+		{Type: webrtc.TypeRTCPFBGoogREMB},
+	}, ""))
+
+	redAudioPT, _ := p.getFECPayloadTypes("audio")
+	if redAudioPT != 0 {
+		mediaEngine.RegisterCodec(webrtc.NewRTPCodec(webrtc.RTPCodecTypeAudio, "red", 48000, 2, fmt.Sprintf("%d/%d", defaultAudioCodecs, defaultAudioCodecs), redAudioPT, &codecs.OpusPayloader{}))
+	}
+
+	redVideoPT, ulpfecPT := p.getFECPayloadTypes("video")
+	if redVideoPT != 0 && ulpfecPT != 0 {
+		mediaEngine.RegisterCodec(webrtc.NewRTPCodec(webrtc.RTPCodecTypeVideo, "red", 90000, 0, "", redVideoPT, &codecs.VP8Payloader{}))
+		mediaEngine.RegisterCodec(webrtc.NewRTPCodec(webrtc.RTPCodecTypeVideo, "ulpfec", 90000, 0, "", ulpfecPT, &codecs.VP8Payloader{}))
+	}
+	p.mutex.Lock()
+	p.mediaEngine = mediaEngine
+	p.mutex.Unlock()
 	return mediaEngine
 }
 
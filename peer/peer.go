@@ -2,10 +2,19 @@ package peer
 
 import (
 	"fmt"
+	"io"
 	"sync"
-
+	"time"
+
+	"github.com/lamhai1401/gologs/logs"
+	"github.com/lamhai1401/testrtc/avsync"
+	"github.com/lamhai1401/testrtc/fec"
+	"github.com/lamhai1401/testrtc/jitter"
+	"github.com/lamhai1401/testrtc/rtpdump"
+	"github.com/lamhai1401/testrtc/stats"
 	"github.com/lamhai1401/testrtc/utils"
 	"github.com/mitchellh/mapstructure"
+	"github.com/pion/rtcp"
 	"github.com/pion/rtp"
 	"github.com/pion/webrtc/v2"
 )
@@ -15,6 +24,10 @@ var (
 	defaultVideoCodecs = uint8(webrtc.DefaultPayloadTypeVP8)
 )
 
+const (
+	audioLevelURI = "urn:ietf:params:rtp-hdrext:ssrc-audio-level"
+)
+
 // NewSDPType linter
 func NewSDPType(raw string) webrtc.SDPType {
 	switch raw {
@@ -38,6 +51,21 @@ type Peer struct {
 	localAudioTrack   *webrtc.Track
 	remotelVideoTrack *webrtc.Track
 	remoteVideoTrack  *webrtc.Track
+	mediaEngine       *webrtc.MediaEngine
+	redAudioPT        uint8       // red payload type of audio, 0 is not negotiated
+	redVideoPT        uint8       // red payload type of video, 0 is not negotiated
+	ulpfecPT          uint8       // ulpfec payload type of video, 0 is not negotiated
+	audioLevelID      uint8       // ssrc-audio-level extension id, 0 is not negotiated
+	audioSender       *fec.Sender // add red to local audio track
+	videoSender       *fec.Sender // add red and ulpfec to local video track
+	audioReporter     *avsync.Reporter
+	videoReporter     *avsync.Reporter
+	synchronizer      *avsync.Synchronizer // lip sync of remote tracks
+	audioJitter       *jitter.Buffer       // reorder remote audio track
+	videoJitter       *jitter.Buffer       // reorder remote video track
+	inbounds          *utils.AdvanceMap    // kind - remote track stats
+	outbounds         *utils.AdvanceMap    // kind - local track stats
+	capture           *rtpdump.Capture     // dump incoming packets, nil is not capturing
 	isConnected       bool
 	isClosed          bool
 	mutex             sync.RWMutex
@@ -50,12 +78,15 @@ func NewPeer(
 	signalID string,
 ) *Peer {
 	p := &Peer{
-		bitrate:     bitrate,
-		iceCache:    utils.NewAdvanceMap(),
-		sessionID:   sessionID,
-		signalID:    signalID,
-		isClosed:    false,
-		isConnected: false,
+		bitrate:      bitrate,
+		iceCache:     utils.NewAdvanceMap(),
+		inbounds:     utils.NewAdvanceMap(),
+		outbounds:    utils.NewAdvanceMap(),
+		synchronizer: avsync.NewSynchronizer(),
+		sessionID:    sessionID,
+		signalID:     signalID,
+		isClosed:     false,
+		isConnected:  false,
 	}
 
 	return p
@@ -63,6 +94,15 @@ func NewPeer(
 
 // NewConnection linte
 func (p *Peer) NewConnection(sdp interface{}, config *webrtc.Configuration) (*webrtc.PeerConnection, error) {
+	if remote, err := decodeSDP(sdp); err != nil {
+		logs.Warn("Decode remote sdp err: ", err.Error())
+	} else {
+		if utils.IsFECEnable() {
+			p.setFECPayloadTypes(remote.SDP)
+		}
+		p.setAudioLevelID(remote.SDP)
+	}
+
 	api := p.addAPI()
 	conn, err := api.NewPeerConnection(*config)
 	if err != nil {
@@ -78,6 +118,8 @@ func (p *Peer) NewConnection(sdp interface{}, config *webrtc.Configuration) (*we
 		return nil, err
 	}
 
+	p.initFECSender()
+	go p.sendSenderReports()
 	return conn, nil
 }
 
@@ -86,6 +128,7 @@ func (p *Peer) Close() {
 	if !p.checkClose() {
 		p.setClose(true)
 		p.closeConn()
+		p.StopCapture()
 	}
 }
 
@@ -95,7 +138,7 @@ func (p *Peer) AddVideoRTP(packet *rtp.Packet) error {
 	if track == nil {
 		return fmt.Errorf("ErrNilVideoTrack")
 	}
-	return p.writeRTP(packet, track)
+	return p.writeRTP(packet, track, p.getVideoSender())
 }
 
 // AddAudioRTP write rtp to local audio track
@@ -104,7 +147,209 @@ func (p *Peer) AddAudioRTP(packet *rtp.Packet) error {
 	if track == nil {
 		return fmt.Errorf("ErrNilAudioTrack")
 	}
-	return p.writeRTP(packet, track)
+	return p.writeRTP(packet, track, p.getAudioSender())
+}
+
+// NewFECReceiver return a receiver to unwrap red and recover lost packets of remote track kind
+func (p *Peer) NewFECReceiver(kind string) *fec.Receiver {
+	redPT, ulpfecPT := p.getFECPayloadTypes(kind)
+	return fec.NewReceiver(redPT, ulpfecPT)
+}
+
+// GetCodec registered with payload type pt, nil if there is none. A remote track reports
+// red as its codec once red is negotiated, so look up the payload type the fec receiver unwrapped
+func (p *Peer) GetCodec(pt uint8) *webrtc.RTPCodec {
+	p.mutex.RLock()
+	defer p.mutex.RUnlock()
+	if p.mediaEngine == nil {
+		return nil
+	}
+	for _, kind := range []webrtc.RTPCodecType{webrtc.RTPCodecTypeAudio, webrtc.RTPCodecTypeVideo} {
+		for _, codec := range p.mediaEngine.GetCodecsByKind(kind) {
+			if codec.PayloadType == pt {
+				return codec
+			}
+		}
+	}
+	return nil
+}
+
+// HandleRTCP read rtcp of remote track and save sender reports for lip sync
+func (p *Peer) HandleRTCP(remoteTrack *webrtc.Track, receiver *webrtc.RTPReceiver) {
+	kind := remoteTrack.Kind().String()
+	clockRate := remoteTrack.Codec().ClockRate
+
+	for {
+		if p.checkClose() {
+			return
+		}
+
+		packets, err := receiver.ReadRTCP()
+		if err != nil {
+			if err != io.EOF {
+				logs.Error(fmt.Sprintf("%s read %s rtcp err: %v", p.getSignalID(), kind, err))
+			}
+			return
+		}
+
+		if capture := p.getCapture(); capture != nil {
+			if raw, err := rtcp.Marshal(packets); err == nil {
+				if err := capture.WriteRTCP(kind, uint32(remoteTrack.SSRC()), raw, time.Now()); err != nil {
+					logs.Error(fmt.Sprintf("%s capture %s rtcp err: %v", p.getSignalID(), kind, err))
+				}
+			}
+		}
+
+		for _, packet := range packets {
+			if sr, ok := packet.(*rtcp.SenderReport); ok {
+				p.getSynchronizer().AddSenderReport(kind, clockRate, sr)
+			}
+		}
+	}
+}
+
+// StartCapture dump every incoming rtp and rtcp packet to a file in dir
+func (p *Peer) StartCapture(dir string) (string, error) {
+	if p.getCapture() != nil {
+		return "", fmt.Errorf("%s is already capturing", p.getSignalID())
+	}
+
+	capture, err := rtpdump.NewCapture(dir, p.getSignalID())
+	if err != nil {
+		return "", err
+	}
+	p.setCapture(capture)
+	return capture.GetPath(), nil
+}
+
+// StopCapture close dump file if capturing
+func (p *Peer) StopCapture() {
+	capture := p.getCapture()
+	if capture == nil {
+		return
+	}
+	p.setCapture(nil)
+
+	if err := capture.Close(); err != nil {
+		logs.Error(fmt.Sprintf("Close capture %s err: %v", capture.GetPath(), err))
+	}
+}
+
+// CaptureRTP dump an incoming rtp packet if capturing
+func (p *Peer) CaptureRTP(kind string, pkt *rtp.Packet, arrival time.Time) {
+	capture := p.getCapture()
+	if capture == nil {
+		return
+	}
+
+	if err := capture.WriteRTP(kind, pkt, arrival); err != nil {
+		logs.Error(fmt.Sprintf("%s capture %s rtp err: %v", p.getSignalID(), kind, err))
+	}
+}
+
+// GetAudioLevel return audio level (-dBov) of an audio packet if negotiated
+func (p *Peer) GetAudioLevel(pkt *rtp.Packet) (uint8, bool) {
+	id := p.getAudioLevelID()
+	if id == 0 || !pkt.Extension {
+		return 0, false
+	}
+
+	payload := pkt.GetExtension(id)
+	if payload == nil {
+		return 0, false
+	}
+
+	var ext rtp.AudioLevelExtension
+	if err := ext.Unmarshal(payload); err != nil {
+		return 0, false
+	}
+	return ext.Level, true
+}
+
+// NewJitterBuffer create the jitter buffer of remote track kind
+func (p *Peer) NewJitterBuffer(kind string) *jitter.Buffer {
+	buffer := jitter.NewBuffer(utils.GetJitterSize(), utils.GetJitterLatency())
+	p.setJitter(kind, buffer)
+	return buffer
+}
+
+// GetJitterStats return jitter buffer statistics of remote track kind
+func (p *Peer) GetJitterStats(kind string) *jitter.Stats {
+	if buffer := p.getJitter(kind); buffer != nil {
+		stats := buffer.Stats()
+		return &stats
+	}
+	return nil
+}
+
+// NewInboundStats create statistics counter of a remote track
+func (p *Peer) NewInboundStats(remoteTrack *webrtc.Track) *stats.Inbound {
+	kind := remoteTrack.Kind().String()
+	inbound := stats.NewInbound(kind, remoteTrack.SSRC(), remoteTrack.Codec().ClockRate)
+	if inbounds := p.getInbounds(); inbounds != nil {
+		inbounds.Set(kind, inbound)
+	}
+	return inbound
+}
+
+// Stats return a snapshot of rtp, rtcp, ice and dtls statistics, like getStats in browser
+func (p *Peer) Stats() *stats.Report {
+	now := time.Now()
+	report := &stats.Report{
+		SignalID:  p.getSignalID(),
+		SessionID: p.getSessionID(),
+		Timestamp: now,
+		Inbound:   make([]*stats.InboundRTPStats, 0, 2),
+		Outbound:  make([]*stats.OutboundRTPStats, 0, 2),
+	}
+
+	for _, kind := range []string{"audio", "video"} {
+		if inbound := p.getInbound(kind); inbound != nil {
+			s := inbound.Snapshot(now)
+			s.JitterBuffer = p.GetJitterStats(kind)
+			report.Inbound = append(report.Inbound, s)
+		}
+		if outbound := p.getOutbound(kind); outbound != nil {
+			report.Outbound = append(report.Outbound, outbound.Snapshot(now))
+		}
+	}
+
+	if conn := p.getConn(); conn != nil {
+		report.ICEState = conn.ICEConnectionState().String()
+		report.DTLSState = getDTLSState(conn)
+		report.CandidatePair = getCandidatePairStats(conn)
+	}
+	return report
+}
+
+// GetOutboundStats snapshot of local track kind, nil if there is none
+func (p *Peer) GetOutboundStats(kind string) *stats.OutboundRTPStats {
+	outbound := p.getOutbound(kind)
+	if outbound == nil {
+		return nil
+	}
+	return outbound.Snapshot(time.Now())
+}
+
+// ServeStats call handler with a stats snapshot every interval until peer is closed
+func (p *Peer) ServeStats(interval time.Duration, handler func(report *stats.Report)) {
+	if interval <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		if p.checkClose() {
+			return
+		}
+		handler(p.Stats())
+	}
+}
+
+// GetSynchronizer return lip sync state of remote tracks
+func (p *Peer) GetSynchronizer() *avsync.Synchronizer {
+	return p.getSynchronizer()
 }
 
 // AddICECandidate to add candidate
@@ -165,6 +410,7 @@ func (p *Peer) CreateAnswer() error {
 	if err != nil {
 		return err
 	}
+	answer.SDP = p.addAudioLevelExtmap(answer.SDP)
 
 	err = conn.SetLocalDescription(answer)
 	if err != nil {
@@ -180,8 +426,7 @@ func (p *Peer) AddSDP(values interface{}) error {
 		return fmt.Errorf("ErrNilPeerconnection")
 	}
 
-	var data utils.SDPTemp
-	err := mapstructure.Decode(values, &data)
+	data, err := decodeSDP(values)
 	if err != nil {
 		return err
 	}
@@ -0,0 +1,30 @@
+package peers
+
+import (
+	"fmt"
+
+	"github.com/lamhai1401/testrtc/utils"
+)
+
+// isModerator check the trusted role of signalID may moderate the room
+func (ps *Peers) isModerator(signalID string) bool {
+	seats := ps.getSeats()
+	if seats == nil {
+		return false
+	}
+	role := seats.GetRole(signalID)
+	for _, moderator := range utils.GetModeratorRoles() {
+		if role == moderator {
+			return true
+		}
+	}
+	return false
+}
+
+// checkModerator return an error if signalID may not send event
+func (ps *Peers) checkModerator(signalID, event string) error {
+	if !ps.isModerator(signalID) {
+		return fmt.Errorf("%s is not allowed to %s", signalID, event)
+	}
+	return nil
+}
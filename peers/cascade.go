@@ -0,0 +1,91 @@
+package peers
+
+import (
+	"fmt"
+
+	"github.com/lamhai1401/gologs/logs"
+	"github.com/lamhai1401/testrtc/cascade"
+	"github.com/lamhai1401/testrtc/ingest"
+	"github.com/lamhai1401/testrtc/utils"
+)
+
+// cascadeStreams mixed output of a child node, as every mixer makes it
+var cascadeStreams = map[string]*ingest.Stream{
+	"video": {Kind: "video", Codec: "vp8", ClockRate: 90000},
+	"audio": {Kind: "audio", Codec: "opus", ClockRate: 48000, Channels: 2},
+}
+
+// initCascade accept the sub-mixes of level - 1 and send the mix to level + 1,
+// a negative level is a node mixing on its own
+func (ps *Peers) initCascade(level int) error {
+	if level < 0 {
+		return nil
+	}
+
+	if addr := utils.GetCascadeAddr(); addr != "" {
+		server, err := cascade.NewServer(addr, level, utils.GetCascadeSecret(), utils.GetCascadeAllow(), ps.joinCascade, ps.pushCascade, ps.leaveCascade)
+		if err != nil {
+			return err
+		}
+		ps.setChildren(server)
+		go server.Serve()
+		logs.Info(fmt.Sprintf("Accept cascade children of level %d on %s", level-1, server.GetAddr()))
+	}
+
+	if addr := utils.GetCascadeParent(); addr != "" {
+		if len(utils.GetCascadeSecret()) == 0 {
+			return fmt.Errorf("Missing cascade secret")
+		}
+		uplink := cascade.NewUplink(addr, &cascade.Hello{
+			ID:    utils.GetCascadeID(),
+			Level: level,
+		}, utils.GetCascadeSecret())
+		ps.setUplink(uplink)
+		for _, kind := range []string{"video", "audio"} {
+			ps.register(kind, cascadeID, func(wrapper *utils.Wrapper) error {
+				uplink.Push(wrapper)
+				return nil
+			})
+		}
+		uplink.Start()
+	}
+	return nil
+}
+
+// joinCascade mix child signalID as a virtual participant. Children are only known to
+// the cascade server, so ingest events can not stop them
+func (ps *Peers) joinCascade(signalID string) error {
+	if ps.getConn(signalID) != nil || ps.getIngest(signalID) != nil {
+		return fmt.Errorf("Participant %s already exists", signalID)
+	}
+
+	if state := ps.getRoom(); state != nil {
+		state.Join(signalID, "")
+	}
+	return nil
+}
+
+// pushCascade feed a packet of the sub-mix of signalID like an ingest one, the server
+// only pushes for joined children
+func (ps *Peers) pushCascade(signalID string, wrapper *utils.Wrapper) {
+	stream, ok := cascadeStreams[wrapper.Kind]
+	if !ok {
+		return
+	}
+	ps.pushVirtual(signalID, stream, &wrapper.Pkg)
+}
+
+// leaveCascade forget child signalID once its connection is closed
+func (ps *Peers) leaveCascade(signalID string) {
+	ps.removeParticipant(signalID)
+	logs.Info(fmt.Sprintf("Cascade child %s left the mix", signalID))
+}
+
+// GetCascadeChildren ids of the nodes one level below mixed in this room
+func (ps *Peers) GetCascadeChildren() []string {
+	children := ps.getChildren()
+	if children == nil {
+		return nil
+	}
+	return children.GetChildren()
+}
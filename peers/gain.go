@@ -0,0 +1,93 @@
+package peers
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/lamhai1401/gologs/logs"
+	"github.com/lamhai1401/testrtc/pcm"
+	"github.com/pion/rtp"
+	"github.com/pion/webrtc/v2"
+)
+
+func (ps *Peers) handleGainEvent(event string, values []interface{}) error {
+	if event == "set-normalize" {
+		if len(values) < 1 {
+			return fmt.Errorf("Missing value to %s", event)
+		}
+		normalize, ok := values[0].(bool)
+		if !ok {
+			return fmt.Errorf("Invalid value to %s: %v", event, values[0])
+		}
+		ps.SetNormalize(normalize)
+		return nil
+	}
+
+	if len(values) < 2 {
+		return fmt.Errorf("Missing signalID or gain to %s", event)
+	}
+	target, ok := values[0].(string)
+	if !ok || target == "" {
+		return fmt.Errorf("Invalid signalID to %s: %v", event, values[0])
+	}
+	db, ok := values[1].(float64)
+	if !ok {
+		return fmt.Errorf("Invalid gain of %s: %v", target, values[1])
+	}
+	return ps.SetGain(target, db)
+}
+
+// SetGain audio gain of signalID in dB, 0 is as it is sent
+func (ps *Peers) SetGain(signalID string, db float64) error {
+	gains := ps.getGains()
+	if gains == nil {
+		return fmt.Errorf("Gain control is not started")
+	}
+	if err := gains.SetGain(signalID, db); err != nil {
+		return err
+	}
+	logs.Info(fmt.Sprintf("Gain of %s is %.1f dB", signalID, db))
+	return nil
+}
+
+// GetGains signalIDs with a gain other than 0 dB
+func (ps *Peers) GetGains() map[string]float64 {
+	gains := ps.getGains()
+	if gains == nil {
+		return nil
+	}
+	return gains.GetGains()
+}
+
+// SetNormalize bring every participant to the same loudness or not
+func (ps *Peers) SetNormalize(normalize bool) {
+	if gains := ps.getGains(); gains != nil {
+		gains.SetNormalize(normalize)
+		logs.Info(fmt.Sprintf("Audio normalization is %v", normalize))
+	}
+}
+
+// adjustAudio apply gain of signalID to opus packets, other codecs are mixed as they are
+func (ps *Peers) adjustAudio(signalID, codec string, pkt *rtp.Packet) *rtp.Packet {
+	gains := ps.getGains()
+	if gains == nil || !strings.EqualFold(codec, webrtc.Opus) {
+		return pkt
+	}
+	return gains.Process(signalID, pkt)
+}
+
+// SubscribePCM receive decoded audio of signalID, or of the mix by the mixer id
+func (ps *Peers) SubscribePCM(signalID string) (*pcm.Subscription, error) {
+	tap := ps.getPCM()
+	if tap == nil {
+		return nil, fmt.Errorf("Pcm tap is not started")
+	}
+	return tap.Subscribe(signalID)
+}
+
+// UnsubscribePCM stop receiving decoded audio of sub
+func (ps *Peers) UnsubscribePCM(sub *pcm.Subscription) {
+	if tap := ps.getPCM(); tap != nil {
+		tap.Unsubscribe(sub)
+	}
+}
@@ -0,0 +1,78 @@
+package peers
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/lamhai1401/gologs/logs"
+	"github.com/lamhai1401/testrtc/hls"
+	"github.com/lamhai1401/testrtc/utils"
+)
+
+// StartHLS segment mixer output to a rolling hls playlist served under /hls/
+func (ps *Peers) StartHLS() error {
+	if ps.getHLS() != nil {
+		return fmt.Errorf("Mixed stream is already broadcasting")
+	}
+
+	packager := hls.NewPackager(hls.Config{
+		SegmentDuration: utils.GetHLSSegmentDuration(),
+		PartDuration:    utils.GetHLSPartDuration(),
+		WindowSize:      utils.GetHLSWindow(),
+	})
+	ps.setHLS(packager)
+
+	// an error returned to the forwarder would stop it, so a bad packet is only logged
+	ps.register("video", hlsID, func(wrapper *utils.Wrapper) error {
+		if err := packager.PushVideo(&wrapper.Pkg); err != nil {
+			logs.Error("Package hls video err: ", err.Error())
+		}
+		return nil
+	})
+	ps.register("audio", hlsID, func(wrapper *utils.Wrapper) error {
+		if err := packager.PushAudio(&wrapper.Pkg); err != nil {
+			logs.Error("Package hls audio err: ", err.Error())
+		}
+		return nil
+	})
+	logs.Info(fmt.Sprintf("Start hls of mixed stream %s", ps.getID()))
+	return nil
+}
+
+// StopHLS linter
+func (ps *Peers) StopHLS() {
+	packager := ps.getHLS()
+	if packager == nil {
+		return
+	}
+	ps.setHLS(nil)
+
+	ps.unregister("video", hlsID)
+	ps.unregister("audio", hlsID)
+	packager.Close()
+	logs.Info(fmt.Sprintf("Stop hls of mixed stream %s", ps.getID()))
+}
+
+// HLSHandler serve playlist and segments of current hls broadcast
+func (ps *Peers) HLSHandler() http.Handler {
+	return http.StripPrefix(hlsPath, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		packager := ps.getHLS()
+		if packager == nil {
+			http.Error(w, "hls is not started", http.StatusNotFound)
+			return
+		}
+		packager.ServeHTTP(w, r)
+	}))
+}
+
+// serveHTTP serve hls under /hls/ and thumbnails under /thumbnails/
+func (ps *Peers) serveHTTP(addr string) {
+	mux := http.NewServeMux()
+	mux.Handle(hlsPath, ps.HLSHandler())
+	mux.Handle(thumbnailPath, http.StripPrefix(thumbnailPath, ps.getThumbnails()))
+
+	logs.Info(fmt.Sprintf("Serve hls at %s%sindex.m3u8, thumbnails at %s%sindex.json", addr, hlsPath, addr, thumbnailPath))
+	if err := http.ListenAndServe(addr, mux); err != nil {
+		logs.Error("Serve http err: ", err.Error())
+	}
+}
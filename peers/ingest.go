@@ -0,0 +1,243 @@
+package peers
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+
+	"github.com/lamhai1401/gologs/logs"
+	"github.com/lamhai1401/testrtc/ingest"
+	"github.com/lamhai1401/testrtc/rtsp"
+	"github.com/lamhai1401/testrtc/utils"
+	"github.com/pion/rtp"
+)
+
+// ingestSource a virtual participant not connected by webrtc
+type ingestSource interface {
+	Close()
+}
+
+// handleStartIngestEvent values are signal ID of the virtual participant and sdp of its rtp streams.
+// Clients only listen on ports of INGESTPORTS
+func (ps *Peers) handleStartIngestEvent(values []interface{}) error {
+	if len(values) < 2 {
+		return fmt.Errorf("Missing ingest signal ID or sdp")
+	}
+
+	id, ok := values[0].(string)
+	if !ok || id == "" {
+		return fmt.Errorf("Invalid ingest signal ID: %v", values[0])
+	}
+	sdp, ok := values[1].(string)
+	if !ok {
+		return fmt.Errorf("Invalid ingest sdp: %v", values[1])
+	}
+	if err := checkIngestPorts(sdp); err != nil {
+		return err
+	}
+	return ps.StartIngest(id, sdp)
+}
+
+// handleStartRTSPEvent values are signal ID of the camera, its url and optional transport (tcp or udp).
+// Clients only pull from the hosts of RTSPHOSTS
+func (ps *Peers) handleStartRTSPEvent(values []interface{}) error {
+	if len(values) < 2 {
+		return fmt.Errorf("Missing rtsp signal ID or url")
+	}
+
+	id, ok := values[0].(string)
+	if !ok || id == "" {
+		return fmt.Errorf("Invalid rtsp signal ID: %v", values[0])
+	}
+	url, ok := values[1].(string)
+	if !ok {
+		return fmt.Errorf("Invalid rtsp url: %v", values[1])
+	}
+	if err := checkHost(url, utils.GetRTSPHosts()); err != nil {
+		return err
+	}
+
+	transport := rtsp.TransportTCP
+	if len(values) > 2 {
+		if transport, ok = values[2].(string); !ok {
+			return fmt.Errorf("Invalid rtsp transport: %v", values[2])
+		}
+	}
+	return ps.StartRTSP(id, url, transport)
+}
+
+// checkIngestPorts return an error if a stream of sdp is outside INGESTPORTS
+func checkIngestPorts(sdp string) error {
+	streams, err := ingest.ParseSDP(sdp)
+	if err != nil {
+		return err
+	}
+	min, max := utils.GetIngestPorts()
+	if min == 0 {
+		return fmt.Errorf("Ingest ports are not configured")
+	}
+	for _, stream := range streams {
+		if stream.Port < min || stream.Port > max {
+			return fmt.Errorf("Ingest port %d is outside %d-%d", stream.Port, min, max)
+		}
+	}
+	return nil
+}
+
+func (ps *Peers) handleStopIngestEvent(values []interface{}) error {
+	if len(values) < 1 {
+		return fmt.Errorf("Missing ingest signal ID")
+	}
+
+	id, ok := values[0].(string)
+	if !ok {
+		return fmt.Errorf("Invalid ingest signal ID: %v", values[0])
+	}
+	ps.StopIngest(id)
+	return nil
+}
+
+// startIngestFile ingest sdp file, signal ID is the file name without extension
+func (ps *Peers) startIngestFile(path string) error {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	id := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	return ps.StartIngest(id, string(data))
+}
+
+// StartIngest listen for plain rtp described by sdp and mix it as participant signalID
+func (ps *Peers) StartIngest(signalID, sdp string) error {
+	if ps.hasParticipant(signalID) {
+		return fmt.Errorf("Participant %s already exists", signalID)
+	}
+
+	source, err := ingest.NewIngest(signalID, sdp, func(stream *ingest.Stream, pkt *rtp.Packet) {
+		ps.pushIngest(signalID, stream, pkt)
+	})
+	if err != nil {
+		return err
+	}
+	ps.getIngests().Set(signalID, source)
+	if state := ps.getRoom(); state != nil {
+		state.Join(signalID, "")
+	}
+
+	logs.Info(fmt.Sprintf("Start ingest %s", signalID))
+	return nil
+}
+
+// StartRTSP pull a camera and mix it as participant signalID, reconnect until stopped
+func (ps *Peers) StartRTSP(signalID, url, transport string) error {
+	if ps.hasParticipant(signalID) {
+		return fmt.Errorf("Participant %s already exists", signalID)
+	}
+	if transport != rtsp.TransportTCP && transport != rtsp.TransportUDP {
+		return fmt.Errorf("Invalid rtsp transport: %s", transport)
+	}
+
+	source := rtsp.NewSource(url, transport, func(stream *ingest.Stream, pkt *rtp.Packet) {
+		ps.pushIngest(signalID, stream, pkt)
+	})
+	ps.getIngests().Set(signalID, source)
+	if state := ps.getRoom(); state != nil {
+		state.Join(signalID, "")
+	}
+	source.Start()
+
+	logs.Info(fmt.Sprintf("Start rtsp ingest %s", signalID))
+	return nil
+}
+
+// hasParticipant check signalID is connected, ingested or a cascade child
+func (ps *Peers) hasParticipant(signalID string) bool {
+	return ps.getConn(signalID) != nil || ps.getIngest(signalID) != nil || ps.isChild(signalID)
+}
+
+// StopIngest remove virtual participant signalID from the mixer
+func (ps *Peers) StopIngest(signalID string) {
+	source := ps.getIngest(signalID)
+	if source == nil {
+		return
+	}
+	ps.getIngests().Delete(signalID)
+	source.Close()
+
+	ps.removeParticipant(signalID)
+	logs.Info(fmt.Sprintf("Stop ingest %s", signalID))
+}
+
+// removeParticipant forget a virtual participant everywhere it was mixed
+func (ps *Peers) removeParticipant(signalID string) {
+	if mixer := ps.getMixer(); mixer != nil {
+		mixer.RemoveVideoStream(signalID)
+		mixer.RemoveAudioStream(signalID)
+	}
+
+	if rec := ps.getRecorder(); rec != nil {
+		rec.Release(signalID)
+	}
+
+	if thumbs := ps.getThumbnails(); thumbs != nil {
+		thumbs.Remove(signalID)
+	}
+
+	if tap := ps.getPCM(); tap != nil {
+		tap.Remove(signalID)
+	}
+	if gains := ps.getGains(); gains != nil {
+		gains.Remove(signalID)
+	}
+
+	if ctrl := ps.getLayout(); ctrl != nil {
+		ctrl.Remove(signalID)
+	}
+
+	if state := ps.getRoom(); state != nil {
+		state.Leave(signalID)
+	}
+}
+
+// pushIngest feed a packet of virtual participant to mixer and recorder
+func (ps *Peers) pushIngest(signalID string, stream *ingest.Stream, pkt *rtp.Packet) {
+	// packets flushed after stop are dropped
+	if ps.getIngest(signalID) == nil {
+		return
+	}
+	ps.pushVirtual(signalID, stream, pkt)
+}
+
+// pushVirtual feed a packet of an ingest or cascade child to mixer and recorder
+func (ps *Peers) pushVirtual(signalID string, stream *ingest.Stream, pkt *rtp.Packet) {
+
+	if rec := ps.getRecorder(); rec != nil {
+		rec.Push(signalID, stream.Kind, stream.Codec, stream.ClockRate, stream.Channels, pkt)
+	}
+	if state := ps.getRoom(); state != nil {
+		state.SetTrack(signalID, stream.Kind)
+	}
+	if !ps.isForwarded(signalID, stream.Kind) {
+		return
+	}
+
+	if thumbs := ps.getThumbnails(); thumbs != nil && stream.Kind == "video" {
+		thumbs.Push(signalID, pkt)
+	}
+	if tap := ps.getPCM(); tap != nil && stream.Kind == "audio" {
+		tap.Push(signalID, pkt)
+	}
+
+	mixer := ps.getMixer()
+	if mixer == nil || !ps.isMixed(stream.Kind) {
+		return
+	}
+	switch stream.Kind {
+	case "video":
+		mixer.PushVideoStream(signalID, pkt)
+	case "audio":
+		mixer.PushAudioStream(signalID, ps.adjustAudio(signalID, stream.Codec, pkt))
+	}
+}
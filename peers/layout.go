@@ -0,0 +1,109 @@
+package peers
+
+import (
+	"fmt"
+	"image"
+
+	"github.com/lamhai1401/gologs/logs"
+	"github.com/lamhai1401/testrtc/layout"
+	"github.com/lamhai1401/testrtc/mixer"
+	"github.com/mitchellh/mapstructure"
+)
+
+func (ps *Peers) handleLayoutEvent(values []interface{}) error {
+	if len(values) < 1 {
+		return fmt.Errorf("Missing layout")
+	}
+
+	var data layout.Layout
+	if err := mapstructure.Decode(values[0], &data); err != nil {
+		return fmt.Errorf("Invalid layout: %v", err)
+	}
+	return ps.SetLayout(&data)
+}
+
+// SetLayout change composition of the mixed video without restarting streams, refused
+// when the mixer neither places videos nor selects one
+func (ps *Peers) SetLayout(data *layout.Layout) error {
+	ctrl := ps.getLayout()
+	if ctrl == nil {
+		return fmt.Errorf("Layout controller is nil")
+	}
+	if !ps.canLayout() {
+		return fmt.Errorf("Mixer does not support layout")
+	}
+	if err := ctrl.SetLayout(data); err != nil {
+		return err
+	}
+	ps.selectSource("")
+	logs.Info(fmt.Sprintf("Layout is %s", data.Preset))
+	return nil
+}
+
+// canLayout check the mixer applies a layout, by placing every video or forwarding the focus
+func (ps *Peers) canLayout() bool {
+	switch ps.getMixer().(type) {
+	case mixer.Placer, mixer.Selector:
+		return true
+	default:
+		return false
+	}
+}
+
+// selectSource forward the focus of the layout, or the dominant speaker without one,
+// when the mixer forwards a single participant
+func (ps *Peers) selectSource(dominantID string) {
+	selector, ok := ps.getMixer().(mixer.Selector)
+	if !ok {
+		return
+	}
+	if ctrl := ps.getLayout(); ctrl != nil {
+		if focus := ctrl.GetLayout().Focus; focus != "" {
+			selector.Select(focus)
+			return
+		}
+	}
+	if dominantID != "" {
+		selector.Select(dominantID)
+	}
+}
+
+// selectedSeat seat of the participant forwarded by the mixer, 0 when it mixes everyone
+func (ps *Peers) selectedSeat() int {
+	selector, ok := ps.getMixer().(mixer.Selector)
+	if !ok {
+		return 0
+	}
+	if seats := ps.getSeats(); seats != nil {
+		return seats.Get(selector.GetSelected())
+	}
+	return 0
+}
+
+// GetLayout current layout and regions of the mixed video, no regions when the mixer keeps its own composition
+func (ps *Peers) GetLayout() (*layout.Layout, []*layout.Region) {
+	ctrl := ps.getLayout()
+	if ctrl == nil {
+		return nil, nil
+	}
+	if _, ok := ps.getMixer().(mixer.Placer); !ok {
+		return ctrl.GetLayout(), nil
+	}
+	return ctrl.GetLayout(), ctrl.GetRegions()
+}
+
+// applyLayout place videos in the mixer and tell everyone in room. Regions of a mixer
+// keeping its own composition are not where videos are, so they are not sent
+func (ps *Peers) applyLayout(regions []*layout.Region) {
+	placer, ok := ps.getMixer().(mixer.Placer)
+	if !ok {
+		return
+	}
+	for _, region := range regions {
+		rect := image.Rect(region.X, region.Y, region.X+region.Width, region.Y+region.Height)
+		if err := placer.SetVideoRegion(region.SignalID, rect, region.Z); err != nil {
+			logs.Error(fmt.Sprintf("Set video region of %s err: %v", region.SignalID, err))
+		}
+	}
+	ps.sendLayout(regions)
+}
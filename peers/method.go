@@ -3,14 +3,32 @@ package peers
 import (
 	"fmt"
 	"io"
+	"strings"
 	"time"
 
-	v2 "github.com/beowulflab/mixer-v2/v2"
-	"github.com/beowulflab/rtcbase-v2/utils"
 	"github.com/beowulflab/signal/signal-wss"
 	"github.com/lamhai1401/gologs/logs"
+	"github.com/lamhai1401/testrtc/avsync"
+	"github.com/lamhai1401/testrtc/cascade"
+	"github.com/lamhai1401/testrtc/gain"
+	"github.com/lamhai1401/testrtc/hls"
+	"github.com/lamhai1401/testrtc/layout"
+	"github.com/lamhai1401/testrtc/mixer"
+	"github.com/lamhai1401/testrtc/pcm"
 	"github.com/lamhai1401/testrtc/peer"
+	"github.com/lamhai1401/testrtc/placeholder"
+	"github.com/lamhai1401/testrtc/recorder"
+	"github.com/lamhai1401/testrtc/rendition"
+	"github.com/lamhai1401/testrtc/room"
+	"github.com/lamhai1401/testrtc/rtmp"
+	"github.com/lamhai1401/testrtc/seat"
+	"github.com/lamhai1401/testrtc/speaker"
+	"github.com/lamhai1401/testrtc/stats"
+	"github.com/lamhai1401/testrtc/thumbnail"
+	"github.com/lamhai1401/testrtc/upload"
+	"github.com/lamhai1401/testrtc/utils"
 	"github.com/pion/rtcp"
+	"github.com/pion/rtp"
 	"github.com/pion/webrtc/v2"
 )
 
@@ -50,6 +68,351 @@ func (ps *Peers) sendError(id, session string, reason interface{}) {
 	}
 }
 
+func (ps *Peers) sendStats(report *stats.Report) {
+	if signal := ps.getSignal(); signal != nil {
+		signal.Send(report.SignalID, report.SessionID, "stats", report)
+	}
+}
+
+// broadcast send event with payload to everyone in room
+func (ps *Peers) broadcast(event string, payload interface{}) {
+	signal := ps.getSignal()
+	conns := ps.getConns()
+	if signal == nil || conns == nil {
+		return
+	}
+	conns.Iter(func(key, value interface{}) bool {
+		if peer, ok := value.(*peer.Peer); ok {
+			signal.Send(peer.GetSignalID(), peer.GetSessionID(), event, payload)
+		}
+		return true
+	})
+}
+
+func (ps *Peers) sendDominantSpeaker(dominantID string) {
+	logs.Info(fmt.Sprintf("Dominant speaker is %s", dominantID))
+	if ctrl := ps.getLayout(); ctrl != nil {
+		ctrl.SetDominant(dominantID)
+	}
+	ps.selectSource(dominantID)
+	ps.broadcast("dominant-speaker", dominantID)
+}
+
+// sendLayout tell everyone in room where videos are in the mix
+func (ps *Peers) sendLayout(regions []*layout.Region) {
+	ps.broadcast("layout", regions)
+}
+
+// sendSeats tell everyone in room who sits where in the mix,
+// nobody when the mixer places videos by itself and seats are not where they are
+func (ps *Peers) sendSeats(seats []*seat.Seat) {
+	if !ps.canLayout() {
+		return
+	}
+	ps.broadcast("seats", seats)
+}
+
+// sendRoomState tell everyone in room who is in it and who is moderated
+func (ps *Peers) sendRoomState(participants []*room.Participant) {
+	ps.broadcast("room-state", participants)
+}
+
+// sendRecordUploaded tell everyone in room a recording is uploaded or failed
+func (ps *Peers) sendRecordUploaded(result *upload.Result) {
+	ps.broadcast("record-uploaded", result)
+}
+
+func (ps *Peers) getVideoFwdm() utils.Fwdm {
+	ps.mutex.RLock()
+	defer ps.mutex.RUnlock()
+	return ps.videoFwdm
+}
+
+func (ps *Peers) getAudioFwdm() utils.Fwdm {
+	ps.mutex.RLock()
+	defer ps.mutex.RUnlock()
+	return ps.audioFwdm
+}
+
+func (ps *Peers) getFwdm(kind string) utils.Fwdm {
+	switch kind {
+	case "video":
+		return ps.getVideoFwdm()
+	case "audio":
+		return ps.getAudioFwdm()
+	default:
+		return nil
+	}
+}
+
+// register a client to mixer output of kind
+func (ps *Peers) register(kind, clientID string, handler func(wrapper *utils.Wrapper) error) {
+	if fwdm := ps.getFwdm(kind); fwdm != nil {
+		fwdm.Register(ps.getID(), clientID, handler)
+	}
+}
+
+func (ps *Peers) unregister(kind, clientID string) {
+	if fwdm := ps.getFwdm(kind); fwdm != nil {
+		fwdm.Unregister(ps.getID(), clientID)
+	}
+}
+
+// registerRendition handler of video rendition name
+func (ps *Peers) registerRendition(name, clientID string, handler func(wrapper *utils.Wrapper) error) {
+	if fwdm := ps.getVideoFwdm(); fwdm != nil {
+		fwdm.Register(ps.renditionID(name), clientID, handler)
+	}
+}
+
+func (ps *Peers) unregisterRendition(name, clientID string) {
+	if fwdm := ps.getVideoFwdm(); fwdm != nil {
+		fwdm.Unregister(ps.renditionID(name), clientID)
+	}
+}
+
+// renditionID forwarder of rendition name, the first is the mixer output everything else gets
+func (ps *Peers) renditionID(name string) string {
+	if renditions := ps.getRenditions(); len(renditions) > 0 && renditions[0].Name == name {
+		return ps.getID()
+	}
+	return ps.getID() + "_" + name
+}
+
+// getRenditions of the mixed video, the first one first
+func (ps *Peers) getRenditions() []mixer.Rendition {
+	ps.mutex.RLock()
+	defer ps.mutex.RUnlock()
+	if ps.config == nil {
+		return nil
+	}
+	return ps.config.GetRenditions()
+}
+
+func (ps *Peers) getViewers() *utils.AdvanceMap {
+	ps.mutex.RLock()
+	defer ps.mutex.RUnlock()
+	return ps.viewers
+}
+
+func (ps *Peers) getViewer(signalID string) *rendition.Viewer {
+	value, ok := ps.getViewers().Get(signalID)
+	if !ok {
+		return nil
+	}
+	viewer, ok := value.(*rendition.Viewer)
+	if !ok {
+		return nil
+	}
+	return viewer
+}
+
+func (ps *Peers) getMixedRecorder() *recorder.MixedRecorder {
+	ps.mutex.RLock()
+	defer ps.mutex.RUnlock()
+	return ps.mixedRec
+}
+
+func (ps *Peers) setMixedRecorder(rec *recorder.MixedRecorder) {
+	ps.mutex.Lock()
+	defer ps.mutex.Unlock()
+	ps.mixedRec = rec
+}
+
+func (ps *Peers) getHLS() *hls.Packager {
+	ps.mutex.RLock()
+	defer ps.mutex.RUnlock()
+	return ps.hls
+}
+
+func (ps *Peers) setHLS(packager *hls.Packager) {
+	ps.mutex.Lock()
+	defer ps.mutex.Unlock()
+	ps.hls = packager
+}
+
+func (ps *Peers) getEgresses() *utils.AdvanceMap {
+	ps.mutex.RLock()
+	defer ps.mutex.RUnlock()
+	return ps.egresses
+}
+
+func (ps *Peers) getEgress(url string) *rtmp.Egress {
+	value, ok := ps.getEgresses().Get(url)
+	if !ok {
+		return nil
+	}
+	egress, ok := value.(*rtmp.Egress)
+	if !ok {
+		return nil
+	}
+	return egress
+}
+
+func (ps *Peers) getIngests() *utils.AdvanceMap {
+	ps.mutex.RLock()
+	defer ps.mutex.RUnlock()
+	return ps.ingests
+}
+
+func (ps *Peers) getIngest(signalID string) ingestSource {
+	value, ok := ps.getIngests().Get(signalID)
+	if !ok {
+		return nil
+	}
+	source, ok := value.(ingestSource)
+	if !ok {
+		return nil
+	}
+	return source
+}
+
+func (ps *Peers) getUploader() *upload.Uploader {
+	ps.mutex.RLock()
+	defer ps.mutex.RUnlock()
+	return ps.uploader
+}
+
+func (ps *Peers) getThumbnails() *thumbnail.Store {
+	ps.mutex.RLock()
+	defer ps.mutex.RUnlock()
+	return ps.thumbs
+}
+
+func (ps *Peers) getPCM() *pcm.Tap {
+	ps.mutex.RLock()
+	defer ps.mutex.RUnlock()
+	return ps.pcm
+}
+
+func (ps *Peers) getPCMServer() *pcm.SocketServer {
+	ps.mutex.RLock()
+	defer ps.mutex.RUnlock()
+	return ps.pcmServer
+}
+
+func (ps *Peers) getLayout() *layout.Controller {
+	ps.mutex.RLock()
+	defer ps.mutex.RUnlock()
+	return ps.layout
+}
+
+func (ps *Peers) getRoom() *room.State {
+	ps.mutex.RLock()
+	defer ps.mutex.RUnlock()
+	return ps.room
+}
+
+func (ps *Peers) getTiles() *placeholder.Manager {
+	ps.mutex.RLock()
+	defer ps.mutex.RUnlock()
+	return ps.tiles
+}
+
+func (ps *Peers) getGains() *gain.Control {
+	ps.mutex.RLock()
+	defer ps.mutex.RUnlock()
+	return ps.gains
+}
+
+func (ps *Peers) getLimiter() *gain.MixLimiter {
+	ps.mutex.RLock()
+	defer ps.mutex.RUnlock()
+	return ps.limiter
+}
+
+func (ps *Peers) getChildren() *cascade.Server {
+	ps.mutex.RLock()
+	defer ps.mutex.RUnlock()
+	return ps.children
+}
+
+func (ps *Peers) setChildren(server *cascade.Server) {
+	ps.mutex.Lock()
+	defer ps.mutex.Unlock()
+	ps.children = server
+}
+
+// isChild check signalID is the sub-mix of a node one level below
+func (ps *Peers) isChild(signalID string) bool {
+	children := ps.getChildren()
+	return children != nil && children.HasChild(signalID)
+}
+
+func (ps *Peers) getUplink() *cascade.Uplink {
+	ps.mutex.RLock()
+	defer ps.mutex.RUnlock()
+	return ps.uplink
+}
+
+func (ps *Peers) setUplink(uplink *cascade.Uplink) {
+	ps.mutex.Lock()
+	defer ps.mutex.Unlock()
+	ps.uplink = uplink
+}
+
+func (ps *Peers) getSeats() *seat.Manager {
+	ps.mutex.RLock()
+	defer ps.mutex.RUnlock()
+	return ps.seats
+}
+
+// isForwarded check kind of signalID is not muted or hidden by a moderator
+func (ps *Peers) isForwarded(signalID, kind string) bool {
+	state := ps.getRoom()
+	if state == nil {
+		return true
+	}
+	switch kind {
+	case "audio":
+		return !state.IsAudioMuted(signalID)
+	case "video":
+		return !state.IsVideoHidden(signalID)
+	default:
+		return true
+	}
+}
+
+func (ps *Peers) getRecorder() *recorder.Recorder {
+	ps.mutex.RLock()
+	defer ps.mutex.RUnlock()
+	return ps.recorder
+}
+
+func (ps *Peers) getSpeaker() *speaker.Detector {
+	ps.mutex.RLock()
+	defer ps.mutex.RUnlock()
+	return ps.speaker
+}
+
+// evaluateSpeaker pick dominant speaker from smoothed audio levels
+func (ps *Peers) evaluateSpeaker() {
+	ticker := time.NewTicker(time.Millisecond * 300)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ps.closed:
+			return
+		case <-ticker.C:
+			if detector := ps.getSpeaker(); detector != nil {
+				detector.Evaluate(time.Now())
+			}
+		}
+	}
+}
+
+// setClosed return false if room was already closed
+func (ps *Peers) setClosed() bool {
+	ps.mutex.Lock()
+	defer ps.mutex.Unlock()
+	if ps.isClosed {
+		return false
+	}
+	ps.isClosed = true
+	close(ps.closed)
+	return true
+}
+
 func (ps *Peers) getConns() *utils.AdvanceMap {
 	ps.mutex.RLock()
 	defer ps.mutex.RUnlock()
@@ -84,6 +447,9 @@ func (ps *Peers) getConfig() *webrtc.Configuration {
 func (ps *Peers) addConn(id, session string) (*peer.Peer, error) {
 	peer := peer.NewPeer(&ps.bitrate, session, id)
 	ps.setConn(id, peer)
+	if state := ps.getRoom(); state != nil {
+		state.Join(id, session)
+	}
 	return peer, nil
 }
 
@@ -96,12 +462,45 @@ func (ps *Peers) deleteConn(id string) {
 func (ps *Peers) closeConn(id string) {
 	if conn := ps.getConn(id); conn != nil {
 		ps.deleteConn(id)
+		ps.unsubscribe(conn.GetSignalID())
 		conn.Close()
 
 		if mixer := ps.getMixer(); mixer != nil {
 			mixer.RemoveVideoStream(conn.GetSignalID())
 			mixer.RemoveAudioStream(conn.GetSignalID())
 		}
+
+		if detector := ps.getSpeaker(); detector != nil {
+			detector.Remove(conn.GetSignalID())
+		}
+
+		if rec := ps.getRecorder(); rec != nil {
+			rec.Release(conn.GetSignalID())
+		}
+
+		if thumbs := ps.getThumbnails(); thumbs != nil {
+			thumbs.Remove(conn.GetSignalID())
+		}
+
+		if tap := ps.getPCM(); tap != nil {
+			tap.Remove(conn.GetSignalID())
+		}
+		if gains := ps.getGains(); gains != nil {
+			gains.Remove(conn.GetSignalID())
+		}
+
+		if ctrl := ps.getLayout(); ctrl != nil {
+			ctrl.Remove(conn.GetSignalID())
+		}
+
+		if state := ps.getRoom(); state != nil {
+			state.Leave(conn.GetSignalID())
+		}
+
+		// a role comes with the token of a connection, joining again needs a token again
+		if seats := ps.getSeats(); seats != nil {
+			seats.SetRole(conn.GetSignalID(), "")
+		}
 		conn = nil
 	}
 }
@@ -123,18 +522,13 @@ func (ps *Peers) handleConnEvent(peer *peer.Peer) {
 		case "connected":
 			if !peer.CheckConnected() {
 				peer.SetConnected()
-				// register video source
-				// ps.register(mixerID, peer.GetSignalID(), func(wrapper *utils.Wrapper) error {
-				// 	err := peer.AddVideoRTP(&wrapper.Pkg)
-				// 	if err != nil {
-				// 		return err
-				// 	}
-				// 	logs.Stack(fmt.Sprintf("Write mixer video rtp to %s", peer.GetSignalID()))
-				// 	return nil
-				// })
-
-				// register audio source
-
+				go peer.ServeStats(utils.GetStatsInterval(), ps.sendStats)
+				if _, regions := ps.GetLayout(); regions != nil {
+					if signal := ps.getSignal(); signal != nil {
+						signal.Send(peer.GetSignalID(), peer.GetSessionID(), "layout", regions)
+					}
+				}
+				ps.subscribe(peer)
 			}
 			break
 		case "closed":
@@ -165,6 +559,64 @@ func (ps *Peers) handleConnEvent(peer *peer.Peer) {
 
 		fmt.Printf("Track has started, of type %d: %s \n", remoteTrack.PayloadType(), remoteTrack.Codec().Name)
 
+		// read sender reports for lip sync
+		go peer.HandleRTCP(remoteTrack, r)
+		synchronizer := peer.GetSynchronizer()
+
+		// hold the earlier of audio and video so both reach the mixer in sync
+		delayer := avsync.NewDelayer(func(pkt *rtp.Packet) {
+			if !ps.isForwarded(peer.GetSignalID(), kind) || !ps.isMixed(kind) {
+				return
+			}
+			switch kind {
+			case "video":
+				mixer.PushVideoStream(peer.GetSignalID(), pkt)
+			case "audio":
+				// packets come unwrapped from red, their payload type is the one of the media
+				codec := ""
+				if media := peer.GetCodec(pkt.PayloadType); media != nil {
+					codec = media.Name
+				}
+				mixer.PushAudioStream(peer.GetSignalID(), ps.adjustAudio(peer.GetSignalID(), codec, pkt))
+				break
+			default:
+				logs.Error(fmt.Sprintf("Remote track kind %s", kind))
+			}
+		})
+		defer delayer.Close()
+
+		// count packets for stats
+		inbound := peer.NewInboundStats(remoteTrack)
+
+		detector := ps.getSpeaker()
+		rec := ps.getRecorder()
+		thumbs := ps.getThumbnails()
+		tap := ps.getPCM()
+
+		if state := ps.getRoom(); state != nil {
+			state.SetTrack(peer.GetSignalID(), kind)
+		}
+
+		// unwrap red and recover lost packets, then reorder them by sequence number.
+		// packets leave the buffer in order, those held past the latency also when the track pauses
+		chain := newTrackChain(peer.NewFECReceiver(kind), peer.NewJitterBuffer(kind), peer.GetCodec, remoteTrack.Codec(), func(pkt *rtp.Packet, codec *webrtc.RTPCodec) {
+			if rec != nil {
+				rec.Push(peer.GetSignalID(), kind, codec.Name, codec.ClockRate, codec.Channels, pkt)
+			}
+			forwarded := ps.isForwarded(peer.GetSignalID(), kind)
+			// only vp8 keyframes can be decoded to thumbnails
+			if thumbs != nil && forwarded && kind == "video" && strings.EqualFold(codec.Name, webrtc.VP8) {
+				thumbs.Push(peer.GetSignalID(), pkt)
+			}
+			// only opus can be decoded to pcm
+			if tap != nil && forwarded && kind == "audio" && strings.EqualFold(codec.Name, webrtc.Opus) {
+				tap.Push(peer.GetSignalID(), pkt)
+			}
+			synchronizer.Update(kind, pkt, time.Now())
+			delayer.Push(pkt, synchronizer.Delay(kind))
+		})
+		defer chain.Close()
+
 		for {
 			// Read RTP packets being sent to Pion
 			rtp, readErr := remoteTrack.ReadRTP()
@@ -175,21 +627,30 @@ func (ps *Peers) handleConnEvent(peer *peer.Peer) {
 				panic(readErr)
 			}
 
-			switch kind {
-			case "video":
-				mixer.PushVideoStream(peer.GetSignalID(), rtp)
-			case "audio":
-				mixer.PushAudioStream(peer.GetSignalID(), rtp)
-				break
-			default:
-				logs.Error(fmt.Sprintf("Remote track kind %s", kind))
+			peer.CaptureRTP(kind, rtp, time.Now())
+			inbound.OnPacket(rtp, time.Now())
+
+			if level, ok := peer.GetAudioLevel(rtp); ok && detector != nil && ps.isForwarded(peer.GetSignalID(), kind) {
+				detector.Update(peer.GetSignalID(), level, time.Now())
 			}
+
+			chain.Push(rtp)
 			rtp = nil
 		}
 	})
 }
 
-func (ps *Peers) getMixer() v2.Mixer {
+// isMixed check kind is mixed in this room
+func (ps *Peers) isMixed(kind string) bool {
+	ps.mutex.RLock()
+	defer ps.mutex.RUnlock()
+	if ps.config == nil {
+		return true
+	}
+	return (kind == "video" && ps.config.Video) || (kind == "audio" && ps.config.Audio)
+}
+
+func (ps *Peers) getMixer() mixer.Mixer {
 	ps.mutex.RLock()
 	defer ps.mutex.RUnlock()
 	return ps.mixer
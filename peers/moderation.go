@@ -0,0 +1,180 @@
+package peers
+
+import (
+	"fmt"
+
+	"github.com/lamhai1401/gologs/logs"
+	"github.com/lamhai1401/testrtc/room"
+)
+
+func (ps *Peers) handleModerationEvent(event string, values []interface{}) error {
+	if len(values) < 1 {
+		return fmt.Errorf("Missing signalID to %s", event)
+	}
+	target, ok := values[0].(string)
+	if !ok || target == "" {
+		return fmt.Errorf("Invalid signalID to %s: %v", event, values[0])
+	}
+
+	switch event {
+	case "mute-audio":
+		return ps.MuteAudio(target, true)
+	case "unmute-audio":
+		return ps.MuteAudio(target, false)
+	case "hide-video":
+		return ps.HideVideo(target, true)
+	case "show-video":
+		return ps.HideVideo(target, false)
+	default:
+		reason := ""
+		if len(values) > 1 {
+			reason, _ = values[1].(string)
+		}
+		return ps.Kick(target, reason)
+	}
+}
+
+// GetRoomState participants in join order with their moderation
+func (ps *Peers) GetRoomState() []*room.Participant {
+	state := ps.getRoom()
+	if state == nil {
+		return nil
+	}
+	return state.List()
+}
+
+// MuteAudio stop or resume mixing audio of signalID, the client is told but keep sending
+func (ps *Peers) MuteAudio(signalID string, muted bool) error {
+	state := ps.getRoom()
+	if state == nil || state.Get(signalID) == nil {
+		return fmt.Errorf("Participant %s is not in room", signalID)
+	}
+	if !state.SetAudioMuted(signalID, muted) {
+		return nil
+	}
+
+	event := "audio-unmuted"
+	if muted {
+		event = "audio-muted"
+		if mixer := ps.getMixer(); mixer != nil {
+			mixer.RemoveAudioStream(signalID)
+		}
+		if detector := ps.getSpeaker(); detector != nil {
+			detector.Remove(signalID)
+		}
+	}
+	ps.notifyParticipant(signalID, event, signalID)
+	logs.Info(fmt.Sprintf("%s is %s", signalID, event))
+	return nil
+}
+
+// HideVideo stop or resume mixing video of signalID, the client is told but keep sending
+func (ps *Peers) HideVideo(signalID string, hidden bool) error {
+	state := ps.getRoom()
+	if state == nil || state.Get(signalID) == nil {
+		return fmt.Errorf("Participant %s is not in room", signalID)
+	}
+	if !state.SetVideoHidden(signalID, hidden) {
+		return nil
+	}
+
+	// the mixer and layout follow the room in syncTiles
+	event := "video-shown"
+	if hidden {
+		event = "video-hidden"
+	}
+	ps.notifyParticipant(signalID, event, signalID)
+	logs.Info(fmt.Sprintf("%s is %s", signalID, event))
+	return nil
+}
+
+// onRoomChange keep seats and tiles of the mix in line with the room before telling everyone
+func (ps *Peers) onRoomChange(participants []*room.Participant) {
+	ps.syncSeats(participants)
+	ps.syncTiles(participants)
+	ps.sendRoomState(participants)
+}
+
+// syncTiles give every participant its video, a placeholder or nothing in the mix.
+// Placeholders stand for audio-only and hidden participants and show whether they are muted
+func (ps *Peers) syncTiles(participants []*room.Participant) {
+	mixer := ps.getMixer()
+	ctrl := ps.getLayout()
+	tiles := ps.getTiles()
+
+	present := make(map[string]bool, len(participants))
+	for _, participant := range participants {
+		id := participant.SignalID
+		present[id] = true
+
+		showVideo := participant.HasVideo && !participant.VideoHidden
+		showTile := tiles != nil && !showVideo && (participant.HasAudio || participant.VideoHidden)
+
+		// the video and its placeholder share the same id in the mixer,
+		// so the stream is reset whenever one replaces the other
+		switch {
+		case showVideo:
+			if tiles != nil && tiles.Remove(id) && mixer != nil {
+				mixer.RemoveVideoStream(id)
+			}
+		case showTile:
+			if !tiles.Has(id) && participant.VideoHidden && mixer != nil {
+				mixer.RemoveVideoStream(id)
+			}
+			tiles.Set(id, participant.AudioMuted)
+		default:
+			removed := tiles != nil && tiles.Remove(id)
+			if (removed || participant.VideoHidden) && mixer != nil {
+				mixer.RemoveVideoStream(id)
+			}
+		}
+
+		if ctrl != nil {
+			if showVideo || showTile {
+				ctrl.Add(id)
+			} else {
+				ctrl.Remove(id)
+			}
+		}
+	}
+
+	if tiles == nil {
+		return
+	}
+	for _, id := range tiles.GetIDs() {
+		if !present[id] && tiles.Remove(id) && mixer != nil {
+			mixer.RemoveVideoStream(id)
+		}
+	}
+}
+
+// Kick remove signalID from room, the client is told with reason before its connection is closed
+func (ps *Peers) Kick(signalID, reason string) error {
+	if ps.getIngest(signalID) != nil {
+		ps.StopIngest(signalID)
+		return nil
+	}
+	if children := ps.getChildren(); children != nil && children.HasChild(signalID) {
+		children.Drop(signalID)
+		return nil
+	}
+	if ps.getConn(signalID) == nil {
+		return fmt.Errorf("Participant %s is not in room", signalID)
+	}
+
+	ps.notifyParticipant(signalID, "kicked", reason)
+	ps.closeConn(signalID)
+	logs.Info(fmt.Sprintf("%s is kicked: %s", signalID, reason))
+	return nil
+}
+
+// notifyParticipant send event to a webrtc participant, ingests have nobody to tell
+func (ps *Peers) notifyParticipant(signalID, event string, value interface{}) {
+	conn := ps.getConn(signalID)
+	if conn == nil {
+		return
+	}
+	if signal := ps.getSignal(); signal != nil {
+		signal.Send(conn.GetSignalID(), conn.GetSessionID(), event, value)
+	}
+}
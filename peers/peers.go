@@ -3,47 +3,219 @@ package peers
 import (
 	"fmt"
 	"sync"
+	"time"
 
-	v2 "github.com/beowulflab/mixer-v2/v2"
-	"github.com/beowulflab/rtcbase-v2/utils"
 	"github.com/beowulflab/signal/signal-wss"
 	"github.com/lamhai1401/gologs/logs"
+	"github.com/lamhai1401/testrtc/auth"
+	"github.com/lamhai1401/testrtc/cascade"
+	"github.com/lamhai1401/testrtc/gain"
+	"github.com/lamhai1401/testrtc/hls"
+	"github.com/lamhai1401/testrtc/layout"
+	"github.com/lamhai1401/testrtc/mixer"
+	"github.com/lamhai1401/testrtc/pcm"
+	"github.com/lamhai1401/testrtc/placeholder"
+	"github.com/lamhai1401/testrtc/recorder"
+	"github.com/lamhai1401/testrtc/room"
+	"github.com/lamhai1401/testrtc/rtsp"
+	"github.com/lamhai1401/testrtc/seat"
+	"github.com/lamhai1401/testrtc/speaker"
+	"github.com/lamhai1401/testrtc/thumbnail"
+	"github.com/lamhai1401/testrtc/upload"
+	"github.com/lamhai1401/testrtc/utils"
+	"github.com/pion/rtp"
 	"github.com/pion/webrtc/v2"
 )
 
 const (
-	mixerID = "mixedStreamID"
+	mixedRecorderID = "mixedRecorder"
+	hlsID           = "hls"
+	hlsPath         = "/hls/"
+	thumbnailID     = "thumbnail"
+	thumbnailPath   = "/thumbnails/"
+	pcmID           = "pcm"
+	cascadeID       = "cascade"
+	adaptInterval   = 2 * time.Second // between rendition choices of a viewer
+	rtmpIDPrefix    = "rtmp_"
+	placeholderFPS  = 2
+	mixedChannels   = 2
 )
 
 // Peers linter
 type Peers struct {
-	id      string
-	bitrate int
-	signal  *signal.NotifySignal // send socket
-	conns   *utils.AdvanceMap
-	configs *webrtc.Configuration
-	mixer   v2.Mixer
-	mutex   sync.RWMutex
+	id        string
+	bitrate   int
+	signal    *signal.NotifySignal // send socket
+	conns     *utils.AdvanceMap
+	configs   *webrtc.Configuration
+	mixer     mixer.Mixer
+	config    *mixer.Config
+	speaker   *speaker.Detector  // active speaker of this room
+	recorder  *recorder.Recorder // per participant recordings
+	mixedRec  *recorder.MixedRecorder
+	hls       *hls.Packager        // nil is not broadcasting
+	egresses  *utils.AdvanceMap    // url - *rtmp.Egress
+	ingests   *utils.AdvanceMap    // signalID - ingestSource
+	uploader  *upload.Uploader     // nil is keeping recordings on local disk
+	thumbs    *thumbnail.Store     // latest snapshot of participants and mixer
+	pcm       *pcm.Tap             // decoded audio of participants and mixer
+	pcmServer *pcm.SocketServer    // nil is not serving pcm over unix socket
+	layout    *layout.Controller   // where videos are placed in the mix
+	room      *room.State          // participants and moderation
+	seats     *seat.Manager        // stable place of each participant in the mix
+	tiles     *placeholder.Manager // nil is leaving participants without video out of the mix
+	gains     *gain.Control        // audio level of each participant
+	limiter   *gain.MixLimiter     // nil is mixed audio as the mixer made it
+	children  *cascade.Server      // nil is not mixing sub-mixes of a lower level
+	uplink    *cascade.Uplink      // nil is not sending the mix to a higher level
+	viewers   *utils.AdvanceMap    // signalID - *rendition.Viewer
+	videoFwdm utils.Fwdm           // mixer video output
+	audioFwdm utils.Fwdm           // mixer audio output
+	isClosed  bool
+	closed    chan struct{} // stop background loops of the room
+	mutex     sync.RWMutex
 }
 
-// NewPeers litner
-func NewPeers() (*Peers, error) {
+// NewRoomPeers mix room by its config in the MIXERCONFIG file, or by env without a file
+func NewRoomPeers(room string) (*Peers, error) {
+	config, err := mixer.RoomConfig(room)
+	if err != nil {
+		return nil, err
+	}
+	return NewPeers(config)
+}
+
+// NewPeers mix a room by config, nil is the config of the default room
+func NewPeers(config *mixer.Config) (*Peers, error) {
+	if config == nil {
+		return NewRoomPeers(mixer.DefaultRoom)
+	}
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+
 	p := &Peers{
-		id:      mixerID,
-		conns:   utils.NewAdvanceMap(),
-		bitrate: 1000,
-		configs: utils.GetTurns(),
-		mixer: v2.NewMixer(
-			10,
-			"mixedStreamID",
-			1500,
-			true),
-	}
-
-	err := p.mixer.Start()
+		id:       config.StreamID,
+		conns:    utils.NewAdvanceMap(),
+		egresses: utils.NewAdvanceMap(),
+		ingests:  utils.NewAdvanceMap(),
+		viewers:  utils.NewAdvanceMap(),
+		bitrate:  1000,
+		configs:  utils.GetTurns(),
+		config:   config,
+		closed:   make(chan struct{}),
+	}
+
+	m, err := mixer.New(config)
 	if err != nil {
 		return nil, err
 	}
+	if err := m.Start(); err != nil {
+		return nil, err
+	}
+	p.mixer = m
+
+	p.videoFwdm = utils.NewForwarderMannager("video")
+	p.audioFwdm = utils.NewForwarderMannager("audio")
+	p.gains = gain.NewControl(1, utils.IsAudioNormalize())
+	if config.Audio && utils.IsAudioLimiter() {
+		limiter, err := gain.NewMixLimiter(mixedChannels)
+		if err != nil {
+			logs.Error("Start mixed audio limiter err: ", err.Error())
+		} else {
+			p.limiter = limiter
+		}
+	}
+	go p.handleVideoOutputChann(p.getID(), p.mixer.GetMixedVideo())
+	go p.handleAudioOutputChann(p.mixer.GetMixedAudio())
+	if ladder, ok := p.mixer.(mixer.Ladder); ok {
+		// the first rendition is the mixed video above
+		for _, r := range ladder.GetRenditions()[1:] {
+			go p.handleVideoOutputChann(p.renditionID(r.Name), ladder.GetRenditionVideo(r.Name))
+		}
+	}
+
+	p.thumbs = thumbnail.NewStore(utils.GetThumbnailInterval(), utils.GetThumbnailWidth(), nil)
+	p.register("video", thumbnailID, func(wrapper *utils.Wrapper) error {
+		p.thumbs.Push(p.getID(), &wrapper.Pkg)
+		return nil
+	})
+
+	p.pcm = pcm.NewTap(utils.GetPCMSampleRate(), utils.GetPCMChannels(), utils.GetPCMFrameDuration())
+	p.register("audio", pcmID, func(wrapper *utils.Wrapper) error {
+		p.pcm.Push(p.getID(), &wrapper.Pkg)
+		return nil
+	})
+	if path := utils.GetPCMSocket(); path != "" {
+		server, err := pcm.NewSocketServer(p.pcm, path)
+		if err != nil {
+			logs.Error("Serve pcm err: ", err.Error())
+		} else {
+			p.pcmServer = server
+			go server.Serve()
+		}
+	}
+
+	// placeholders are drawn in the mixed video
+	frames, err := placeholder.LoadTiles(utils.GetPlaceholderImage(), utils.GetMutedImage())
+	switch {
+	case !config.Video:
+	case err != nil:
+		logs.Error("Load placeholder tiles err: ", err.Error())
+	default:
+		p.tiles = placeholder.NewManager(frames, placeholderFPS, func(signalID string, pkt *rtp.Packet) {
+			if mixer := p.getMixer(); mixer != nil {
+				mixer.PushVideoStream(signalID, pkt)
+			}
+		})
+	}
+
+	if config.Video && !p.canLayout() {
+		logs.Error(fmt.Sprintf("Mixer %s does not support layout, set-layout and reserve-seat are refused", config.Backend))
+	}
+
+	p.seats = seat.NewManager(config.Inputs, p.sendSeats)
+	for role, number := range utils.GetSeatRoles() {
+		if err := p.seats.Reserve(role, number); err != nil {
+			logs.Error(fmt.Sprintf("Reserve seat of %s err: %v", role, err))
+		}
+	}
+
+	p.room = room.NewState(p.onRoomChange)
+	p.layout = layout.NewController(config.Width, config.Height, p.applyLayout)
+	p.layout.SetOrder(p.seats.Order)
+
+	p.speaker = speaker.NewDetector(p.sendDominantSpeaker)
+	go p.evaluateSpeaker()
+
+	p.recorder = recorder.NewRecorder(utils.GetRecordDir(), recorder.Rotation{
+		MaxSize:     utils.GetRecordMaxSize(),
+		MaxDuration: utils.GetRecordMaxDuration(),
+	})
+	if bucket := utils.GetS3Bucket(); bucket != "" {
+		if err := p.initUploader(bucket); err != nil {
+			logs.Error("Init recording uploader err: ", err.Error())
+		}
+	}
+
+	for _, path := range utils.GetIngestSDPs() {
+		if err := p.startIngestFile(path); err != nil {
+			logs.Error(fmt.Sprintf("Start ingest %s err: %v", path, err))
+		}
+	}
+	for id, url := range utils.GetRTSPSources() {
+		if err := p.StartRTSP(id, url, rtsp.TransportTCP); err != nil {
+			logs.Error(fmt.Sprintf("Start rtsp %s err: %v", id, err))
+		}
+	}
+
+	if err := p.initCascade(utils.NodeLevel); err != nil {
+		logs.Error("Init cascade err: ", err.Error())
+	}
+
+	if addr := utils.GetHTTPAddr(); addr != "" {
+		go p.serveHTTP(addr)
+	}
 
 	sig := signal.NewNotifySignal("123", p.processNotifySignal)
 	go sig.Start()
@@ -51,6 +223,106 @@ func NewPeers() (*Peers, error) {
 	return p, nil
 }
 
+// Close stop recordings and all connections of this room
+func (ps *Peers) Close() {
+	if !ps.setClosed() {
+		return
+	}
+
+	ps.StopMixedRecording()
+	ps.StopHLS()
+	ps.StopRTMP("")
+
+	if uplink := ps.getUplink(); uplink != nil {
+		ps.unregister("video", cascadeID)
+		ps.unregister("audio", cascadeID)
+		uplink.Close()
+	}
+	if children := ps.getChildren(); children != nil {
+		children.Close()
+	}
+
+	for _, id := range ps.getIngests().GetKeys() {
+		ps.StopIngest(id)
+	}
+
+	if rec := ps.getRecorder(); rec != nil {
+		rec.Close()
+	}
+
+	// finish uploads of closed files
+	if uploader := ps.getUploader(); uploader != nil {
+		uploader.Wait()
+	}
+
+	if conns := ps.getConns(); conns != nil {
+		for _, id := range conns.GetKeys() {
+			ps.closeConn(id)
+		}
+	}
+
+	if tiles := ps.getTiles(); tiles != nil {
+		tiles.Close()
+	}
+
+	if server := ps.getPCMServer(); server != nil {
+		server.Close()
+	}
+	if tap := ps.getPCM(); tap != nil {
+		tap.Close()
+	}
+
+	if m := ps.getMixer(); m != nil {
+		m.Close()
+	}
+
+	if fwdm := ps.getVideoFwdm(); fwdm != nil {
+		fwdm.Close()
+	}
+	if fwdm := ps.getAudioFwdm(); fwdm != nil {
+		fwdm.Close()
+	}
+}
+
+// handleVideoOutputChann forward a rendition of the mixed video as id
+func (ps *Peers) handleVideoOutputChann(id string, source chan *rtp.Packet) {
+	fwd := ps.getVideoFwdm().AddNewForwarder(id)
+
+	for {
+		data, open := <-source
+		if !open {
+			return
+		}
+
+		fwd.Push(&utils.Wrapper{
+			Pkg:    *data,
+			Kind:   "video",
+			SeatID: ps.selectedSeat(),
+		})
+	}
+}
+
+func (ps *Peers) handleAudioOutputChann(source chan *rtp.Packet) {
+	fwd := ps.getAudioFwdm().AddNewForwarder(ps.getID())
+	limiter := ps.getLimiter()
+
+	for {
+		data, open := <-source
+		if !open {
+			return
+		}
+		if limiter != nil {
+			data = limiter.Process(data)
+		}
+
+		fwd.Push(&utils.Wrapper{
+			Pkg:    *data,
+			Kind:   "audio",
+			SeatID: ps.selectedSeat(),
+		})
+	}
+}
+
 func (ps *Peers) processNotifySignal(values []interface{}) {
 	if len(values) < 3 {
 		logs.Error("Len of msg < 4")
@@ -79,7 +351,7 @@ func (ps *Peers) processNotifySignal(values []interface{}) {
 	switch event {
 	case "ok":
 		logs.Debug(fmt.Sprintf("Receive ok from id: %s_%s", signalID, sessionID))
-		err = ps.handleOkEvent(signalID, sessionID)
+		err = ps.handleOkEvent(signalID, sessionID, values[3:])
 		break
 	case "candidate":
 		err = ps.handCandidateEvent(signalID, sessionID, values[3])
@@ -88,6 +360,90 @@ func (ps *Peers) processNotifySignal(values []interface{}) {
 		logs.Debug(fmt.Sprintf("Receive sdp from id: %s_%s", signalID, sessionID))
 		err = ps.handleSDPEvent(signalID, sessionID, values[3])
 		break
+	case "start-record":
+		logs.Debug(fmt.Sprintf("Receive start-record from id: %s_%s", signalID, sessionID))
+		err = ps.handleRecordEvent(signalID, values[3:], true)
+		break
+	case "stop-record":
+		logs.Debug(fmt.Sprintf("Receive stop-record from id: %s_%s", signalID, sessionID))
+		err = ps.handleRecordEvent(signalID, values[3:], false)
+		break
+	case "start-capture":
+		logs.Debug(fmt.Sprintf("Receive start-capture from id: %s_%s", signalID, sessionID))
+		err = ps.handleCaptureEvent(signalID, values[3:], true)
+		break
+	case "stop-capture":
+		logs.Debug(fmt.Sprintf("Receive stop-capture from id: %s_%s", signalID, sessionID))
+		err = ps.handleCaptureEvent(signalID, values[3:], false)
+		break
+	case "start-hls":
+		logs.Debug(fmt.Sprintf("Receive start-hls from id: %s_%s", signalID, sessionID))
+		if err = ps.checkModerator(signalID, event); err == nil {
+			err = ps.StartHLS()
+		}
+		break
+	case "stop-hls":
+		logs.Debug(fmt.Sprintf("Receive stop-hls from id: %s_%s", signalID, sessionID))
+		if err = ps.checkModerator(signalID, event); err == nil {
+			ps.StopHLS()
+		}
+		break
+	case "start-rtmp":
+		logs.Debug(fmt.Sprintf("Receive start-rtmp from id: %s_%s", signalID, sessionID))
+		if err = ps.checkModerator(signalID, event); err == nil {
+			err = ps.handleRTMPEvent(values[3:], true)
+		}
+		break
+	case "stop-rtmp":
+		logs.Debug(fmt.Sprintf("Receive stop-rtmp from id: %s_%s", signalID, sessionID))
+		if err = ps.checkModerator(signalID, event); err == nil {
+			err = ps.handleRTMPEvent(values[3:], false)
+		}
+		break
+	case "mute-audio", "unmute-audio", "hide-video", "show-video", "kick":
+		logs.Debug(fmt.Sprintf("Receive %s from id: %s_%s", event, signalID, sessionID))
+		if err = ps.checkModerator(signalID, event); err == nil {
+			err = ps.handleModerationEvent(event, values[3:])
+		}
+		break
+	case "set-gain", "set-normalize":
+		logs.Debug(fmt.Sprintf("Receive %s from id: %s_%s", event, signalID, sessionID))
+		if err = ps.checkModerator(signalID, event); err == nil {
+			err = ps.handleGainEvent(event, values[3:])
+		}
+		break
+	case "reserve-seat":
+		logs.Debug(fmt.Sprintf("Receive reserve-seat from id: %s_%s", signalID, sessionID))
+		if err = ps.checkModerator(signalID, event); err == nil {
+			err = ps.handleSeatEvent(values[3:])
+		}
+		break
+	case "set-rendition":
+		logs.Debug(fmt.Sprintf("Receive set-rendition from id: %s_%s", signalID, sessionID))
+		err = ps.handleRenditionEvent(signalID, values[3:])
+		break
+	case "set-layout":
+		logs.Debug(fmt.Sprintf("Receive set-layout from id: %s_%s", signalID, sessionID))
+		err = ps.handleLayoutEvent(values[3:])
+		break
+	case "start-ingest":
+		logs.Debug(fmt.Sprintf("Receive start-ingest from id: %s_%s", signalID, sessionID))
+		if err = ps.checkModerator(signalID, event); err == nil {
+			err = ps.handleStartIngestEvent(values[3:])
+		}
+		break
+	case "start-rtsp":
+		logs.Debug(fmt.Sprintf("Receive start-rtsp from id: %s_%s", signalID, sessionID))
+		if err = ps.checkModerator(signalID, event); err == nil {
+			err = ps.handleStartRTSPEvent(values[3:])
+		}
+		break
+	case "stop-ingest", "stop-rtsp":
+		logs.Debug(fmt.Sprintf("Receive stop-ingest from id: %s_%s", signalID, sessionID))
+		if err = ps.checkModerator(signalID, event); err == nil {
+			err = ps.handleStopIngestEvent(values[3:])
+		}
+		break
 	}
 
 	if err != nil {
@@ -96,11 +452,34 @@ func (ps *Peers) processNotifySignal(values []interface{}) {
 	}
 }
 
-func (ps *Peers) handleOkEvent(signalID string, sessionID string) error {
+func (ps *Peers) handleOkEvent(signalID string, sessionID string, values []interface{}) error {
+	if token := joinToken(values); token != "" {
+		claims, err := auth.Verify(utils.GetRoleSecret(), token, time.Now())
+		if err != nil {
+			return fmt.Errorf("Refuse role token of %s: %v", signalID, err)
+		}
+		if claims.SignalID != signalID {
+			return fmt.Errorf("Role token of %s was given to %s", claims.SignalID, signalID)
+		}
+		ps.SetRole(signalID, claims.Role)
+	}
 	ps.sendOk(signalID, sessionID)
 	return nil
 }
 
+// joinToken role token in the join payload, only given as an object with token.
+// A role is never taken from the client itself, only from a token the application signed
+func joinToken(values []interface{}) string {
+	if len(values) < 1 {
+		return ""
+	}
+	if value, ok := values[0].(map[string]interface{}); ok {
+		token, _ := value["token"].(string)
+		return token
+	}
+	return ""
+}
+
 func (ps *Peers) handCandidateEvent(signalID string, sessionID string, value interface{}) error {
 	return ps.addCandidate(signalID, sessionID, value)
 }
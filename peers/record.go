@@ -0,0 +1,186 @@
+package peers
+
+import (
+	"fmt"
+
+	"github.com/lamhai1401/gologs/logs"
+	"github.com/lamhai1401/testrtc/recorder"
+	"github.com/lamhai1401/testrtc/upload"
+	"github.com/lamhai1401/testrtc/utils"
+)
+
+// handleRecordEvent start or stop recording the participant in value, or the sender if empty.
+// Only moderators record someone else
+func (ps *Peers) handleRecordEvent(signalID string, values []interface{}, start bool) error {
+	target := signalID
+	if len(values) > 0 {
+		id, ok := values[0].(string)
+		if !ok {
+			return fmt.Errorf("Invalid record signal ID: %v", values[0])
+		}
+		target = id
+	}
+
+	// participants record themselves, others and the mix are up to moderators
+	if target != signalID {
+		if err := ps.checkModerator(signalID, "record "+target); err != nil {
+			return err
+		}
+	}
+
+	// mixer id means the composed session
+	if target == ps.getID() {
+		if start {
+			return ps.StartMixedRecording()
+		}
+		ps.StopMixedRecording()
+		return nil
+	}
+
+	if start {
+		return ps.StartRecording(target)
+	}
+	ps.StopRecording(target)
+	return nil
+}
+
+// StartMixedRecording record mixer output to a webm file
+func (ps *Peers) StartMixedRecording() error {
+	if ps.getMixedRecorder() != nil {
+		return fmt.Errorf("Mixed stream is already recording")
+	}
+
+	rec, err := recorder.NewMixedRecorder(utils.GetRecordDir(), ps.getID())
+	if err != nil {
+		return err
+	}
+	ps.setMixedRecorder(rec)
+
+	// an error returned to the forwarder would stop it, so a bad packet is only logged
+	ps.register("video", mixedRecorderID, func(wrapper *utils.Wrapper) error {
+		if err := rec.PushVideo(&wrapper.Pkg); err != nil {
+			logs.Error(fmt.Sprintf("Record mixed video to %s err: %v", rec.GetPath(), err))
+		}
+		return nil
+	})
+	ps.register("audio", mixedRecorderID, func(wrapper *utils.Wrapper) error {
+		if err := rec.PushAudio(&wrapper.Pkg); err != nil {
+			logs.Error(fmt.Sprintf("Record mixed audio to %s err: %v", rec.GetPath(), err))
+		}
+		return nil
+	})
+	return nil
+}
+
+// StopMixedRecording finalize webm file of mixer output
+func (ps *Peers) StopMixedRecording() {
+	rec := ps.getMixedRecorder()
+	if rec == nil {
+		return
+	}
+	ps.setMixedRecorder(nil)
+
+	ps.unregister("video", mixedRecorderID)
+	ps.unregister("audio", mixedRecorderID)
+	if err := rec.Close(); err != nil {
+		logs.Error(fmt.Sprintf("Close mixed recording %s err: %v", rec.GetPath(), err))
+	}
+
+	if uploader := ps.getUploader(); uploader != nil {
+		uploader.Upload(rec.GetPath())
+	}
+}
+
+// initUploader upload finished recordings to bucket and delete local files
+func (ps *Peers) initUploader(bucket string) error {
+	accessKey, secretKey := utils.GetS3Credentials()
+	client, err := upload.NewClient(upload.Config{
+		Endpoint:  utils.GetS3Endpoint(),
+		Region:    utils.GetS3Region(),
+		Bucket:    bucket,
+		AccessKey: accessKey,
+		SecretKey: secretKey,
+		Prefix:    utils.GetS3Prefix(),
+		PathStyle: utils.IsS3PathStyle(),
+	})
+	if err != nil {
+		return err
+	}
+
+	uploader := upload.NewUploader(client, ps.sendRecordUploaded)
+	ps.mutex.Lock()
+	ps.uploader = uploader
+	ps.mutex.Unlock()
+
+	if rec := ps.getRecorder(); rec != nil {
+		rec.OnFileClosed(uploader.Upload)
+	}
+	return nil
+}
+
+// StartRecording record everything participant publish to files
+func (ps *Peers) StartRecording(signalID string) error {
+	rec := ps.getRecorder()
+	if rec == nil {
+		return fmt.Errorf("Recorder is nil")
+	}
+	return rec.Start(signalID)
+}
+
+// StopRecording linter
+func (ps *Peers) StopRecording(signalID string) {
+	if rec := ps.getRecorder(); rec != nil {
+		rec.Stop(signalID)
+	}
+}
+
+// handleCaptureEvent start or stop dumping packets of the participant in value, or the sender if empty.
+// Only moderators capture someone else
+func (ps *Peers) handleCaptureEvent(signalID string, values []interface{}, start bool) error {
+	target := signalID
+	if len(values) > 0 {
+		id, ok := values[0].(string)
+		if !ok {
+			return fmt.Errorf("Invalid capture signal ID: %v", values[0])
+		}
+		target = id
+	}
+
+	// participants capture themselves, others are up to moderators
+	if target != signalID {
+		if err := ps.checkModerator(signalID, "capture "+target); err != nil {
+			return err
+		}
+	}
+
+	if start {
+		_, err := ps.StartCapture(target)
+		return err
+	}
+	return ps.StopCapture(target)
+}
+
+// StartCapture dump incoming packets of participant to a file, return file path
+func (ps *Peers) StartCapture(signalID string) (string, error) {
+	peer := ps.getConn(signalID)
+	if peer == nil {
+		return "", fmt.Errorf("Connection with id %s is nil", signalID)
+	}
+
+	path, err := peer.StartCapture(utils.GetCaptureDir())
+	if err != nil {
+		return "", err
+	}
+	logs.Info(fmt.Sprintf("Capture %s to %s", signalID, path))
+	return path, nil
+}
+
+// StopCapture linter
+func (ps *Peers) StopCapture(signalID string) error {
+	peer := ps.getConn(signalID)
+	if peer == nil {
+		return fmt.Errorf("Connection with id %s is nil", signalID)
+	}
+	peer.StopCapture()
+	return nil
+}
@@ -0,0 +1,137 @@
+package peers
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/lamhai1401/gologs/logs"
+	"github.com/lamhai1401/testrtc/mixer"
+	"github.com/lamhai1401/testrtc/peer"
+	"github.com/lamhai1401/testrtc/rendition"
+	"github.com/lamhai1401/testrtc/utils"
+)
+
+// subscribe send the mix to peer, video in the rendition its bandwidth allows
+func (ps *Peers) subscribe(peer *peer.Peer) {
+	// an error returned to the forwarder would stop the mix to every viewer,
+	// a viewer failing to write only misses the packet until it is unsubscribed
+	id := peer.GetSignalID()
+	ps.register("audio", id, func(wrapper *utils.Wrapper) error {
+		if err := peer.AddAudioRTP(&wrapper.Pkg); err != nil {
+			logs.Debug(fmt.Sprintf("Write mixed audio to %s err: %v", id, err))
+		}
+		return nil
+	})
+
+	// the viewer gets every rendition and forwards the one it is on
+	renditions := ps.getRenditions()
+	viewer := rendition.NewViewer(renditions, ps.requestKeyframe)
+	ps.getViewers().Set(id, viewer)
+	for _, r := range renditions {
+		name := r.Name
+		ps.registerRendition(name, id, func(wrapper *utils.Wrapper) error {
+			if pkt := viewer.Push(name, &wrapper.Pkg); pkt != nil {
+				if err := peer.AddVideoRTP(pkt); err != nil {
+					logs.Debug(fmt.Sprintf("Write mixed video to %s err: %v", id, err))
+				}
+			}
+			return nil
+		})
+	}
+
+	if len(renditions) > 1 {
+		go ps.adaptRendition(peer, viewer)
+	}
+}
+
+// requestKeyframe of rendition name, a viewer switching to it starts at a keyframe
+func (ps *Peers) requestKeyframe(name string) {
+	switch m := ps.getMixer().(type) {
+	case mixer.Ladder:
+		m.RequestKeyframe(name)
+	case mixer.KeyframeRequester:
+		m.RequestKeyframe()
+	}
+}
+
+// unsubscribe stop sending the mix to signalID
+func (ps *Peers) unsubscribe(signalID string) {
+	ps.unregister("audio", signalID)
+	for _, r := range ps.getRenditions() {
+		ps.unregisterRendition(r.Name, signalID)
+	}
+	ps.getViewers().Delete(signalID)
+}
+
+// adaptRendition follow the bandwidth of peer until it unsubscribes
+func (ps *Peers) adaptRendition(peer *peer.Peer, viewer *rendition.Viewer) {
+	ticker := time.NewTicker(adaptInterval)
+	defer ticker.Stop()
+	for range ticker.C {
+		if ps.getViewer(peer.GetSignalID()) != viewer {
+			return
+		}
+		out := peer.GetOutboundStats("video")
+		if out == nil {
+			continue
+		}
+
+		name, changed := viewer.Adapt(rendition.Feedback{
+			Estimate:     out.Estimate,
+			FractionLost: out.FractionLost,
+		}, time.Now())
+		if changed {
+			logs.Info(fmt.Sprintf("%s switch to rendition %s, estimate %.0f bps, loss %.2f", peer.GetSignalID(), name, out.Estimate, out.FractionLost))
+			ps.notifyParticipant(peer.GetSignalID(), "rendition", name)
+		}
+	}
+}
+
+// handleRenditionEvent pin the rendition of the participant in value. Only moderators pin someone else
+func (ps *Peers) handleRenditionEvent(signalID string, values []interface{}) error {
+	if len(values) < 1 {
+		return fmt.Errorf("Missing signalID to set-rendition")
+	}
+	target, ok := values[0].(string)
+	if !ok || target == "" {
+		return fmt.Errorf("Invalid signalID to set-rendition: %v", values[0])
+	}
+	if target != signalID {
+		if err := ps.checkModerator(signalID, "set-rendition of "+target); err != nil {
+			return err
+		}
+	}
+	name := ""
+	if len(values) > 1 {
+		if name, ok = values[1].(string); !ok {
+			return fmt.Errorf("Invalid rendition to set-rendition: %v", values[1])
+		}
+	}
+	return ps.SetRendition(target, name)
+}
+
+// SetRendition send rendition name to signalID whatever its bandwidth, empty goes back to adapting
+func (ps *Peers) SetRendition(signalID, name string) error {
+	viewer := ps.getViewer(signalID)
+	if viewer == nil {
+		return fmt.Errorf("Participant %s does not receive the mix", signalID)
+	}
+	if err := viewer.Pin(name); err != nil {
+		return err
+	}
+	ps.notifyParticipant(signalID, "rendition", viewer.GetRendition())
+	return nil
+}
+
+// GetRenditions rendition each participant receives
+func (ps *Peers) GetRenditions() map[string]string {
+	renditions := make(map[string]string)
+	ps.getViewers().Iter(func(key, value interface{}) bool {
+		id, _ := key.(string)
+		if viewer, ok := value.(*rendition.Viewer); ok {
+			renditions[id] = viewer.GetRendition()
+		}
+		return true
+	})
+	return renditions
+}
@@ -0,0 +1,102 @@
+package peers
+
+import (
+	"fmt"
+	neturl "net/url"
+	"strings"
+
+	"github.com/lamhai1401/gologs/logs"
+	"github.com/lamhai1401/testrtc/rtmp"
+	"github.com/lamhai1401/testrtc/utils"
+)
+
+// handleRTMPEvent start egress to url in value, stop it or all egresses if empty.
+// Clients only push to the hosts of RTMPHOSTS
+func (ps *Peers) handleRTMPEvent(values []interface{}, start bool) error {
+	url := ""
+	if len(values) > 0 {
+		value, ok := values[0].(string)
+		if !ok {
+			return fmt.Errorf("Invalid rtmp url: %v", values[0])
+		}
+		url = value
+	}
+
+	if start {
+		if url == "" {
+			return fmt.Errorf("Missing rtmp url")
+		}
+		if err := checkHost(url, utils.GetRTMPHosts()); err != nil {
+			return err
+		}
+		return ps.StartRTMP(url)
+	}
+	ps.StopRTMP(url)
+	return nil
+}
+
+// checkHost return an error if the host of rawURL is not one of hosts
+func checkHost(rawURL string, hosts []string) error {
+	u, err := neturl.Parse(rawURL)
+	if err != nil {
+		return fmt.Errorf("Invalid url %s: %v", rawURL, err)
+	}
+	host := strings.ToLower(u.Hostname())
+	for _, allowed := range hosts {
+		if host != "" && host == allowed {
+			return nil
+		}
+	}
+	return fmt.Errorf("Host of %s is not allowed", rawURL)
+}
+
+// StartRTMP push mixer output to a rtmp url, a room can push to many urls
+func (ps *Peers) StartRTMP(url string) error {
+	if _, ok := ps.getEgresses().Get(url); ok {
+		return fmt.Errorf("Mixed stream is already pushing to %s", url)
+	}
+
+	egress, err := rtmp.NewEgress(url)
+	if err != nil {
+		return err
+	}
+	ps.getEgresses().Set(url, egress)
+
+	// a broken connection stops its egress
+	handleErr := func(err error) error {
+		if err != nil {
+			logs.Error(fmt.Sprintf("Push rtmp %s err: %v", url, err))
+			go ps.StopRTMP(url)
+		}
+		return err
+	}
+	ps.register("video", rtmpIDPrefix+url, func(wrapper *utils.Wrapper) error {
+		return handleErr(egress.PushVideo(&wrapper.Pkg))
+	})
+	ps.register("audio", rtmpIDPrefix+url, func(wrapper *utils.Wrapper) error {
+		return handleErr(egress.PushAudio(&wrapper.Pkg))
+	})
+	return nil
+}
+
+// StopRTMP stop egress to url, or all egresses if url is empty
+func (ps *Peers) StopRTMP(url string) {
+	urls := []string{url}
+	if url == "" {
+		urls = ps.getEgresses().GetKeys()
+	}
+
+	for _, url := range urls {
+		egress := ps.getEgress(url)
+		if egress == nil {
+			continue
+		}
+		ps.getEgresses().Delete(url)
+
+		ps.unregister("video", rtmpIDPrefix+url)
+		ps.unregister("audio", rtmpIDPrefix+url)
+		if err := egress.Close(); err != nil {
+			logs.Error(fmt.Sprintf("Close rtmp %s err: %v", url, err))
+		}
+	}
+}
@@ -0,0 +1,84 @@
+package peers
+
+import (
+	"fmt"
+
+	"github.com/lamhai1401/gologs/logs"
+	"github.com/lamhai1401/testrtc/room"
+	"github.com/lamhai1401/testrtc/seat"
+)
+
+func (ps *Peers) handleSeatEvent(values []interface{}) error {
+	if len(values) < 2 {
+		return fmt.Errorf("Missing role or seat to reserve-seat")
+	}
+	role, ok := values[0].(string)
+	if !ok {
+		return fmt.Errorf("Invalid role to reserve-seat: %v", values[0])
+	}
+	number, ok := values[1].(float64)
+	if !ok {
+		return fmt.Errorf("Invalid seat to reserve-seat: %v", values[1])
+	}
+	return ps.ReserveSeat(role, int(number))
+}
+
+// SetRole of signalID, it moves to a free seat reserved for role if there is one.
+// Roles are trusted, so only the application sets them, clients join with a signed token
+func (ps *Peers) SetRole(signalID, role string) error {
+	seats := ps.getSeats()
+	if seats == nil {
+		return fmt.Errorf("Seat manager is nil")
+	}
+	seats.SetRole(signalID, role)
+	if ctrl := ps.getLayout(); ctrl != nil {
+		ctrl.Reorder()
+	}
+	return nil
+}
+
+// ReserveSeat number for participants of role, empty role opens it to anyone
+func (ps *Peers) ReserveSeat(role string, number int) error {
+	seats := ps.getSeats()
+	if seats == nil {
+		return fmt.Errorf("Seat manager is nil")
+	}
+	if !ps.canLayout() {
+		return fmt.Errorf("Mixer does not support seats")
+	}
+	return seats.Reserve(role, number)
+}
+
+// GetSeats every seat of the mix and who sits there
+func (ps *Peers) GetSeats() []*seat.Seat {
+	seats := ps.getSeats()
+	if seats == nil {
+		return nil
+	}
+	return seats.List()
+}
+
+// syncSeats free seats of participants who left then seat the ones without,
+// a participant finding no free seat is placed after the seated ones until one frees
+func (ps *Peers) syncSeats(participants []*room.Participant) {
+	seats := ps.getSeats()
+	if seats == nil {
+		return
+	}
+
+	present := make(map[string]bool, len(participants))
+	for _, participant := range participants {
+		present[participant.SignalID] = true
+	}
+	for _, s := range seats.List() {
+		if s.SignalID != "" && !present[s.SignalID] {
+			seats.Leave(s.SignalID)
+		}
+	}
+
+	for _, participant := range participants {
+		if _, err := seats.Join(participant.SignalID); err != nil {
+			logs.Warn(err.Error())
+		}
+	}
+}
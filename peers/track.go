@@ -0,0 +1,60 @@
+package peers
+
+import (
+	"sync"
+
+	"github.com/lamhai1401/testrtc/fec"
+	"github.com/lamhai1401/testrtc/jitter"
+	"github.com/pion/rtp"
+	"github.com/pion/webrtc/v2"
+)
+
+// trackChain unwrap red of a remote track, recover lost packets and hand them on in order.
+// The handler gets the codec of the media, a remote track reports red once it is negotiated
+type trackChain struct {
+	receiver *fec.Receiver
+	releaser *jitter.Releaser
+	getCodec func(pt uint8) *webrtc.RTPCodec
+	fallback *webrtc.RTPCodec // codec the track reports, used until media is unwrapped
+	codec    *webrtc.RTPCodec
+	mutex    sync.Mutex
+}
+
+func newTrackChain(receiver *fec.Receiver, buffer *jitter.Buffer, getCodec func(pt uint8) *webrtc.RTPCodec, fallback *webrtc.RTPCodec, handler func(pkt *rtp.Packet, codec *webrtc.RTPCodec)) *trackChain {
+	t := &trackChain{
+		receiver: receiver,
+		getCodec: getCodec,
+		fallback: fallback,
+	}
+	t.releaser = jitter.NewReleaser(buffer, func(pkt *rtp.Packet) {
+		handler(pkt, t.getMediaCodec())
+	})
+	return t
+}
+
+// Push packet as read from the remote track
+func (t *trackChain) Push(pkt *rtp.Packet) {
+	for _, media := range t.receiver.Push(pkt) {
+		t.releaser.Push(media)
+	}
+}
+
+// Close handle every waiting packet
+func (t *trackChain) Close() {
+	t.releaser.Close()
+}
+
+func (t *trackChain) getMediaCodec() *webrtc.RTPCodec {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	pt := t.receiver.GetMediaPT()
+	if t.codec == nil || t.codec.PayloadType != pt {
+		if codec := t.getCodec(pt); codec != nil {
+			t.codec = codec
+		}
+	}
+	if t.codec == nil {
+		return t.fallback
+	}
+	return t.codec
+}
@@ -0,0 +1,84 @@
+package peers
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/lamhai1401/testrtc/fec"
+	"github.com/lamhai1401/testrtc/jitter"
+	"github.com/pion/rtp"
+	"github.com/pion/webrtc/v2"
+)
+
+const (
+	testOpusPT = 111
+	testREDPT  = 63
+)
+
+func TestTrackChainUnwrapRED(t *testing.T) {
+	opus := webrtc.NewRTPOpusCodec(testOpusPT, 48000)
+	red := webrtc.NewRTPCodec(webrtc.RTPCodecTypeAudio, "red", 48000, 2, "111/111", testREDPT, nil)
+	getCodec := func(pt uint8) *webrtc.RTPCodec {
+		switch pt {
+		case testOpusPT:
+			return opus
+		case testREDPT:
+			return red
+		}
+		return nil
+	}
+
+	var mutex sync.Mutex
+	sequences := make([]uint16, 0)
+	names := make([]string, 0)
+	chain := newTrackChain(fec.NewReceiver(testREDPT, 0), jitter.NewBuffer(16, time.Second), getCodec, red, func(pkt *rtp.Packet, codec *webrtc.RTPCodec) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		if pkt.PayloadType != testOpusPT {
+			t.Errorf("expect payload type %d, got %d", testOpusPT, pkt.PayloadType)
+		}
+		sequences = append(sequences, pkt.SequenceNumber)
+		names = append(names, codec.Name)
+	})
+
+	sender := fec.NewSender(testREDPT, 0, 1, 0)
+	for i := 0; i < 4; i++ {
+		packets, err := sender.Packetize(&rtp.Packet{
+			Header: rtp.Header{
+				Version:        2,
+				PayloadType:    testOpusPT,
+				SequenceNumber: uint16(i),
+				Timestamp:      uint32(i * 960),
+				SSRC:           1234,
+			},
+			Payload: []byte{byte(i)},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		// drop the third packet, the red block of the fourth brings it back
+		if i == 2 {
+			continue
+		}
+		for _, pkt := range packets {
+			chain.Push(pkt)
+		}
+	}
+	chain.Close()
+
+	mutex.Lock()
+	defer mutex.Unlock()
+	if len(sequences) != 4 {
+		t.Fatalf("expect 4 packets, got %v", sequences)
+	}
+	for i, seq := range sequences {
+		// the sender numbers its packets from a random start
+		if seq != sequences[0]+uint16(i) {
+			t.Fatalf("expect packets in order, got %v", sequences)
+		}
+		if names[i] != webrtc.Opus {
+			t.Fatalf("expect codec %s, got %s", webrtc.Opus, names[i])
+		}
+	}
+}
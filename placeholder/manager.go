@@ -0,0 +1,96 @@
+package placeholder
+
+import (
+	"sync"
+
+	"github.com/lamhai1401/testrtc/still"
+	"github.com/lamhai1401/testrtc/utils"
+	"github.com/pion/rtp"
+)
+
+// tile what a placeholder currently shows
+type tile struct {
+	stream *still.Stream
+	muted  bool
+	mutex  sync.Mutex
+}
+
+// Manager stream a placeholder tile in place of video for each participant that need one
+type Manager struct {
+	frames  *Tiles
+	fps     int
+	handler func(signalID string, pkt *rtp.Packet)
+	tiles   *utils.AdvanceMap // signalID - *tile
+}
+
+// NewManager handler receive vp8 packets of every placeholder
+func NewManager(frames *Tiles, fps int, handler func(signalID string, pkt *rtp.Packet)) *Manager {
+	return &Manager{
+		frames:  frames,
+		fps:     fps,
+		handler: handler,
+		tiles:   utils.NewAdvanceMap(),
+	}
+}
+
+func (m *Manager) getTile(signalID string) *tile {
+	if value, has := m.tiles.Get(signalID); has {
+		if t, ok := value.(*tile); ok {
+			return t
+		}
+	}
+	return nil
+}
+
+// Set start or update the placeholder of signalID, only a changed tile is sent again
+func (m *Manager) Set(signalID string, muted bool) {
+	t := m.getTile(signalID)
+	if t == nil {
+		t = &tile{
+			stream: still.NewStream(m.fps, func(pkt *rtp.Packet) {
+				m.handler(signalID, pkt)
+			}),
+		}
+		m.tiles.Set(signalID, t)
+	} else {
+		t.mutex.Lock()
+		same := t.muted == muted
+		t.mutex.Unlock()
+		if same {
+			return
+		}
+	}
+
+	t.mutex.Lock()
+	t.muted = muted
+	t.mutex.Unlock()
+	t.stream.SetFrame(m.frames.Get(muted))
+}
+
+// Remove placeholder of signalID, return false if it had none
+func (m *Manager) Remove(signalID string) bool {
+	t := m.getTile(signalID)
+	if t == nil {
+		return false
+	}
+	m.tiles.Delete(signalID)
+	t.stream.Close()
+	return true
+}
+
+// Has check signalID is showing a placeholder
+func (m *Manager) Has(signalID string) bool {
+	return m.getTile(signalID) != nil
+}
+
+// GetIDs signalIDs having a placeholder
+func (m *Manager) GetIDs() []string {
+	return m.tiles.GetKeys()
+}
+
+// Close every placeholders
+func (m *Manager) Close() {
+	for _, signalID := range m.GetIDs() {
+		m.Remove(signalID)
+	}
+}
@@ -0,0 +1,65 @@
+package placeholder
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/pion/webrtc/v2/pkg/media/ivfreader"
+)
+
+// Tiles vp8 keyframes shown for participants without video. They are encoded ahead,
+// such as by ffmpeg -i icon.png -c:v libvpx -frames:v 1 tile.ivf, so nothing is encoded here
+type Tiles struct {
+	frame      []byte
+	mutedFrame []byte // nil shows frame for muted participants too
+}
+
+// loadKeyframe read the first frame of an ivf file, it must be a vp8 keyframe
+func loadKeyframe(path string) ([]byte, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	reader, header, err := ivfreader.NewWith(file)
+	if err != nil {
+		return nil, fmt.Errorf("Read %s err: %v", path, err)
+	}
+	if header.FourCC != "VP80" {
+		return nil, fmt.Errorf("%s is %s, not vp8", path, header.FourCC)
+	}
+	frame, _, err := reader.ParseNextFrame()
+	if err != nil {
+		return nil, fmt.Errorf("Read frame of %s err: %v", path, err)
+	}
+	// frame tag of a keyframe has the low bit clear (RFC 6386 9.1)
+	if len(frame) == 0 || frame[0]&0x01 != 0 {
+		return nil, fmt.Errorf("First frame of %s is not a keyframe", path)
+	}
+	return frame, nil
+}
+
+// LoadTiles read the tile from path and the one of muted participants from mutedPath, which can be empty
+func LoadTiles(path, mutedPath string) (*Tiles, error) {
+	frame, err := loadKeyframe(path)
+	if err != nil {
+		return nil, err
+	}
+
+	t := &Tiles{frame: frame}
+	if mutedPath != "" {
+		if t.mutedFrame, err = loadKeyframe(mutedPath); err != nil {
+			return nil, err
+		}
+	}
+	return t, nil
+}
+
+// Get keyframe of a participant muted or not
+func (t *Tiles) Get(muted bool) []byte {
+	if muted && t.mutedFrame != nil {
+		return t.mutedFrame
+	}
+	return t.frame
+}
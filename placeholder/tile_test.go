@@ -0,0 +1,54 @@
+package placeholder
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLoadTiles(t *testing.T) {
+	tiles, err := LoadTiles("../resources/img/voice-only-icon.ivf", "../resources/img/voice-only-muted.ivf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Equal(tiles.Get(false), tiles.Get(true)) {
+		t.Fatal("muted tile should show the muted icon")
+	}
+
+	plain, err := LoadTiles("../resources/img/voice-only-icon.ivf", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(plain.Get(true), plain.Get(false)) {
+		t.Fatal("without muted tile the tile should be shown")
+	}
+}
+
+func TestLoadTilesInvalid(t *testing.T) {
+	dir, err := ioutil.TempDir("", "placeholder")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// the png is not an ivf file
+	if _, err := LoadTiles("../resources/img/voice-only-icon.png", ""); err == nil {
+		t.Fatal("png should be refused")
+	}
+
+	// an ivf whose first frame is not a keyframe
+	data, err := ioutil.ReadFile("../resources/img/voice-only-icon.ivf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	data[32+12] |= 0x01
+	path := filepath.Join(dir, "delta.ivf")
+	if err := ioutil.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadTiles(path, ""); err == nil {
+		t.Fatal("delta frame should be refused")
+	}
+}
@@ -0,0 +1,35 @@
+package recorder
+
+import (
+	"time"
+)
+
+// clock map rtp timestamps of one stream to ms from start of recording
+type clock struct {
+	clockRate uint32
+	base      int64 // ms of first packet from start of recording
+	lastTS    uint32
+	elapsed   int64 // unwrapped rtp units since first packet
+	started   bool
+}
+
+func newClock(clockRate uint32) *clock {
+	return &clock{
+		clockRate: clockRate,
+	}
+}
+
+// ms of a packet, first packet is placed at its arrival time
+func (c *clock) ms(timestamp uint32, arrival time.Time, start time.Time) int64 {
+	if !c.started {
+		c.started = true
+		c.base = int64(arrival.Sub(start) / time.Millisecond)
+		c.lastTS = timestamp
+	}
+	c.elapsed += int64(int32(timestamp - c.lastTS))
+	c.lastTS = timestamp
+	if c.clockRate == 0 {
+		return c.base
+	}
+	return c.base + c.elapsed*1000/int64(c.clockRate)
+}
@@ -0,0 +1,48 @@
+package recorder
+
+import (
+	"io"
+	"os"
+)
+
+// countFile count bytes written to a file for size rotation
+type countFile struct {
+	file     *os.File
+	size     int64
+	isClosed bool
+}
+
+func createCountFile(path string) (*countFile, error) {
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	return &countFile{
+		file: file,
+	}, nil
+}
+
+func (c *countFile) Write(p []byte) (int, error) {
+	n, err := c.file.Write(p)
+	c.size += int64(n)
+	return n, err
+}
+
+func (c *countFile) Seek(offset int64, whence int) (int64, error) {
+	return c.file.Seek(offset, whence)
+}
+
+// Close can be called many times, ogg writer close its stream by itself
+func (c *countFile) Close() error {
+	if c.isClosed {
+		return nil
+	}
+	c.isClosed = true
+	return c.file.Close()
+}
+
+func (c *countFile) getSize() int64 {
+	return c.size
+}
+
+var _ io.WriteSeeker = &countFile{}
@@ -0,0 +1,104 @@
+package recorder
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+
+	"github.com/lamhai1401/testrtc/codec"
+)
+
+const (
+	ivfFileHeaderSize  = 32
+	ivfFrameHeaderSize = 12
+)
+
+// ivfWriter write vp8 or vp9 frames to ivf container, pts in rtp clock rate
+type ivfWriter struct {
+	out       io.WriteSeeker
+	fourcc    string
+	clockRate uint32
+	count     uint32
+	firstTS   uint32
+	lastTS    uint32
+	pts       uint64
+	hasHeader bool
+}
+
+func newIVFWriter(out io.WriteSeeker, codecName string, clockRate uint32) (*ivfWriter, error) {
+	var fourcc string
+	switch codecName {
+	case codec.VP8:
+		fourcc = "VP80"
+	case codec.VP9:
+		fourcc = "VP90"
+	default:
+		return nil, fmt.Errorf("codec %s can not write to ivf", codecName)
+	}
+
+	return &ivfWriter{
+		out:       out,
+		fourcc:    fourcc,
+		clockRate: clockRate,
+	}, nil
+}
+
+func (w *ivfWriter) writeHeader(frame *codec.Frame) error {
+	header := make([]byte, ivfFileHeaderSize)
+	copy(header[0:], "DKIF")
+	binary.LittleEndian.PutUint16(header[4:], 0)                 // version
+	binary.LittleEndian.PutUint16(header[6:], ivfFileHeaderSize) // header size
+	copy(header[8:], w.fourcc)                                   // fourcc
+	binary.LittleEndian.PutUint16(header[12:], frame.Width)      // width
+	binary.LittleEndian.PutUint16(header[14:], frame.Height)     // height
+	binary.LittleEndian.PutUint32(header[16:], w.clockRate)      // timebase denominator
+	binary.LittleEndian.PutUint32(header[20:], 1)                // timebase numerator
+	binary.LittleEndian.PutUint32(header[24:], 0)                // frame count, updated on close
+	_, err := w.out.Write(header)
+	return err
+}
+
+// WriteFrame linter
+func (w *ivfWriter) WriteFrame(frame *codec.Frame) error {
+	if !w.hasHeader {
+		if err := w.writeHeader(frame); err != nil {
+			return err
+		}
+		w.hasHeader = true
+		w.firstTS = frame.Timestamp
+		w.lastTS = frame.Timestamp
+	}
+
+	// unwrap rtp timestamp
+	w.pts += uint64(int64(int32(frame.Timestamp - w.lastTS)))
+	w.lastTS = frame.Timestamp
+
+	header := make([]byte, ivfFrameHeaderSize)
+	binary.LittleEndian.PutUint32(header[0:], uint32(len(frame.Data)))
+	binary.LittleEndian.PutUint64(header[4:], w.pts)
+	if _, err := w.out.Write(header); err != nil {
+		return err
+	}
+	if _, err := w.out.Write(frame.Data); err != nil {
+		return err
+	}
+	w.count++
+	return nil
+}
+
+// Close update frame count in file header
+func (w *ivfWriter) Close() error {
+	if !w.hasHeader {
+		return nil
+	}
+	if _, err := w.out.Seek(24, io.SeekStart); err != nil {
+		return err
+	}
+	count := make([]byte, 4)
+	binary.LittleEndian.PutUint32(count, w.count)
+	if _, err := w.out.Write(count); err != nil {
+		return err
+	}
+	_, err := w.out.Seek(0, io.SeekEnd)
+	return err
+}
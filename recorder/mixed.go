@@ -0,0 +1,105 @@
+package recorder
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/lamhai1401/gologs/logs"
+	"github.com/lamhai1401/testrtc/codec"
+	"github.com/lamhai1401/testrtc/webm"
+	"github.com/pion/rtp"
+)
+
+const (
+	mixedVideoClockRate = 90000
+	mixedAudioClockRate = 48000
+	mixedAudioChannels  = 2
+)
+
+// MixedRecorder mux mixer output (vp8 and opus) to a webm file
+type MixedRecorder struct {
+	path      string
+	file      *countFile
+	writer    *webm.Writer
+	builder   *codec.FrameBuilder
+	video     *clock
+	audio     *clock
+	startTime time.Time
+	isClosed  bool
+	mutex     sync.Mutex
+}
+
+// NewMixedRecorder create webm file of mixer id in dir
+func NewMixedRecorder(dir, id string) (*MixedRecorder, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	path := filepath.Join(dir, fmt.Sprintf("%s_%d.webm", id, now.UnixNano()/int64(time.Millisecond)))
+	file, err := createCountFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	logs.Info(fmt.Sprintf("Start recording mixed stream %s to %s", id, path))
+	return &MixedRecorder{
+		path:      path,
+		file:      file,
+		writer:    webm.NewWriter(file, true, true, mixedAudioClockRate, mixedAudioChannels),
+		builder:   codec.NewFrameBuilder(codec.VP8),
+		video:     newClock(mixedVideoClockRate),
+		audio:     newClock(mixedAudioClockRate),
+		startTime: now,
+	}, nil
+}
+
+// GetPath linter
+func (m *MixedRecorder) GetPath() string {
+	return m.path
+}
+
+// PushVideo write a mixed video packet
+func (m *MixedRecorder) PushVideo(pkt *rtp.Packet) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if m.isClosed {
+		return fmt.Errorf("mixed recorder was closed")
+	}
+
+	frame, err := m.builder.Push(pkt)
+	if err != nil || frame == nil {
+		return err
+	}
+	return m.writer.WriteVideo(frame, m.video.ms(frame.Timestamp, time.Now(), m.startTime))
+}
+
+// PushAudio write a mixed audio packet
+func (m *MixedRecorder) PushAudio(pkt *rtp.Packet) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if m.isClosed {
+		return fmt.Errorf("mixed recorder was closed")
+	}
+	return m.writer.WriteAudio(append([]byte{}, pkt.Payload...), m.audio.ms(pkt.Timestamp, time.Now(), m.startTime))
+}
+
+// Close finalize webm file
+func (m *MixedRecorder) Close() error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if m.isClosed {
+		return nil
+	}
+	m.isClosed = true
+
+	err := m.writer.Close()
+	if closeErr := m.file.Close(); err == nil {
+		err = closeErr
+	}
+	logs.Info(fmt.Sprintf("Stop recording mixed stream to %s", m.path))
+	return err
+}
@@ -0,0 +1,147 @@
+package recorder
+
+import (
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/lamhai1401/gologs/logs"
+	"github.com/lamhai1401/testrtc/utils"
+	"github.com/pion/rtp"
+)
+
+// Recorder tee remote tracks of participants to per participant files
+type Recorder struct {
+	dir       string
+	rotation  Rotation
+	recording *utils.AdvanceMap // signalID - true
+	tracks    *utils.AdvanceMap // signalID_kind - *trackRecorder
+	onClose   func(path string) // a file is finished
+	isClosed  bool
+	mutex     sync.RWMutex
+}
+
+// NewRecorder linter
+func NewRecorder(dir string, rotation Rotation) *Recorder {
+	return &Recorder{
+		dir:       dir,
+		rotation:  rotation,
+		recording: utils.NewAdvanceMap(),
+		tracks:    utils.NewAdvanceMap(),
+	}
+}
+
+// OnFileClosed set handler of finished files, it must not block
+func (r *Recorder) OnFileClosed(handler func(path string)) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.onClose = handler
+}
+
+// Start recording participant
+func (r *Recorder) Start(signalID string) error {
+	if r.checkClose() {
+		return fmt.Errorf("recorder was closed")
+	}
+	if err := os.MkdirAll(r.getDir(), 0755); err != nil {
+		return err
+	}
+	r.recording.Set(signalID, true)
+	return nil
+}
+
+// Stop recording participant and close its files
+func (r *Recorder) Stop(signalID string) {
+	r.recording.Delete(signalID)
+	r.Release(signalID)
+}
+
+// Release close files of a participant leaving room, recording go on when rejoin
+func (r *Recorder) Release(signalID string) {
+	for _, kind := range []string{"audio", "video"} {
+		r.closeTrack(signalID, kind)
+	}
+}
+
+// IsRecording linter
+func (r *Recorder) IsRecording(signalID string) bool {
+	_, has := r.recording.Get(signalID)
+	return has
+}
+
+// Push a remote track packet in sequence order, do nothing if participant is not recorded
+func (r *Recorder) Push(signalID, kind, codecName string, clockRate uint32, channels uint16, pkt *rtp.Packet) {
+	if r.checkClose() || !r.IsRecording(signalID) {
+		return
+	}
+
+	track, err := r.getTrack(signalID, kind, codecName, clockRate, channels)
+	if err != nil {
+		logs.Error(fmt.Sprintf("Record %s %s err: %v", signalID, kind, err))
+		// stop trying for this participant
+		r.recording.Delete(signalID)
+		return
+	}
+
+	if err := track.push(pkt, time.Now()); err != nil {
+		logs.Error(fmt.Sprintf("Record %s %s packet err: %v", signalID, kind, err))
+	}
+}
+
+// Close all files
+func (r *Recorder) Close() {
+	if r.checkClose() {
+		return
+	}
+	r.setClose(true)
+	for _, signalID := range r.recording.GetKeys() {
+		r.Stop(signalID)
+	}
+}
+
+func (r *Recorder) getDir() string {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	return r.dir
+}
+
+func (r *Recorder) checkClose() bool {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	return r.isClosed
+}
+
+func (r *Recorder) setClose(state bool) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.isClosed = state
+}
+
+func (r *Recorder) getTrack(signalID, kind, codecName string, clockRate uint32, channels uint16) (*trackRecorder, error) {
+	key := utils.MergeID(signalID, kind)
+	if value, has := r.tracks.Get(key); has {
+		if track, ok := value.(*trackRecorder); ok {
+			return track, nil
+		}
+	}
+
+	r.mutex.RLock()
+	track, err := newTrackRecorder(r.dir, signalID, kind, codecName, clockRate, channels, r.rotation, r.onClose)
+	r.mutex.RUnlock()
+	if err != nil {
+		return nil, err
+	}
+	r.tracks.Set(key, track)
+	return track, nil
+}
+
+func (r *Recorder) closeTrack(signalID, kind string) {
+	key := utils.MergeID(signalID, kind)
+	if value, has := r.tracks.Get(key); has {
+		r.tracks.Delete(key)
+		if track, ok := value.(*trackRecorder); ok {
+			track.close()
+		}
+	}
+}
@@ -0,0 +1,187 @@
+package recorder
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/lamhai1401/gologs/logs"
+	"github.com/lamhai1401/testrtc/codec"
+	"github.com/pion/rtp"
+	"github.com/pion/webrtc/v2/pkg/media/oggwriter"
+)
+
+// Rotation when to start a new file, 0 is unlimited
+type Rotation struct {
+	MaxSize     int64
+	MaxDuration time.Duration
+}
+
+// frameWriter write depacketized frames or raw rtp to a container
+type frameWriter interface {
+	WriteFrame(frame *codec.Frame) error
+	Close() error
+}
+
+// oggWriter write opus packets with pion ogg writer
+type oggWriter struct {
+	writer *oggwriter.OggWriter
+}
+
+func (o *oggWriter) WriteFrame(frame *codec.Frame) error {
+	return o.writer.WriteRTP(&rtp.Packet{
+		Header: rtp.Header{
+			Timestamp: frame.Timestamp,
+		},
+		Payload: frame.Data,
+	})
+}
+
+func (o *oggWriter) Close() error {
+	return o.writer.Close()
+}
+
+// trackRecorder record one remote track to rotating files
+type trackRecorder struct {
+	dir       string
+	signalID  string
+	kind      string
+	codec     string
+	clockRate uint32
+	channels  uint16
+	rotation  Rotation
+	builder   *codec.FrameBuilder
+	file      *countFile
+	writer    frameWriter
+	path      string
+	startTime time.Time
+	rotate    bool // rotation limit reached, wait for keyframe
+	onClose   func(path string)
+	mutex     sync.Mutex
+}
+
+func newTrackRecorder(dir, signalID, kind, codecName string, clockRate uint32, channels uint16, rotation Rotation, onClose func(path string)) (*trackRecorder, error) {
+	codecName = strings.ToLower(codecName)
+	if !codec.IsSupported(codecName) {
+		return nil, fmt.Errorf("codec %s can not be recorded", codecName)
+	}
+	if channels == 0 {
+		channels = 2
+	}
+
+	return &trackRecorder{
+		dir:       dir,
+		signalID:  signalID,
+		kind:      kind,
+		codec:     codecName,
+		clockRate: clockRate,
+		channels:  channels,
+		rotation:  rotation,
+		builder:   codec.NewFrameBuilder(codecName),
+		onClose:   onClose,
+	}, nil
+}
+
+func (t *trackRecorder) extension() string {
+	if t.codec == codec.Opus {
+		return "ogg"
+	}
+	return "ivf"
+}
+
+func (t *trackRecorder) open(now time.Time) error {
+	path := filepath.Join(t.dir, fmt.Sprintf("%s_%s_%d.%s", t.signalID, t.kind, now.UnixNano()/int64(time.Millisecond), t.extension()))
+	file, err := createCountFile(path)
+	if err != nil {
+		return err
+	}
+
+	var writer frameWriter
+	if t.codec == codec.Opus {
+		ogg, err := oggwriter.NewWith(file, t.clockRate, t.channels)
+		if err == nil {
+			writer = &oggWriter{writer: ogg}
+		}
+	} else {
+		writer, err = newIVFWriter(file, t.codec, t.clockRate)
+	}
+	if err != nil {
+		file.Close()
+		return err
+	}
+
+	t.file = file
+	t.writer = writer
+	t.path = path
+	t.startTime = now
+	t.rotate = false
+	logs.Info(fmt.Sprintf("Start recording %s %s to %s", t.signalID, t.kind, path))
+	return nil
+}
+
+func (t *trackRecorder) close() {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.closeFile()
+}
+
+func (t *trackRecorder) closeFile() {
+	if t.writer == nil {
+		return
+	}
+
+	if err := t.writer.Close(); err != nil {
+		logs.Error(fmt.Sprintf("Close %s writer err: %v", t.path, err))
+	}
+	if err := t.file.Close(); err != nil {
+		logs.Error(fmt.Sprintf("Close %s err: %v", t.path, err))
+	}
+	logs.Info(fmt.Sprintf("Stop recording %s %s to %s", t.signalID, t.kind, t.path))
+
+	if t.onClose != nil {
+		t.onClose(t.path)
+	}
+	t.writer = nil
+	t.file = nil
+	t.path = ""
+}
+
+func (t *trackRecorder) needRotate(now time.Time) bool {
+	if t.rotation.MaxSize > 0 && t.file.getSize() >= t.rotation.MaxSize {
+		return true
+	}
+	if t.rotation.MaxDuration > 0 && now.Sub(t.startTime) >= t.rotation.MaxDuration {
+		return true
+	}
+	return false
+}
+
+// push depacketize packet and write complete frames
+func (t *trackRecorder) push(pkt *rtp.Packet, now time.Time) error {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	frame, err := t.builder.Push(pkt)
+	if err != nil || frame == nil {
+		return err
+	}
+
+	if t.writer != nil && !t.rotate && t.needRotate(now) {
+		t.rotate = true
+	}
+
+	// video files must start with a keyframe
+	if t.writer != nil && t.rotate && frame.Keyframe {
+		t.closeFile()
+	}
+
+	if t.writer == nil {
+		if err := t.open(now); err != nil {
+			return err
+		}
+	}
+
+	return t.writer.WriteFrame(frame)
+}
@@ -0,0 +1,165 @@
+package rendition
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/lamhai1401/testrtc/codec"
+	"github.com/lamhai1401/testrtc/mixer"
+	"github.com/pion/rtp"
+)
+
+const (
+	// gap left in timestamps when the forwarded rendition changes, until the stream shows its own
+	videoStep = 90000 / 30
+	// maxStep longest frame interval taken from the stream, a larger gap is a pause
+	maxStep = 90000 / 5
+	// upHeadroom estimate must exceed the bitrate of a higher rendition by this much to move up
+	upHeadroom = 1.25
+	// upInterval least time from the last switch to a move up, so a viewer does not flap
+	upInterval = 10 * time.Second
+	// loss moving down or up a rendition when the viewer sends no bandwidth estimate
+	maxLoss = 0.1
+	minLoss = 0.02
+)
+
+// Feedback what a viewer reports about the mixed video it receives
+type Feedback struct {
+	Estimate     float64 // bits per second from remb, 0 is unknown
+	FractionLost float64 // 0-1
+}
+
+// Viewer forward one rendition of the mix to a subscriber. A switch takes effect at the next
+// keyframe of the new rendition, which is requested, with sequence numbers and timestamps
+// kept continuous, so the subscriber decodes one unbroken stream
+type Viewer struct {
+	renditions []mixer.Rendition // by bitrate, lowest first
+	current    string            // rendition being forwarded, empty before the first keyframe
+	target     string            // rendition forwarded from its next keyframe
+	pinned     bool              // target was set by Pin and is not adapted
+	lastSwitch time.Time
+	lastTS     uint32 // timestamp of the last packet forwarded of current
+	rewriter   *mixer.Rewriter
+	request    func(name string) // ask rendition name for a keyframe
+	mutex      sync.Mutex
+}
+
+// NewViewer start with the first rendition, the one every consumer of the mix gets.
+// request is called under the lock of the viewer whenever it waits for a keyframe
+func NewViewer(renditions []mixer.Rendition, request func(name string)) *Viewer {
+	sorted := append([]mixer.Rendition(nil), renditions...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].Bitrate < sorted[j].Bitrate
+	})
+	v := &Viewer{
+		renditions: sorted,
+		target:     renditions[0].Name,
+		rewriter:   mixer.NewRewriter(videoStep),
+		request:    request,
+	}
+	v.requestKeyframe()
+	return v
+}
+
+// Push a video packet of rendition name, return the packet to send or nil if name is not forwarded
+func (v *Viewer) Push(name string, pkt *rtp.Packet) *rtp.Packet {
+	v.mutex.Lock()
+	defer v.mutex.Unlock()
+	if name != v.current {
+		if name != v.target || !codec.IsVP8Keyframe(pkt.Payload) {
+			return nil
+		}
+		v.current = name
+	} else if step := pkt.Timestamp - v.lastTS; step > 0 && step <= maxStep {
+		// a switch leaves the gap of one frame of the stream
+		v.rewriter.SetStep(step)
+	}
+	v.lastTS = pkt.Timestamp
+	return v.rewriter.Rewrite(pkt)
+}
+
+// GetRendition name of the rendition forwarded, or about to be
+func (v *Viewer) GetRendition() string {
+	v.mutex.Lock()
+	defer v.mutex.Unlock()
+	return v.target
+}
+
+// Pin forward rendition name whatever the feedback, empty goes back to adapting
+func (v *Viewer) Pin(name string) error {
+	v.mutex.Lock()
+	defer v.mutex.Unlock()
+	if name == "" {
+		v.pinned = false
+		return nil
+	}
+	if v.index(name) < 0 {
+		return fmt.Errorf("Unknown rendition %s", name)
+	}
+	v.pinned = true
+	if v.target != name {
+		v.target = name
+		v.requestKeyframe()
+	}
+	v.lastSwitch = time.Now()
+	return nil
+}
+
+// Adapt move to the rendition feedback fits, return it and whether it changed.
+// Moving down is immediate, moving up needs headroom and upInterval since the last switch
+func (v *Viewer) Adapt(feedback Feedback, now time.Time) (string, bool) {
+	v.mutex.Lock()
+	defer v.mutex.Unlock()
+	if v.pinned || len(v.renditions) < 2 {
+		return v.target, false
+	}
+
+	index := v.index(v.target)
+	next := index
+	if feedback.Estimate > 0 {
+		// the highest rendition fitting the estimate, lowest if none does
+		next = 0
+		for i, r := range v.renditions {
+			bitrate := float64(r.Bitrate * 1000)
+			if i > index {
+				bitrate *= upHeadroom
+			}
+			if bitrate <= feedback.Estimate {
+				next = i
+			}
+		}
+	} else {
+		switch {
+		case feedback.FractionLost > maxLoss && index > 0:
+			next = index - 1
+		case feedback.FractionLost < minLoss && index < len(v.renditions)-1:
+			next = index + 1
+		}
+	}
+
+	if next == index || (next > index && now.Sub(v.lastSwitch) < upInterval) {
+		return v.target, false
+	}
+	v.target = v.renditions[next].Name
+	v.lastSwitch = now
+	v.requestKeyframe()
+	return v.target, true
+}
+
+// requestKeyframe of target so a switch does not wait for the next one, mutex must be held
+func (v *Viewer) requestKeyframe() {
+	if v.request != nil && v.target != v.current {
+		v.request(v.target)
+	}
+}
+
+func (v *Viewer) index(name string) int {
+	for i, r := range v.renditions {
+		if r.Name == name {
+			return i
+		}
+	}
+	return -1
+}
@@ -0,0 +1,105 @@
+package rendition
+
+import (
+	"testing"
+	"time"
+
+	"github.com/lamhai1401/testrtc/mixer"
+	"github.com/pion/rtp"
+)
+
+var ladder = []mixer.Rendition{
+	{Name: "hd", Bitrate: 1500},
+	{Name: "sd", Bitrate: 600},
+	{Name: "low", Bitrate: 200},
+}
+
+func vp8Packet(ssrc uint32, seq uint16, ts uint32, keyframe bool) *rtp.Packet {
+	tag := byte(0x01)
+	if keyframe {
+		tag = 0x00
+	}
+	return &rtp.Packet{
+		Header:  rtp.Header{SSRC: ssrc, SequenceNumber: seq, Timestamp: ts},
+		Payload: []byte{0x10, tag, 0, 0},
+	}
+}
+
+func TestAdapt(t *testing.T) {
+	v := NewViewer(ladder, nil)
+	now := time.Now()
+
+	if name, changed := v.Adapt(Feedback{Estimate: 500000}, now); !changed || name != "low" {
+		t.Fatalf("500 kbps should drop to low, got %s", name)
+	}
+	// 700 kbps fits sd but not with headroom
+	if name, changed := v.Adapt(Feedback{Estimate: 700000}, now.Add(time.Minute)); changed {
+		t.Fatalf("moved up to %s without headroom", name)
+	}
+	if _, changed := v.Adapt(Feedback{Estimate: 5000000}, now.Add(time.Second)); changed {
+		t.Fatal("moved up too soon after a switch")
+	}
+	if name, _ := v.Adapt(Feedback{Estimate: 5000000}, now.Add(time.Minute)); name != "hd" {
+		t.Fatalf("5 Mbps should go up to hd, got %s", name)
+	}
+
+	// without estimate, loss steps one rendition at a time
+	if name, _ := v.Adapt(Feedback{FractionLost: 0.3}, now.Add(time.Minute)); name != "sd" {
+		t.Fatalf("loss should step down to sd, got %s", name)
+	}
+
+	v.Pin("low")
+	if _, changed := v.Adapt(Feedback{Estimate: 5000000}, now.Add(time.Hour)); changed || v.GetRendition() != "low" {
+		t.Fatal("pinned viewer should not adapt")
+	}
+	if err := v.Pin("4k"); err == nil {
+		t.Fatal("unknown rendition should be refused")
+	}
+}
+
+func TestPushSwitchAtKeyframe(t *testing.T) {
+	v := NewViewer(ladder, nil)
+	if v.Push("hd", vp8Packet(1, 10, 1000, false)) != nil {
+		t.Fatal("forwarded before a keyframe")
+	}
+	first := v.Push("hd", vp8Packet(1, 11, 1000, true))
+	if first == nil || v.Push("sd", vp8Packet(2, 50, 7000, true)) != nil {
+		t.Fatal("only hd should be forwarded")
+	}
+
+	v.Pin("sd")
+	if v.Push("sd", vp8Packet(2, 51, 10000, false)) != nil || v.Push("hd", vp8Packet(1, 12, 4000, false)) == nil {
+		t.Fatal("hd should be forwarded until a keyframe of sd")
+	}
+	switched := v.Push("sd", vp8Packet(2, 52, 13000, true))
+	if switched == nil || switched.SSRC != first.SSRC || switched.SequenceNumber != 13 || switched.Timestamp != 4000+videoStep {
+		t.Fatalf("unexpected switched packet %+v", switched)
+	}
+	if v.Push("hd", vp8Packet(1, 13, 7000, true)) != nil {
+		t.Fatal("hd forwarded after switching to sd")
+	}
+}
+
+func TestSwitchRequestKeyframe(t *testing.T) {
+	requested := make([]string, 0)
+	v := NewViewer(ladder, func(name string) { requested = append(requested, name) })
+	if len(requested) != 1 || requested[0] != "hd" {
+		t.Fatalf("a new viewer should ask hd for a keyframe, asked %v", requested)
+	}
+
+	// 15 fps stream, a switch leaves one frame of it
+	v.Push("hd", vp8Packet(1, 10, 1000, true))
+	v.Push("hd", vp8Packet(1, 11, 7000, false))
+	v.Pin("low")
+	if len(requested) != 2 || requested[1] != "low" {
+		t.Fatalf("switching should ask low for a keyframe, asked %v", requested)
+	}
+	v.Pin("low")
+	if len(requested) != 2 {
+		t.Fatalf("pinning again should not ask again, asked %v", requested)
+	}
+	switched := v.Push("low", vp8Packet(3, 80, 50000, true))
+	if switched == nil || switched.Timestamp != 7000+6000 {
+		t.Fatalf("unexpected switched packet %+v", switched)
+	}
+}
@@ -0,0 +1,171 @@
+package room
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// Participant what everyone in room know about a participant
+type Participant struct {
+	SignalID    string    `json:"signalID"`
+	SessionID   string    `json:"sessionID,omitempty"` // empty for ingests
+	HasAudio    bool      `json:"hasAudio"`
+	HasVideo    bool      `json:"hasVideo"`
+	AudioMuted  bool      `json:"audioMuted"`  // by a moderator
+	VideoHidden bool      `json:"videoHidden"` // by a moderator
+	JoinedAt    time.Time `json:"joinedAt"`
+}
+
+// State participants of a room and moderation of them.
+// Mute and hide outlive the participant so leaving and joining again does not lift them
+type State struct {
+	participants map[string]*Participant
+	muted        map[string]bool
+	hidden       map[string]bool
+	handler      func(participants []*Participant) // called after every change
+	mutex        sync.Mutex
+}
+
+// NewState handler can be nil and must not call back into State
+func NewState(handler func(participants []*Participant)) *State {
+	return &State{
+		participants: make(map[string]*Participant),
+		muted:        make(map[string]bool),
+		hidden:       make(map[string]bool),
+		handler:      handler,
+	}
+}
+
+// Join add or replace signalID
+func (s *State) Join(signalID, sessionID string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.participants[signalID] = &Participant{
+		SignalID:  signalID,
+		SessionID: sessionID,
+		JoinedAt:  time.Now(),
+	}
+	s.changed()
+}
+
+// Leave remove signalID, its mute and hide are kept
+func (s *State) Leave(signalID string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if _, has := s.participants[signalID]; !has {
+		return
+	}
+	delete(s.participants, signalID)
+	s.changed()
+}
+
+// SetTrack mark signalID publishing audio or video
+func (s *State) SetTrack(signalID, kind string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	p, has := s.participants[signalID]
+	if !has {
+		return
+	}
+	switch {
+	case kind == "audio" && !p.HasAudio:
+		p.HasAudio = true
+	case kind == "video" && !p.HasVideo:
+		p.HasVideo = true
+	default:
+		return
+	}
+	s.changed()
+}
+
+// SetAudioMuted return false when nothing changed
+func (s *State) SetAudioMuted(signalID string, muted bool) bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.muted[signalID] == muted {
+		return false
+	}
+	if muted {
+		s.muted[signalID] = true
+	} else {
+		delete(s.muted, signalID)
+	}
+	s.changed()
+	return true
+}
+
+// SetVideoHidden return false when nothing changed
+func (s *State) SetVideoHidden(signalID string, hidden bool) bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.hidden[signalID] == hidden {
+		return false
+	}
+	if hidden {
+		s.hidden[signalID] = true
+	} else {
+		delete(s.hidden, signalID)
+	}
+	s.changed()
+	return true
+}
+
+// IsAudioMuted linter
+func (s *State) IsAudioMuted(signalID string) bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.muted[signalID]
+}
+
+// IsVideoHidden linter
+func (s *State) IsVideoHidden(signalID string) bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.hidden[signalID]
+}
+
+// Get a copy of participant signalID, nil if not in room
+func (s *State) Get(signalID string) *Participant {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if _, has := s.participants[signalID]; !has {
+		return nil
+	}
+	return s.get(signalID)
+}
+
+// List copies of participants in join order
+func (s *State) List() []*Participant {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.list()
+}
+
+func (s *State) get(signalID string) *Participant {
+	p := *s.participants[signalID]
+	p.AudioMuted = s.muted[signalID]
+	p.VideoHidden = s.hidden[signalID]
+	return &p
+}
+
+func (s *State) list() []*Participant {
+	participants := make([]*Participant, 0, len(s.participants))
+	for id := range s.participants {
+		participants = append(participants, s.get(id))
+	}
+	sort.Slice(participants, func(i, j int) bool {
+		if participants[i].JoinedAt.Equal(participants[j].JoinedAt) {
+			return participants[i].SignalID < participants[j].SignalID
+		}
+		return participants[i].JoinedAt.Before(participants[j].JoinedAt)
+	})
+	return participants
+}
+
+// changed call handler in order of changes, mutex must be held
+func (s *State) changed() {
+	if s.handler != nil {
+		s.handler(s.list())
+	}
+}
@@ -0,0 +1,42 @@
+package room
+
+import (
+	"testing"
+)
+
+func TestModerationOutliveParticipant(t *testing.T) {
+	changes := 0
+	state := NewState(func(participants []*Participant) { changes++ })
+
+	state.Join("a", "s1")
+	state.Join("b", "s2")
+	state.SetTrack("a", "audio")
+	state.SetTrack("a", "audio")
+	if !state.SetAudioMuted("a", true) || state.SetAudioMuted("a", true) {
+		t.Fatal("mute should change state once")
+	}
+	if changes != 4 {
+		t.Fatalf("handler called %d times, want 4", changes)
+	}
+
+	list := state.List()
+	if len(list) != 2 || list[0].SignalID != "a" || !list[0].AudioMuted || !list[0].HasAudio {
+		t.Fatalf("unexpected state %+v", list[0])
+	}
+
+	// joining again does not lift the mute
+	state.Leave("a")
+	if state.Get("a") != nil {
+		t.Fatal("participant left but still in room")
+	}
+	state.Join("a", "s3")
+	if !state.Get("a").AudioMuted || state.Get("a").HasAudio {
+		t.Fatalf("unexpected state after rejoin %+v", state.Get("a"))
+	}
+
+	state.SetVideoHidden("b", true)
+	state.SetVideoHidden("b", false)
+	if state.IsVideoHidden("b") {
+		t.Fatal("video still hidden")
+	}
+}
@@ -0,0 +1,213 @@
+package rtmp
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+)
+
+// amf0 markers, see AMF0 specification 2.1
+const (
+	amfNumber      = 0x00
+	amfBoolean     = 0x01
+	amfString      = 0x02
+	amfObject      = 0x03
+	amfNull        = 0x05
+	amfUndefined   = 0x06
+	amfECMAArray   = 0x08
+	amfObjectEnd   = 0x09
+	amfStrictArray = 0x0a
+)
+
+// amfObj an amf0 object, keys are written in sorted order
+type amfObj map[string]interface{}
+
+// encodeAMF marshal values one after another
+func encodeAMF(values ...interface{}) ([]byte, error) {
+	b := make([]byte, 0, 128)
+	var err error
+	for _, v := range values {
+		if b, err = appendAMF(b, v); err != nil {
+			return nil, err
+		}
+	}
+	return b, nil
+}
+
+func appendAMF(b []byte, value interface{}) ([]byte, error) {
+	switch v := value.(type) {
+	case nil:
+		return append(b, amfNull), nil
+	case float64:
+		b = append(b, amfNumber)
+		return appendUint64(b, math.Float64bits(v)), nil
+	case int:
+		return appendAMF(b, float64(v))
+	case uint32:
+		return appendAMF(b, float64(v))
+	case bool:
+		if v {
+			return append(b, amfBoolean, 1), nil
+		}
+		return append(b, amfBoolean, 0), nil
+	case string:
+		b = append(b, amfString)
+		return appendAMFString(b, v), nil
+	case []string:
+		b = append(b, amfStrictArray)
+		b = appendUint32(b, uint32(len(v)))
+		var err error
+		for _, s := range v {
+			if b, err = appendAMF(b, s); err != nil {
+				return nil, err
+			}
+		}
+		return b, nil
+	case amfObj:
+		b = append(b, amfObject)
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		var err error
+		for _, key := range keys {
+			b = appendAMFString(b, key)
+			if b, err = appendAMF(b, v[key]); err != nil {
+				return nil, err
+			}
+		}
+		return append(b, 0, 0, amfObjectEnd), nil
+	default:
+		return nil, fmt.Errorf("amf type %T is not supported", value)
+	}
+}
+
+func appendAMFString(b []byte, s string) []byte {
+	b = append(b, byte(len(s)>>8), byte(len(s)))
+	return append(b, s...)
+}
+
+// decodeAMF unmarshal all values of data
+func decodeAMF(data []byte) ([]interface{}, error) {
+	r := &amfReader{data: data}
+	values := make([]interface{}, 0, 4)
+	for r.pos < len(r.data) {
+		v, err := r.value()
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, v)
+	}
+	return values, nil
+}
+
+type amfReader struct {
+	data []byte
+	pos  int
+}
+
+func (r *amfReader) read(n int) ([]byte, error) {
+	if r.pos+n > len(r.data) {
+		return nil, io.ErrUnexpectedEOF
+	}
+	b := r.data[r.pos : r.pos+n]
+	r.pos += n
+	return b, nil
+}
+
+func (r *amfReader) string() (string, error) {
+	size, err := r.read(2)
+	if err != nil {
+		return "", err
+	}
+	s, err := r.read(int(binary.BigEndian.Uint16(size)))
+	return string(s), err
+}
+
+func (r *amfReader) value() (interface{}, error) {
+	marker, err := r.read(1)
+	if err != nil {
+		return nil, err
+	}
+
+	switch marker[0] {
+	case amfNumber:
+		b, err := r.read(8)
+		if err != nil {
+			return nil, err
+		}
+		return math.Float64frombits(binary.BigEndian.Uint64(b)), nil
+	case amfBoolean:
+		b, err := r.read(1)
+		if err != nil {
+			return nil, err
+		}
+		return b[0] != 0, nil
+	case amfString:
+		return r.string()
+	case amfNull, amfUndefined:
+		return nil, nil
+	case amfECMAArray:
+		if _, err := r.read(4); err != nil {
+			return nil, err
+		}
+		return r.object()
+	case amfObject:
+		return r.object()
+	case amfStrictArray:
+		b, err := r.read(4)
+		if err != nil {
+			return nil, err
+		}
+		count := binary.BigEndian.Uint32(b)
+		values := make([]interface{}, 0)
+		for i := uint32(0); i < count; i++ {
+			v, err := r.value()
+			if err != nil {
+				return nil, err
+			}
+			values = append(values, v)
+		}
+		return values, nil
+	default:
+		return nil, fmt.Errorf("amf marker %d is not supported", marker[0])
+	}
+}
+
+func (r *amfReader) object() (amfObj, error) {
+	obj := amfObj{}
+	for {
+		key, err := r.string()
+		if err != nil {
+			return nil, err
+		}
+		if key == "" {
+			end, err := r.read(1)
+			if err != nil {
+				return nil, err
+			}
+			if end[0] != amfObjectEnd {
+				return nil, fmt.Errorf("amf object end expected, got %d", end[0])
+			}
+			return obj, nil
+		}
+
+		v, err := r.value()
+		if err != nil {
+			return nil, err
+		}
+		obj[key] = v
+	}
+}
+
+func appendUint32(b []byte, v uint32) []byte {
+	return append(b, byte(v>>24), byte(v>>16), byte(v>>8), byte(v))
+}
+
+func appendUint64(b []byte, v uint64) []byte {
+	return appendUint32(appendUint32(b, uint32(v>>32)), uint32(v))
+}
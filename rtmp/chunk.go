@@ -0,0 +1,254 @@
+package rtmp
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+// message types, see RTMP specification 5.4 and 7.1
+const (
+	typeSetChunkSize     = 1
+	typeAbort            = 2
+	typeAck              = 3
+	typeUserControl      = 4
+	typeWindowAckSize    = 5
+	typeSetPeerBandwidth = 6
+	typeAudio            = 8
+	typeVideo            = 9
+	typeDataAMF0         = 18
+	typeCommandAMF0      = 20
+
+	defaultChunkSize = 128
+	maxTimestamp     = 0xffffff
+	maxMessageSize   = 16 * 1024 * 1024
+)
+
+type message struct {
+	typeID    uint8
+	streamID  uint32
+	timestamp uint32
+	payload   []byte
+}
+
+// chunkWriter split messages to chunks, every message starts with a type 0 chunk
+type chunkWriter struct {
+	out       *bufio.Writer
+	chunkSize int
+}
+
+func newChunkWriter(out io.Writer) *chunkWriter {
+	return &chunkWriter{
+		out:       bufio.NewWriter(out),
+		chunkSize: defaultChunkSize,
+	}
+}
+
+func appendBasicHeader(b []byte, format uint8, csid uint32) []byte {
+	switch {
+	case csid < 64:
+		return append(b, format<<6|byte(csid))
+	case csid < 320:
+		return append(b, format<<6, byte(csid-64))
+	default:
+		return append(b, format<<6|1, byte(csid-64), byte((csid-64)>>8))
+	}
+}
+
+func (w *chunkWriter) write(csid uint32, msg *message) error {
+	if len(msg.payload) > maxMessageSize {
+		return fmt.Errorf("rtmp message too large: %d", len(msg.payload))
+	}
+
+	extended := msg.timestamp >= maxTimestamp
+	timestamp := msg.timestamp
+	if extended {
+		timestamp = maxTimestamp
+	}
+
+	header := appendBasicHeader(make([]byte, 0, 18), 0, csid)
+	header = append(header, byte(timestamp>>16), byte(timestamp>>8), byte(timestamp))
+	size := len(msg.payload)
+	header = append(header, byte(size>>16), byte(size>>8), byte(size), msg.typeID)
+	header = append(header, byte(msg.streamID), byte(msg.streamID>>8), byte(msg.streamID>>16), byte(msg.streamID>>24))
+	if extended {
+		header = appendUint32(header, msg.timestamp)
+	}
+
+	payload := msg.payload
+	for {
+		if _, err := w.out.Write(header); err != nil {
+			return err
+		}
+
+		n := len(payload)
+		if n > w.chunkSize {
+			n = w.chunkSize
+		}
+		if _, err := w.out.Write(payload[:n]); err != nil {
+			return err
+		}
+		payload = payload[n:]
+		if len(payload) == 0 {
+			break
+		}
+
+		header = appendBasicHeader(header[:0], 3, csid)
+		if extended {
+			header = appendUint32(header, msg.timestamp)
+		}
+	}
+	return w.out.Flush()
+}
+
+type chunkStream struct {
+	timestamp uint32
+	delta     uint32
+	length    uint32
+	typeID    uint8
+	streamID  uint32
+	extended  bool
+	payload   []byte
+}
+
+// chunkReader assemble chunks back to messages
+type chunkReader struct {
+	in        *bufio.Reader
+	chunkSize int
+	streams   map[uint32]*chunkStream
+}
+
+func newChunkReader(in io.Reader) *chunkReader {
+	return &chunkReader{
+		in:        bufio.NewReader(in),
+		chunkSize: defaultChunkSize,
+		streams:   make(map[uint32]*chunkStream),
+	}
+}
+
+func (r *chunkReader) readUint(n int) (uint32, error) {
+	b := make([]byte, n)
+	if _, err := io.ReadFull(r.in, b); err != nil {
+		return 0, err
+	}
+	v := uint32(0)
+	for _, c := range b {
+		v = v<<8 | uint32(c)
+	}
+	return v, nil
+}
+
+// read next complete message
+func (r *chunkReader) read() (*message, error) {
+	for {
+		first, err := r.in.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+
+		format := first >> 6
+		csid := uint32(first & 0x3f)
+		switch csid {
+		case 0:
+			v, err := r.readUint(1)
+			if err != nil {
+				return nil, err
+			}
+			csid = v + 64
+		case 1:
+			b := make([]byte, 2)
+			if _, err := io.ReadFull(r.in, b); err != nil {
+				return nil, err
+			}
+			csid = uint32(b[0]) + uint32(b[1])<<8 + 64
+		}
+
+		stream, ok := r.streams[csid]
+		if !ok {
+			if format != 0 {
+				return nil, fmt.Errorf("rtmp chunk stream %d starts with format %d", csid, format)
+			}
+			stream = &chunkStream{}
+			r.streams[csid] = stream
+		}
+
+		if format <= 2 {
+			timestamp, err := r.readUint(3)
+			if err != nil {
+				return nil, err
+			}
+			if format <= 1 {
+				if stream.length, err = r.readUint(3); err != nil {
+					return nil, err
+				}
+				typeID, err := r.readUint(1)
+				if err != nil {
+					return nil, err
+				}
+				stream.typeID = uint8(typeID)
+			}
+			if format == 0 {
+				b := make([]byte, 4)
+				if _, err := io.ReadFull(r.in, b); err != nil {
+					return nil, err
+				}
+				stream.streamID = binary.LittleEndian.Uint32(b)
+			}
+
+			stream.extended = timestamp == maxTimestamp
+			if stream.extended {
+				if timestamp, err = r.readUint(4); err != nil {
+					return nil, err
+				}
+			}
+			if format == 0 {
+				stream.timestamp = timestamp
+				stream.delta = 0
+			} else {
+				stream.delta = timestamp
+			}
+		} else if stream.extended {
+			if _, err := r.readUint(4); err != nil {
+				return nil, err
+			}
+		}
+
+		if len(stream.payload) == 0 && format != 0 {
+			stream.timestamp += stream.delta
+		}
+		if stream.length > maxMessageSize {
+			return nil, fmt.Errorf("rtmp message too large: %d", stream.length)
+		}
+
+		n := int(stream.length) - len(stream.payload)
+		if n > r.chunkSize {
+			n = r.chunkSize
+		}
+		chunk := make([]byte, n)
+		if _, err := io.ReadFull(r.in, chunk); err != nil {
+			return nil, err
+		}
+		stream.payload = append(stream.payload, chunk...)
+
+		if len(stream.payload) < int(stream.length) {
+			continue
+		}
+
+		msg := &message{
+			typeID:    stream.typeID,
+			streamID:  stream.streamID,
+			timestamp: stream.timestamp,
+			payload:   stream.payload,
+		}
+		stream.payload = nil
+
+		if msg.typeID == typeSetChunkSize {
+			if len(msg.payload) < 4 {
+				return nil, fmt.Errorf("invalid rtmp set chunk size")
+			}
+			r.chunkSize = int(binary.BigEndian.Uint32(msg.payload) & 0x7fffffff)
+		}
+		return msg, nil
+	}
+}
@@ -0,0 +1,335 @@
+package rtmp
+
+import (
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/lamhai1401/gologs/logs"
+)
+
+const (
+	handshakeSize = 1536
+	chunkSize     = 4096
+	dialTimeout   = 10 * time.Second
+
+	// chunk stream ids
+	csidControl = 2
+	csidCommand = 3
+	csidAudio   = 4
+	csidData    = 5
+	csidVideo   = 6
+
+	// user control events
+	eventPingRequest  = 6
+	eventPingResponse = 7
+)
+
+// Client publish one stream to a rtmp server
+type Client struct {
+	conn     net.Conn
+	writer   *chunkWriter
+	reader   *chunkReader
+	app      string
+	key      string
+	tcURL    string
+	streamID uint32
+	isClosed bool
+	mutex    sync.Mutex
+}
+
+// Dial connect to rtmp(s)://host[:port]/app/key and start publishing key
+func Dial(rawURL string) (*Client, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+
+	parts := strings.SplitN(strings.TrimPrefix(u.Path, "/"), "/", 2)
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return nil, fmt.Errorf("rtmp url must be rtmp://host/app/key: %s", rawURL)
+	}
+
+	host := u.Host
+	var conn net.Conn
+	switch u.Scheme {
+	case "rtmp":
+		if u.Port() == "" {
+			host = net.JoinHostPort(u.Hostname(), "1935")
+		}
+		conn, err = net.DialTimeout("tcp", host, dialTimeout)
+	case "rtmps":
+		if u.Port() == "" {
+			host = net.JoinHostPort(u.Hostname(), "443")
+		}
+		conn, err = tls.DialWithDialer(&net.Dialer{Timeout: dialTimeout}, "tcp", host, &tls.Config{
+			ServerName: u.Hostname(),
+		})
+	default:
+		return nil, fmt.Errorf("rtmp scheme %s is not supported", u.Scheme)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	c := &Client{
+		conn:   conn,
+		writer: newChunkWriter(conn),
+		reader: newChunkReader(conn),
+		app:    parts[0],
+		key:    parts[1],
+		tcURL:  fmt.Sprintf("%s://%s/%s", u.Scheme, u.Host, parts[0]),
+	}
+	if u.RawQuery != "" {
+		c.key += "?" + u.RawQuery
+	}
+
+	conn.SetDeadline(time.Now().Add(dialTimeout))
+	if err := c.publish(); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	conn.SetDeadline(time.Time{})
+
+	go c.readLoop()
+	return c, nil
+}
+
+// handshake simple handshake, see RTMP specification 5.2
+func (c *Client) handshake() error {
+	c0c1 := make([]byte, 1+handshakeSize)
+	c0c1[0] = 3
+	if _, err := rand.Read(c0c1[9:]); err != nil {
+		return err
+	}
+	if _, err := c.conn.Write(c0c1); err != nil {
+		return err
+	}
+
+	s0s1s2 := make([]byte, 1+2*handshakeSize)
+	if _, err := io.ReadFull(c.conn, s0s1s2); err != nil {
+		return err
+	}
+	if s0s1s2[0] != 3 {
+		return fmt.Errorf("rtmp version %d is not supported", s0s1s2[0])
+	}
+
+	// c2 echo s1
+	_, err := c.conn.Write(s0s1s2[1 : 1+handshakeSize])
+	return err
+}
+
+func (c *Client) publish() error {
+	if err := c.handshake(); err != nil {
+		return fmt.Errorf("rtmp handshake err: %v", err)
+	}
+
+	if err := c.writer.write(csidControl, &message{
+		typeID:  typeSetChunkSize,
+		payload: appendUint32(nil, chunkSize),
+	}); err != nil {
+		return err
+	}
+	c.writer.chunkSize = chunkSize
+
+	if err := c.command(0, "connect", 1, amfObj{
+		"app":        c.app,
+		"type":       "nonprivate",
+		"flashVer":   "FMLE/3.0 (compatible; testrtc)",
+		"tcUrl":      c.tcURL,
+		"fourCcList": []string{videoFourCC, audioFourCC},
+	}); err != nil {
+		return err
+	}
+	if _, err := c.waitResult(1); err != nil {
+		return fmt.Errorf("rtmp connect err: %v", err)
+	}
+
+	if err := c.command(0, "releaseStream", 2, nil, c.key); err != nil {
+		return err
+	}
+	if err := c.command(0, "FCPublish", 3, nil, c.key); err != nil {
+		return err
+	}
+	if err := c.command(0, "createStream", 4, nil); err != nil {
+		return err
+	}
+	values, err := c.waitResult(4)
+	if err != nil {
+		return fmt.Errorf("rtmp create stream err: %v", err)
+	}
+	if len(values) < 4 {
+		return fmt.Errorf("rtmp create stream has no stream id")
+	}
+	id, ok := values[3].(float64)
+	if !ok {
+		return fmt.Errorf("invalid rtmp stream id: %v", values[3])
+	}
+	c.streamID = uint32(id)
+
+	if err := c.command(c.streamID, "publish", 5, nil, c.key, "live"); err != nil {
+		return err
+	}
+	return c.waitStatus("NetStream.Publish.Start")
+}
+
+func (c *Client) command(streamID uint32, name string, transactionID int, values ...interface{}) error {
+	payload, err := encodeAMF(append([]interface{}{name, transactionID}, values...)...)
+	if err != nil {
+		return err
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.writer.write(csidCommand, &message{
+		typeID:   typeCommandAMF0,
+		streamID: streamID,
+		payload:  payload,
+	})
+}
+
+// nextCommand read until next command message, answering control messages on the way
+func (c *Client) nextCommand() ([]interface{}, error) {
+	for {
+		msg, err := c.reader.read()
+		if err != nil {
+			return nil, err
+		}
+		if err := c.handleControl(msg); err != nil {
+			return nil, err
+		}
+		if msg.typeID != typeCommandAMF0 {
+			continue
+		}
+
+		values, err := decodeAMF(msg.payload)
+		if err != nil {
+			return nil, err
+		}
+		if len(values) < 2 {
+			continue
+		}
+		return values, nil
+	}
+}
+
+func (c *Client) waitResult(transactionID float64) ([]interface{}, error) {
+	for {
+		values, err := c.nextCommand()
+		if err != nil {
+			return nil, err
+		}
+		if id, _ := values[1].(float64); id != transactionID {
+			continue
+		}
+
+		switch values[0] {
+		case "_result":
+			return values, nil
+		case "_error":
+			return nil, fmt.Errorf("%v", values[2:])
+		}
+	}
+}
+
+func (c *Client) waitStatus(code string) error {
+	for {
+		values, err := c.nextCommand()
+		if err != nil {
+			return err
+		}
+		if values[0] != "onStatus" || len(values) < 4 {
+			continue
+		}
+
+		info, _ := values[3].(amfObj)
+		got, _ := info["code"].(string)
+		if got == code {
+			return nil
+		}
+		return fmt.Errorf("rtmp status %s: %v", got, info["description"])
+	}
+}
+
+func (c *Client) handleControl(msg *message) error {
+	if msg.typeID != typeUserControl || len(msg.payload) < 6 {
+		return nil
+	}
+	if binary.BigEndian.Uint16(msg.payload) != eventPingRequest {
+		return nil
+	}
+
+	payload := append([]byte{0, eventPingResponse}, msg.payload[2:6]...)
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.writer.write(csidControl, &message{
+		typeID:  typeUserControl,
+		payload: payload,
+	})
+}
+
+// readLoop answer pings and log server status while publishing
+func (c *Client) readLoop() {
+	for {
+		msg, err := c.reader.read()
+		if err != nil {
+			if !c.checkClose() {
+				logs.Error(fmt.Sprintf("Read rtmp %s err: %v", c.tcURL, err))
+			}
+			return
+		}
+		if err := c.handleControl(msg); err != nil {
+			logs.Error(fmt.Sprintf("Answer rtmp %s ping err: %v", c.tcURL, err))
+		}
+
+		if msg.typeID == typeCommandAMF0 {
+			if values, err := decodeAMF(msg.payload); err == nil && len(values) > 0 {
+				logs.Debug(fmt.Sprintf("Receive rtmp command from %s: %v", c.tcURL, values))
+			}
+		}
+	}
+}
+
+// writeMedia write an audio, video or data message of published stream
+func (c *Client) writeMedia(csid uint32, typeID uint8, timestamp uint32, payload []byte) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.isClosed {
+		return fmt.Errorf("rtmp client was closed")
+	}
+
+	return c.writer.write(csid, &message{
+		typeID:    typeID,
+		streamID:  c.streamID,
+		timestamp: timestamp,
+		payload:   payload,
+	})
+}
+
+func (c *Client) checkClose() bool {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.isClosed
+}
+
+// Close unpublish stream and close connection
+func (c *Client) Close() error {
+	if c.checkClose() {
+		return nil
+	}
+
+	c.command(0, "FCUnpublish", 6, nil, c.key)
+	c.command(0, "deleteStream", 7, nil, c.streamID)
+
+	c.mutex.Lock()
+	c.isClosed = true
+	c.mutex.Unlock()
+	return c.conn.Close()
+}
@@ -0,0 +1,146 @@
+package rtmp
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/lamhai1401/gologs/logs"
+	"github.com/lamhai1401/testrtc/codec"
+	"github.com/pion/rtp"
+)
+
+const (
+	videoClockRate = 90000
+	audioClockRate = 48000
+)
+
+// clock map rtp timestamps of one stream to ms from start of egress
+type clock struct {
+	clockRate uint32
+	base      int64
+	lastTS    uint32
+	elapsed   int64
+	started   bool
+}
+
+func (c *clock) ms(timestamp uint32, arrival, start time.Time) uint32 {
+	if !c.started {
+		c.started = true
+		c.base = int64(arrival.Sub(start) / time.Millisecond)
+		c.lastTS = timestamp
+	}
+	c.elapsed += int64(int32(timestamp - c.lastTS))
+	c.lastTS = timestamp
+
+	ms := c.base + c.elapsed*1000/int64(c.clockRate)
+	if ms < 0 {
+		return 0
+	}
+	return uint32(ms)
+}
+
+// Egress push mixer output (vp8 and opus) to a rtmp server
+type Egress struct {
+	url       string
+	client    *Client
+	builder   *codec.FrameBuilder
+	video     *clock
+	audio     *clock
+	startTime time.Time
+	started   bool // sequence headers were sent
+	isClosed  bool
+	mutex     sync.Mutex
+}
+
+// NewEgress connect and publish to url
+func NewEgress(url string) (*Egress, error) {
+	client, err := Dial(url)
+	if err != nil {
+		return nil, err
+	}
+
+	logs.Info(fmt.Sprintf("Start rtmp egress to %s", url))
+	return &Egress{
+		url:       url,
+		client:    client,
+		builder:   codec.NewFrameBuilder(codec.VP8),
+		video:     &clock{clockRate: videoClockRate},
+		audio:     &clock{clockRate: audioClockRate},
+		startTime: time.Now(),
+	}, nil
+}
+
+// GetURL linter
+func (e *Egress) GetURL() string {
+	return e.url
+}
+
+// PushVideo a mixed vp8 packet, stream starts at first keyframe
+func (e *Egress) PushVideo(pkt *rtp.Packet) error {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	if e.isClosed {
+		return fmt.Errorf("rtmp egress was closed")
+	}
+
+	frame, err := e.builder.Push(pkt)
+	if err != nil || frame == nil {
+		return err
+	}
+
+	if !e.started {
+		if !frame.Keyframe {
+			return nil
+		}
+		if err := e.sendHeaders(frame.Width, frame.Height); err != nil {
+			return err
+		}
+		e.started = true
+	}
+
+	ms := e.video.ms(frame.Timestamp, time.Now(), e.startTime)
+	return e.client.writeMedia(csidVideo, typeVideo, ms, videoFrame(frame.Data, frame.Keyframe))
+}
+
+// PushAudio a mixed opus packet, audio before first keyframe is dropped
+func (e *Egress) PushAudio(pkt *rtp.Packet) error {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	if e.isClosed {
+		return fmt.Errorf("rtmp egress was closed")
+	}
+	if !e.started {
+		return nil
+	}
+
+	ms := e.audio.ms(pkt.Timestamp, time.Now(), e.startTime)
+	return e.client.writeMedia(csidAudio, typeAudio, ms, audioFrame(pkt.Payload))
+}
+
+func (e *Egress) sendHeaders(width, height uint16) error {
+	meta, err := metadata(width, height)
+	if err != nil {
+		return err
+	}
+	if err := e.client.writeMedia(csidData, typeDataAMF0, 0, meta); err != nil {
+		return err
+	}
+	if err := e.client.writeMedia(csidVideo, typeVideo, 0, videoSequenceStart()); err != nil {
+		return err
+	}
+	return e.client.writeMedia(csidAudio, typeAudio, 0, audioSequenceStart())
+}
+
+// Close unpublish and disconnect
+func (e *Egress) Close() error {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	if e.isClosed {
+		return nil
+	}
+	e.isClosed = true
+
+	logs.Info(fmt.Sprintf("Stop rtmp egress to %s", e.url))
+	return e.client.Close()
+}
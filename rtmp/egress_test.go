@@ -0,0 +1,132 @@
+package rtmp
+
+import (
+	"bytes"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/pion/rtp"
+)
+
+// serve a fake rtmp server accepting one publisher, media messages are sent to media
+func serve(t *testing.T, listener net.Listener, media chan *message) {
+	conn, err := listener.Accept()
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+
+	c0c1 := make([]byte, 1+handshakeSize)
+	if _, err := io.ReadFull(conn, c0c1); err != nil {
+		t.Error(err)
+		return
+	}
+	s0s1s2 := append([]byte{3}, make([]byte, handshakeSize)...)
+	s0s1s2 = append(s0s1s2, c0c1[1:]...)
+	if _, err := conn.Write(s0s1s2); err != nil {
+		t.Error(err)
+		return
+	}
+	if _, err := io.ReadFull(conn, make([]byte, handshakeSize)); err != nil {
+		t.Error(err)
+		return
+	}
+
+	reader := newChunkReader(conn)
+	writer := newChunkWriter(conn)
+	reply := func(streamID uint32, values ...interface{}) {
+		payload, _ := encodeAMF(values...)
+		writer.write(csidCommand, &message{typeID: typeCommandAMF0, streamID: streamID, payload: payload})
+	}
+
+	for {
+		msg, err := reader.read()
+		if err != nil {
+			close(media)
+			return
+		}
+
+		switch msg.typeID {
+		case typeCommandAMF0:
+			values, _ := decodeAMF(msg.payload)
+			switch values[0] {
+			case "connect":
+				reply(0, "_result", 1, amfObj{}, amfObj{"code": "NetConnection.Connect.Success"})
+			case "createStream":
+				reply(0, "_result", 4, nil, 1)
+			case "publish":
+				reply(msg.streamID, "onStatus", 0, nil, amfObj{"code": "NetStream.Publish.Start"})
+			}
+		case typeVideo, typeAudio, typeDataAMF0:
+			media <- msg
+		}
+	}
+}
+
+func TestEgress(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+
+	media := make(chan *message, 100)
+	go serve(t, listener, media)
+
+	egress, err := NewEgress("rtmp://" + listener.Addr().String() + "/live/key")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// audio before first keyframe is dropped
+	if err := egress.PushAudio(&rtp.Packet{Payload: []byte{0xfc}}); err != nil {
+		t.Fatal(err)
+	}
+
+	// large keyframe spans several chunks
+	keyframe := append([]byte{0x10, 0x00, 0x00, 0x00, 0x9d, 0x01, 0x2a, 0x80, 0x02, 0xe0, 0x01}, make([]byte, 10000)...)
+	if err := egress.PushVideo(&rtp.Packet{
+		Header:  rtp.Header{SequenceNumber: 1, Timestamp: 3000, Marker: true},
+		Payload: keyframe,
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if err := egress.PushAudio(&rtp.Packet{
+		Header:  rtp.Header{SequenceNumber: 1, Timestamp: 960},
+		Payload: []byte{0xfc, 0x01},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	egress.Close()
+
+	expects := []struct {
+		typeID uint8
+		prefix []byte
+		size   int
+	}{
+		{typeDataAMF0, []byte{amfString, 0, 13, '@'}, 0},
+		{typeVideo, []byte{0x90, 'v', 'p', '0', '8'}, 0},
+		{typeAudio, []byte{0x90, 'O', 'p', 'u', 's'}, 24},
+		{typeVideo, []byte{0x91, 'v', 'p', '0', '8', 0x00, 0x00, 0x00, 0x9d}, 5 + len(keyframe) - 1},
+		{typeAudio, []byte{0x91, 'O', 'p', 'u', 's', 0xfc, 0x01}, 7},
+	}
+
+	for i, expect := range expects {
+		select {
+		case msg, ok := <-media:
+			if !ok {
+				t.Fatalf("connection closed before message %d", i)
+			}
+			if msg.typeID != expect.typeID || !bytes.HasPrefix(msg.payload, expect.prefix) {
+				t.Fatalf("message %d: type %d payload % x", i, msg.typeID, msg.payload[:8])
+			}
+			if expect.size > 0 && len(msg.payload) != expect.size {
+				t.Fatalf("message %d: size %d, expect %d", i, len(msg.payload), expect.size)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("timeout waiting message %d", i)
+		}
+	}
+}
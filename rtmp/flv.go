@@ -0,0 +1,81 @@
+package rtmp
+
+import (
+	"encoding/binary"
+)
+
+// enhanced rtmp tag bodies for vp8 and opus, see https://github.com/veovera/enhanced-rtmp
+const (
+	videoFourCC = "vp08"
+	audioFourCC = "Opus"
+
+	exHeader          = 0x80 // video tag uses fourcc
+	audioExHeader     = 9    // sound format of audio tag using fourcc
+	frameTypeKey      = 1
+	frameTypeInter    = 2
+	packetTypeStart   = 0 // sequence start
+	packetTypeFrames  = 1 // coded frames
+	audioSampleRate   = 48000
+	audioChannels     = 2
+	opusHeadVersion   = 1
+	opusHeadSize      = 19
+	vpccVersion       = 1
+	vpccBitDepthColor = 0x82 // 8 bit, 4:2:0 colocated, limited range
+)
+
+func fourCCNumber(fourCC string) uint32 {
+	return binary.BigEndian.Uint32([]byte(fourCC))
+}
+
+// videoSequenceStart vp codec configuration record of vp8
+func videoSequenceStart() []byte {
+	b := append([]byte{exHeader | frameTypeKey<<4 | packetTypeStart}, videoFourCC...)
+	b = append(b, vpccVersion, 0, 0, 0) // version and flags
+	b = append(b, 0, 0, vpccBitDepthColor, 1, 1, 1)
+	return append(b, 0, 0) // no codec initialization data
+}
+
+func videoFrame(data []byte, keyframe bool) []byte {
+	frameType := byte(frameTypeInter)
+	if keyframe {
+		frameType = frameTypeKey
+	}
+
+	b := make([]byte, 0, 5+len(data))
+	b = append(b, exHeader|frameType<<4|packetTypeFrames)
+	b = append(b, videoFourCC...)
+	return append(b, data...)
+}
+
+// audioSequenceStart opus identification header, see RFC 7845 5.1
+func audioSequenceStart() []byte {
+	b := append([]byte{audioExHeader<<4 | packetTypeStart}, audioFourCC...)
+	head := make([]byte, opusHeadSize)
+	copy(head, "OpusHead")
+	head[8] = opusHeadVersion
+	head[9] = audioChannels
+	binary.LittleEndian.PutUint16(head[10:], 0) // pre skip
+	binary.LittleEndian.PutUint32(head[12:], audioSampleRate)
+	return append(b, head...)
+}
+
+func audioFrame(data []byte) []byte {
+	b := make([]byte, 0, 5+len(data))
+	b = append(b, audioExHeader<<4|packetTypeFrames)
+	b = append(b, audioFourCC...)
+	return append(b, data...)
+}
+
+// metadata @setDataFrame onMetaData of published stream
+func metadata(width, height uint16) ([]byte, error) {
+	return encodeAMF("@setDataFrame", "onMetaData", amfObj{
+		"width":           int(width),
+		"height":          int(height),
+		"videocodecid":    fourCCNumber(videoFourCC),
+		"audiocodecid":    fourCCNumber(audioFourCC),
+		"audiosamplerate": audioSampleRate,
+		"audiochannels":   audioChannels,
+		"stereo":          audioChannels == 2,
+		"encoder":         "testrtc",
+	})
+}
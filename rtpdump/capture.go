@@ -0,0 +1,91 @@
+package rtpdump
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/pion/rtp"
+)
+
+// Capture write incoming packets of one peer to a dump file, safe for many tracks
+type Capture struct {
+	path   string
+	file   *os.File
+	writer *Writer
+	mutex  sync.Mutex
+}
+
+// NewCapture create dump file of signalID in dir
+func NewCapture(dir, signalID string) (*Capture, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	path := filepath.Join(dir, fmt.Sprintf("%s_%d.rtpdump", signalID, now.UnixNano()/int64(time.Millisecond)))
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+
+	writer, err := NewWriter(file, signalID, now)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	return &Capture{
+		path:   path,
+		file:   file,
+		writer: writer,
+	}, nil
+}
+
+// GetPath linter
+func (c *Capture) GetPath() string {
+	return c.path
+}
+
+// WriteRTP linter
+func (c *Capture) WriteRTP(kind string, pkt *rtp.Packet, arrival time.Time) error {
+	raw, err := pkt.Marshal()
+	if err != nil {
+		return err
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.writer == nil {
+		return fmt.Errorf("capture was closed")
+	}
+	return c.writer.Write(kind, false, pkt.SSRC, raw, arrival)
+}
+
+// WriteRTCP linter
+func (c *Capture) WriteRTCP(kind string, ssrc uint32, raw []byte, arrival time.Time) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.writer == nil {
+		return fmt.Errorf("capture was closed")
+	}
+	return c.writer.Write(kind, true, ssrc, raw, arrival)
+}
+
+// Close flush and close dump file
+func (c *Capture) Close() error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.writer == nil {
+		return nil
+	}
+
+	err := c.writer.Flush()
+	if closeErr := c.file.Close(); err == nil {
+		err = closeErr
+	}
+	c.writer = nil
+	return err
+}
@@ -0,0 +1,217 @@
+package rtpdump
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"time"
+)
+
+// file layout
+//
+//	header: magic(8) version(1) start unix nano(8) signalID length(2) signalID
+//	record: flags(1) offset µs(uvarint) ssrc(4) length(uvarint) data
+const (
+	magic   = "TRTCDUMP"
+	version = 1
+
+	flagVideo = 0x01
+	flagRTCP  = 0x02
+)
+
+// Header linter
+type Header struct {
+	SignalID string
+	Start    time.Time
+}
+
+// Record one captured packet
+type Record struct {
+	Offset time.Duration // arrival time from start
+	Kind   string        // audio or video
+	RTCP   bool
+	SSRC   uint32
+	Data   []byte // raw rtp or rtcp packet
+}
+
+// Writer linter
+type Writer struct {
+	out   *bufio.Writer
+	start time.Time
+}
+
+// NewWriter write file header and return writer
+func NewWriter(out io.Writer, signalID string, start time.Time) (*Writer, error) {
+	if len(signalID) > 0xffff {
+		return nil, fmt.Errorf("signal ID too long: %d", len(signalID))
+	}
+
+	w := &Writer{
+		out:   bufio.NewWriter(out),
+		start: start,
+	}
+
+	header := make([]byte, 0, len(magic)+11+len(signalID))
+	header = append(header, magic...)
+	header = append(header, version)
+	header = appendUint64(header, uint64(start.UnixNano()))
+	header = append(header, byte(len(signalID)>>8), byte(len(signalID)))
+	header = append(header, signalID...)
+	if _, err := w.out.Write(header); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+// Write a packet arrived at arrival
+func (w *Writer) Write(kind string, isRTCP bool, ssrc uint32, data []byte, arrival time.Time) error {
+	var flags byte
+	if kind == "video" {
+		flags |= flagVideo
+	}
+	if isRTCP {
+		flags |= flagRTCP
+	}
+
+	offset := arrival.Sub(w.start)
+	if offset < 0 {
+		offset = 0
+	}
+
+	record := make([]byte, 0, 1+binary.MaxVarintLen64*2+4+len(data))
+	record = append(record, flags)
+	record = appendUvarint(record, uint64(offset/time.Microsecond))
+	record = append(record, byte(ssrc>>24), byte(ssrc>>16), byte(ssrc>>8), byte(ssrc))
+	record = appendUvarint(record, uint64(len(data)))
+	record = append(record, data...)
+	_, err := w.out.Write(record)
+	return err
+}
+
+// Flush buffered records
+func (w *Writer) Flush() error {
+	return w.out.Flush()
+}
+
+// Reader linter
+type Reader struct {
+	in     *bufio.Reader
+	header *Header
+}
+
+// NewReader read file header and return reader
+func NewReader(in io.Reader) (*Reader, error) {
+	r := &Reader{
+		in: bufio.NewReader(in),
+	}
+
+	fixed := make([]byte, len(magic)+11)
+	if _, err := io.ReadFull(r.in, fixed); err != nil {
+		return nil, err
+	}
+	if string(fixed[:len(magic)]) != magic {
+		return nil, fmt.Errorf("not a rtp dump file")
+	}
+	if v := fixed[len(magic)]; v != version {
+		return nil, fmt.Errorf("rtp dump version %d is not supported", v)
+	}
+
+	start := int64(binary.BigEndian.Uint64(fixed[len(magic)+1:]))
+	length := int(binary.BigEndian.Uint16(fixed[len(magic)+9:]))
+	signalID := make([]byte, length)
+	if _, err := io.ReadFull(r.in, signalID); err != nil {
+		return nil, err
+	}
+
+	r.header = &Header{
+		SignalID: string(signalID),
+		Start:    time.Unix(0, start),
+	}
+	return r, nil
+}
+
+// Header linter
+func (r *Reader) Header() *Header {
+	return r.header
+}
+
+// Next return next record, io.EOF at end of file
+func (r *Reader) Next() (*Record, error) {
+	flags, err := r.in.ReadByte()
+	if err != nil {
+		return nil, err
+	}
+
+	offset, err := binary.ReadUvarint(r.in)
+	if err != nil {
+		return nil, unexpected(err)
+	}
+
+	ssrc := make([]byte, 4)
+	if _, err := io.ReadFull(r.in, ssrc); err != nil {
+		return nil, unexpected(err)
+	}
+
+	length, err := binary.ReadUvarint(r.in)
+	if err != nil {
+		return nil, unexpected(err)
+	}
+	data := make([]byte, length)
+	if _, err := io.ReadFull(r.in, data); err != nil {
+		return nil, unexpected(err)
+	}
+
+	record := &Record{
+		Offset: time.Duration(offset) * time.Microsecond,
+		Kind:   "audio",
+		RTCP:   flags&flagRTCP != 0,
+		SSRC:   binary.BigEndian.Uint32(ssrc),
+		Data:   data,
+	}
+	if flags&flagVideo != 0 {
+		record.Kind = "video"
+	}
+	return record, nil
+}
+
+// Replay call handler for every record at its original time from now
+func (r *Reader) Replay(handler func(record *Record) error) error {
+	start := time.Now()
+	for {
+		record, err := r.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		if wait := record.Offset - time.Since(start); wait > 0 {
+			time.Sleep(wait)
+		}
+		if err := handler(record); err != nil {
+			return err
+		}
+	}
+}
+
+// a truncated record is not a clean end of file
+func unexpected(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+func appendUint64(b []byte, v uint64) []byte {
+	buf := make([]byte, 8)
+	binary.BigEndian.PutUint64(buf, v)
+	return append(b, buf...)
+}
+
+func appendUvarint(b []byte, v uint64) []byte {
+	buf := make([]byte, binary.MaxVarintLen64)
+	n := binary.PutUvarint(buf, v)
+	return append(b, buf[:n]...)
+}
@@ -0,0 +1,55 @@
+package rtpdump
+
+import (
+	"bytes"
+	"io"
+	"testing"
+	"time"
+)
+
+func TestWriteRead(t *testing.T) {
+	buf := &bytes.Buffer{}
+	start := time.Unix(1600000000, 0)
+
+	w, err := NewWriter(buf, "signal", start)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Write("video", false, 1234, []byte{1, 2, 3}, start.Add(20*time.Millisecond)); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Write("audio", true, 5678, []byte{4}, start.Add(time.Second)); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := NewReader(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if h := r.Header(); h.SignalID != "signal" || !h.Start.Equal(start) {
+		t.Fatalf("wrong header: %+v", h)
+	}
+
+	first, err := r.Next()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first.Kind != "video" || first.RTCP || first.SSRC != 1234 || first.Offset != 20*time.Millisecond || !bytes.Equal(first.Data, []byte{1, 2, 3}) {
+		t.Fatalf("wrong first record: %+v", first)
+	}
+
+	second, err := r.Next()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if second.Kind != "audio" || !second.RTCP || second.SSRC != 5678 || second.Offset != time.Second {
+		t.Fatalf("wrong second record: %+v", second)
+	}
+
+	if _, err := r.Next(); err != io.EOF {
+		t.Fatalf("expect EOF, got %v", err)
+	}
+}
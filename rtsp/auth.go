@@ -0,0 +1,83 @@
+package rtsp
+
+import (
+	"crypto/md5"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// auth answer basic or digest challenges of a camera, see RFC 2617
+type auth struct {
+	user     string
+	password string
+	scheme   string
+	realm    string
+	nonce    string
+}
+
+func newAuth(user *url.Userinfo) *auth {
+	if user == nil {
+		return nil
+	}
+	password, _ := user.Password()
+	return &auth{
+		user:     user.Username(),
+		password: password,
+	}
+}
+
+// challenge read WWW-Authenticate header, return false if scheme is not supported
+func (a *auth) challenge(header string) bool {
+	scheme, params := header, ""
+	if i := strings.Index(header, " "); i > 0 {
+		scheme, params = header[:i], header[i+1:]
+	}
+
+	switch strings.ToLower(scheme) {
+	case "basic":
+		a.scheme = "basic"
+		return true
+	case "digest":
+		a.scheme = "digest"
+		for _, param := range strings.Split(params, ",") {
+			kv := strings.SplitN(strings.TrimSpace(param), "=", 2)
+			if len(kv) != 2 {
+				continue
+			}
+			value := strings.Trim(kv[1], `"`)
+			switch strings.ToLower(kv[0]) {
+			case "realm":
+				a.realm = value
+			case "nonce":
+				a.nonce = value
+			}
+		}
+		return a.nonce != ""
+	default:
+		return false
+	}
+}
+
+// header Authorization of a request, empty before a challenge
+func (a *auth) header(method, uri string) string {
+	switch a.scheme {
+	case "basic":
+		return "Basic " + base64.StdEncoding.EncodeToString([]byte(a.user+":"+a.password))
+	case "digest":
+		ha1 := md5Hex(a.user + ":" + a.realm + ":" + a.password)
+		ha2 := md5Hex(method + ":" + uri)
+		response := md5Hex(ha1 + ":" + a.nonce + ":" + ha2)
+		return fmt.Sprintf(`Digest username="%s", realm="%s", nonce="%s", uri="%s", response="%s"`,
+			a.user, a.realm, a.nonce, uri, response)
+	default:
+		return ""
+	}
+}
+
+func md5Hex(s string) string {
+	sum := md5.Sum([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,494 @@
+package rtsp
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/lamhai1401/gologs/logs"
+	"github.com/lamhai1401/testrtc/ingest"
+	"github.com/lamhai1401/testrtc/jitter"
+	"github.com/lamhai1401/testrtc/utils"
+	"github.com/pion/rtp"
+)
+
+// transports of rtp
+const (
+	TransportTCP = "tcp" // interleaved in rtsp connection
+	TransportUDP = "udp"
+
+	dialTimeout    = 10 * time.Second
+	defaultTimeout = 60 * time.Second // session timeout if server does not tell
+	maxPacketSize  = 1500
+	maxBodySize    = 64 * 1024 // a describe answer is a few kB of sdp
+	userAgent      = "testrtc"
+)
+
+type response struct {
+	status  int
+	reason  string
+	headers map[string]string // lower case keys
+	body    []byte
+}
+
+type track struct {
+	stream  *ingest.Stream
+	channel int          // interleaved rtp channel, rtcp is channel + 1
+	rtpConn *net.UDPConn // udp transport only
+	rtcp    *net.UDPConn
+	buffer  *jitter.Buffer
+	release *jitter.Releaser // set once serving
+}
+
+// Client pull vp8 and opus tracks of one rtsp url
+type Client struct {
+	url       *url.URL
+	transport string
+	conn      net.Conn
+	reader    *bufio.Reader
+	auth      *auth
+	cseq      int
+	session   string
+	timeout   time.Duration
+	tracks    []*track
+	handler   ingest.Handler
+	done      chan struct{}
+	isClosed  bool
+	mutex     sync.Mutex
+}
+
+// Dial describe, setup and play rawURL, packets are passed to handler in sequence order
+func Dial(rawURL, transport string, handler ingest.Handler) (*Client, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme != "rtsp" {
+		return nil, fmt.Errorf("rtsp scheme %s is not supported", u.Scheme)
+	}
+	if transport == "" {
+		transport = TransportTCP
+	}
+	if transport != TransportTCP && transport != TransportUDP {
+		return nil, fmt.Errorf("rtsp transport %s is not supported", transport)
+	}
+
+	host := u.Host
+	if u.Port() == "" {
+		host = net.JoinHostPort(u.Hostname(), "554")
+	}
+	conn, err := net.DialTimeout("tcp", host, dialTimeout)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &Client{
+		url:       u,
+		transport: transport,
+		conn:      conn,
+		reader:    bufio.NewReader(conn),
+		auth:      newAuth(u.User),
+		timeout:   defaultTimeout,
+		handler:   handler,
+		done:      make(chan struct{}),
+	}
+	// credentials go to Authorization header only
+	c.url.User = nil
+
+	conn.SetDeadline(time.Now().Add(dialTimeout))
+	if err := c.play(); err != nil {
+		c.Close()
+		return nil, err
+	}
+	conn.SetDeadline(time.Time{})
+
+	c.serve()
+	return c, nil
+}
+
+func (c *Client) play() error {
+	if _, err := c.request("OPTIONS", c.url.String(), nil); err != nil {
+		return err
+	}
+
+	res, err := c.request("DESCRIBE", c.url.String(), map[string]string{"Accept": "application/sdp"})
+	if err != nil {
+		return err
+	}
+	streams, err := ingest.ParseMedia(string(res.body))
+	if err != nil {
+		return err
+	}
+
+	base := c.url.String()
+	if value := res.headers["content-base"]; value != "" {
+		base = value
+	} else if value := res.headers["content-location"]; value != "" {
+		base = value
+	}
+
+	for _, stream := range streams {
+		if err := stream.Validate(); err != nil {
+			// no transcoder, the mixer only takes vp8 and opus
+			logs.Warn(fmt.Sprintf("Skip rtsp track of %s: %v", c.url.String(), err))
+			continue
+		}
+		if err := c.setup(stream, controlURL(base, stream.Control)); err != nil {
+			return err
+		}
+	}
+	if len(c.tracks) == 0 {
+		return fmt.Errorf("%s has no vp8 or opus track", c.url.String())
+	}
+
+	_, err = c.request("PLAY", base, map[string]string{"Range": "npt=0.000-"})
+	return err
+}
+
+func (c *Client) setup(stream *ingest.Stream, uri string) error {
+	t := &track{
+		stream:  stream,
+		channel: 2 * len(c.tracks),
+		buffer:  jitter.NewBuffer(utils.GetJitterSize(), utils.GetJitterLatency()),
+	}
+
+	var transport string
+	if c.transport == TransportTCP {
+		transport = fmt.Sprintf("RTP/AVP/TCP;unicast;interleaved=%d-%d", t.channel, t.channel+1)
+	} else {
+		var err error
+		if t.rtpConn, err = net.ListenUDP("udp", &net.UDPAddr{}); err != nil {
+			return err
+		}
+		if t.rtcp, err = net.ListenUDP("udp", &net.UDPAddr{}); err != nil {
+			t.rtpConn.Close()
+			return err
+		}
+		transport = fmt.Sprintf("RTP/AVP;unicast;client_port=%d-%d",
+			t.rtpConn.LocalAddr().(*net.UDPAddr).Port, t.rtcp.LocalAddr().(*net.UDPAddr).Port)
+	}
+	c.tracks = append(c.tracks, t)
+
+	res, err := c.request("SETUP", uri, map[string]string{"Transport": transport})
+	if err != nil {
+		return err
+	}
+
+	if c.transport == TransportTCP {
+		// server may pick other channels
+		for _, field := range strings.Split(res.headers["transport"], ";") {
+			if strings.HasPrefix(field, "interleaved=") {
+				if channel, err := strconv.Atoi(strings.SplitN(strings.TrimPrefix(field, "interleaved="), "-", 2)[0]); err == nil {
+					t.channel = channel
+				}
+			}
+		}
+	}
+
+	if session := res.headers["session"]; session != "" {
+		parts := strings.Split(session, ";")
+		c.session = strings.TrimSpace(parts[0])
+		for _, part := range parts[1:] {
+			part = strings.TrimSpace(part)
+			if strings.HasPrefix(part, "timeout=") {
+				if seconds, err := strconv.Atoi(strings.TrimPrefix(part, "timeout=")); err == nil && seconds > 0 {
+					c.timeout = time.Duration(seconds) * time.Second
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// controlURL resolve a=control of a track against base url
+func controlURL(base, control string) string {
+	switch {
+	case control == "" || control == "*":
+		return base
+	case strings.HasPrefix(control, "rtsp://"):
+		return control
+	case strings.HasSuffix(base, "/"):
+		return base + control
+	default:
+		return base + "/" + control
+	}
+}
+
+// send a request without waiting response
+func (c *Client) send(method, uri string, headers map[string]string) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.cseq++
+
+	b := &strings.Builder{}
+	fmt.Fprintf(b, "%s %s RTSP/1.0\r\n", method, uri)
+	fmt.Fprintf(b, "CSeq: %d\r\n", c.cseq)
+	fmt.Fprintf(b, "User-Agent: %s\r\n", userAgent)
+	if c.session != "" {
+		fmt.Fprintf(b, "Session: %s\r\n", c.session)
+	}
+	if c.auth != nil {
+		if value := c.auth.header(method, uri); value != "" {
+			fmt.Fprintf(b, "Authorization: %s\r\n", value)
+		}
+	}
+	for key, value := range headers {
+		fmt.Fprintf(b, "%s: %s\r\n", key, value)
+	}
+	b.WriteString("\r\n")
+
+	_, err := io.WriteString(c.conn, b.String())
+	return err
+}
+
+// request send and wait response, answer one auth challenge
+func (c *Client) request(method, uri string, headers map[string]string) (*response, error) {
+	for retried := false; ; retried = true {
+		if err := c.send(method, uri, headers); err != nil {
+			return nil, err
+		}
+		res, err := c.readResponse()
+		if err != nil {
+			return nil, err
+		}
+
+		if res.status == 401 && !retried && c.auth != nil && c.auth.challenge(res.headers["www-authenticate"]) {
+			continue
+		}
+		if res.status != 200 {
+			return nil, fmt.Errorf("rtsp %s %s: %d %s", method, c.url.String(), res.status, res.reason)
+		}
+		return res, nil
+	}
+}
+
+func (c *Client) readResponse() (*response, error) {
+	line, err := c.reader.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	fields := strings.SplitN(strings.TrimSpace(line), " ", 3)
+	if len(fields) < 2 || !strings.HasPrefix(fields[0], "RTSP/") {
+		return nil, fmt.Errorf("invalid rtsp status line: %q", line)
+	}
+
+	res := &response{headers: make(map[string]string)}
+	if res.status, err = strconv.Atoi(fields[1]); err != nil {
+		return nil, fmt.Errorf("invalid rtsp status: %q", line)
+	}
+	if len(fields) > 2 {
+		res.reason = fields[2]
+	}
+
+	for {
+		line, err := c.reader.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		line = strings.TrimSpace(line)
+		if line == "" {
+			break
+		}
+		kv := strings.SplitN(line, ":", 2)
+		if len(kv) == 2 {
+			res.headers[strings.ToLower(strings.TrimSpace(kv[0]))] = strings.TrimSpace(kv[1])
+		}
+	}
+
+	if length, err := strconv.Atoi(res.headers["content-length"]); err == nil && length > 0 {
+		if length > maxBodySize {
+			return nil, fmt.Errorf("rtsp body of %d bytes is over %d", length, maxBodySize)
+		}
+		res.body = make([]byte, length)
+		if _, err := io.ReadFull(c.reader, res.body); err != nil {
+			return nil, err
+		}
+	}
+	return res, nil
+}
+
+// serve read media and keep session alive until closed
+func (c *Client) serve() {
+	for _, t := range c.tracks {
+		stream := t.stream
+		t.release = jitter.NewReleaser(t.buffer, func(pkt *rtp.Packet) {
+			c.handler(stream, pkt)
+		})
+	}
+
+	var wg sync.WaitGroup
+	if c.transport == TransportTCP {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			c.readInterleaved()
+		}()
+	} else {
+		for _, t := range c.tracks {
+			wg.Add(2)
+			go func(t *track) {
+				defer wg.Done()
+				c.readUDP(t)
+			}(t)
+			go func(t *track) {
+				defer wg.Done()
+				discard(t.rtcp)
+			}(t)
+		}
+		// rtsp connection only carries keep alive responses
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				if _, err := c.readResponse(); err != nil {
+					c.Close()
+					return
+				}
+			}
+		}()
+	}
+
+	go c.keepAlive()
+	go func() {
+		wg.Wait()
+		for _, t := range c.tracks {
+			t.release.Close()
+		}
+		close(c.done)
+	}()
+}
+
+func (c *Client) readInterleaved() {
+	header := make([]byte, 4)
+	for {
+		first, err := c.reader.Peek(1)
+		if err != nil {
+			c.readErr(err)
+			return
+		}
+
+		if first[0] != '$' {
+			// keep alive response
+			if _, err := c.readResponse(); err != nil {
+				c.readErr(err)
+				return
+			}
+			continue
+		}
+
+		if _, err := io.ReadFull(c.reader, header); err != nil {
+			c.readErr(err)
+			return
+		}
+		data := make([]byte, binary.BigEndian.Uint16(header[2:]))
+		if _, err := io.ReadFull(c.reader, data); err != nil {
+			c.readErr(err)
+			return
+		}
+
+		for _, t := range c.tracks {
+			if int(header[1]) == t.channel {
+				c.push(t, data)
+			}
+		}
+	}
+}
+
+func (c *Client) readUDP(t *track) {
+	buf := make([]byte, maxPacketSize)
+	for {
+		n, _, err := t.rtpConn.ReadFromUDP(buf)
+		if err != nil {
+			c.readErr(err)
+			return
+		}
+		c.push(t, append([]byte{}, buf[:n]...))
+	}
+}
+
+func discard(conn *net.UDPConn) {
+	buf := make([]byte, maxPacketSize)
+	for {
+		if _, _, err := conn.ReadFromUDP(buf); err != nil {
+			return
+		}
+	}
+}
+
+func (c *Client) push(t *track, data []byte) {
+	pkt := &rtp.Packet{}
+	if err := pkt.Unmarshal(data); err != nil {
+		return
+	}
+	if pkt.PayloadType != t.stream.PayloadType {
+		return
+	}
+
+	t.release.Push(pkt)
+}
+
+func (c *Client) readErr(err error) {
+	if !c.checkClose() {
+		logs.Error(fmt.Sprintf("Read rtsp %s err: %v", c.url.String(), err))
+	}
+	c.Close()
+}
+
+// keepAlive send GET_PARAMETER twice per session timeout
+func (c *Client) keepAlive() {
+	ticker := time.NewTicker(c.timeout / 2)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-c.done:
+			return
+		case <-ticker.C:
+			if err := c.send("GET_PARAMETER", c.url.String(), nil); err != nil {
+				c.readErr(err)
+				return
+			}
+		}
+	}
+}
+
+// Wait until connection is lost or closed
+func (c *Client) Wait() {
+	<-c.done
+}
+
+func (c *Client) checkClose() bool {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.isClosed
+}
+
+// Close teardown session and close connections
+func (c *Client) Close() {
+	c.mutex.Lock()
+	if c.isClosed {
+		c.mutex.Unlock()
+		return
+	}
+	c.isClosed = true
+	c.mutex.Unlock()
+
+	if c.session != "" {
+		c.send("TEARDOWN", c.url.String(), nil)
+	}
+
+	c.conn.Close()
+	for _, t := range c.tracks {
+		if t.rtpConn != nil {
+			t.rtpConn.Close()
+			t.rtcp.Close()
+		}
+	}
+}
@@ -0,0 +1,112 @@
+package rtsp
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"net/textproto"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/lamhai1401/testrtc/ingest"
+	"github.com/pion/rtp"
+)
+
+const testSDP = "v=0\r\n" +
+	"o=- 0 0 IN IP4 127.0.0.1\r\n" +
+	"s=camera\r\n" +
+	"t=0 0\r\n" +
+	"m=video 0 RTP/AVP 96\r\n" +
+	"a=rtpmap:96 VP8/90000\r\n" +
+	"a=control:trackID=0\r\n" +
+	"m=audio 0 RTP/AVP 97\r\n" +
+	"a=rtpmap:97 MPEG4-GENERIC/48000/2\r\n" +
+	"a=control:trackID=1\r\n"
+
+// serve a fake camera streaming one vp8 packet over interleaved tcp
+func serve(t *testing.T, listener net.Listener, setups chan string) {
+	conn, err := listener.Accept()
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+
+	reader := textproto.NewReader(bufio.NewReader(conn))
+	for {
+		line, err := reader.ReadLine()
+		if err != nil {
+			return
+		}
+		headers, err := reader.ReadMIMEHeader()
+		if err != nil {
+			return
+		}
+		method := strings.Fields(line)[0]
+		cseq := headers.Get("Cseq")
+
+		if headers.Get("Authorization") == "" {
+			fmt.Fprintf(conn, "RTSP/1.0 401 Unauthorized\r\nCSeq: %s\r\nWWW-Authenticate: Basic realm=\"camera\"\r\n\r\n", cseq)
+			continue
+		}
+
+		switch method {
+		case "DESCRIBE":
+			fmt.Fprintf(conn, "RTSP/1.0 200 OK\r\nCSeq: %s\r\nContent-Base: %s/\r\nContent-Length: %d\r\n\r\n%s",
+				cseq, strings.Fields(line)[1], len(testSDP), testSDP)
+		case "SETUP":
+			setups <- strings.Fields(line)[1]
+			fmt.Fprintf(conn, "RTSP/1.0 200 OK\r\nCSeq: %s\r\nSession: 1234;timeout=30\r\nTransport: %s\r\n\r\n", cseq, headers.Get("Transport"))
+		case "PLAY":
+			fmt.Fprintf(conn, "RTSP/1.0 200 OK\r\nCSeq: %s\r\nSession: 1234\r\n\r\n", cseq)
+
+			pkt := &rtp.Packet{
+				Header:  rtp.Header{Version: 2, PayloadType: 96, SequenceNumber: 1},
+				Payload: []byte{0x10, 0x00},
+			}
+			data, _ := pkt.Marshal()
+			conn.Write(append([]byte{'$', 0, byte(len(data) >> 8), byte(len(data))}, data...))
+		default:
+			fmt.Fprintf(conn, "RTSP/1.0 200 OK\r\nCSeq: %s\r\n\r\n", cseq)
+		}
+	}
+}
+
+func TestClient(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+
+	setups := make(chan string, 2)
+	go serve(t, listener, setups)
+
+	packets := make(chan *rtp.Packet, 1)
+	client, err := Dial("rtsp://user:pass@"+listener.Addr().String()+"/live", TransportTCP, func(stream *ingest.Stream, pkt *rtp.Packet) {
+		if stream.Kind == "video" {
+			packets <- pkt
+		}
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	// aac track is skipped
+	if setup := <-setups; setup != "rtsp://"+listener.Addr().String()+"/live/trackID=0" {
+		t.Fatalf("wrong setup url %s", setup)
+	}
+	if len(setups) != 0 {
+		t.Fatalf("unsupported track was set up")
+	}
+
+	select {
+	case pkt := <-packets:
+		if pkt.SequenceNumber != 1 {
+			t.Fatalf("wrong packet %+v", pkt.Header)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("timeout waiting rtp packet")
+	}
+}
@@ -0,0 +1,93 @@
+package rtsp
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/lamhai1401/gologs/logs"
+	"github.com/lamhai1401/testrtc/ingest"
+)
+
+const (
+	minRetry = time.Second
+	maxRetry = 30 * time.Second
+)
+
+// Source pull an rtsp url and reconnect until closed, for fixed cameras
+type Source struct {
+	url       string
+	transport string
+	handler   ingest.Handler
+	client    *Client
+	isClosed  bool
+	mutex     sync.Mutex
+}
+
+// NewSource linter
+func NewSource(url, transport string, handler ingest.Handler) *Source {
+	return &Source{
+		url:       url,
+		transport: transport,
+		handler:   handler,
+	}
+}
+
+// Start pulling in background
+func (s *Source) Start() {
+	go s.run()
+}
+
+func (s *Source) run() {
+	retry := minRetry
+	for {
+		client, err := Dial(s.url, s.transport, s.handler)
+		if err != nil {
+			logs.Error(fmt.Sprintf("Connect rtsp source err: %v, retry in %s", err, retry))
+			time.Sleep(retry)
+			if retry *= 2; retry > maxRetry {
+				retry = maxRetry
+			}
+		} else {
+			retry = minRetry
+			if !s.setClient(client) {
+				client.Close()
+				return
+			}
+			client.Wait()
+		}
+
+		if s.checkClose() {
+			return
+		}
+	}
+}
+
+// setClient return false if source was closed meanwhile
+func (s *Source) setClient(client *Client) bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.isClosed {
+		return false
+	}
+	s.client = client
+	return true
+}
+
+func (s *Source) checkClose() bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.isClosed
+}
+
+// Close stop pulling
+func (s *Source) Close() {
+	s.mutex.Lock()
+	s.isClosed = true
+	client := s.client
+	s.mutex.Unlock()
+
+	if client != nil {
+		client.Close()
+	}
+}
@@ -0,0 +1,251 @@
+package seat
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// Seat a numbered place of the mix, numbers start at 1
+type Seat struct {
+	Number   int    `json:"number"`
+	Role     string `json:"role,omitempty"`     // reserved for participants of role
+	SignalID string `json:"signalID,omitempty"` // empty is free
+}
+
+// Manager give participants of a room stable seats. A participant joining again gets its
+// previous seat back when still free, seats reserved for a role only go to that role
+type Manager struct {
+	seats      []*Seat
+	roles      map[string]string // signalID - role
+	remembered map[string]int    // signalID - last seat, kept after leaving
+	pending    []*Seat           // state to give handler once unlocked, nil without change
+	version    int               // counts changes, so an older state is never handled after a newer one
+	handled    int               // version given to handler last
+	handler    func(seats []*Seat)
+	mutex      sync.Mutex
+	handling   sync.Mutex // handler is called under it, not under mutex
+}
+
+// NewManager size seats, handler is called after every change once the seats are unlocked
+func NewManager(size int, handler func(seats []*Seat)) *Manager {
+	seats := make([]*Seat, size)
+	for i := range seats {
+		seats[i] = &Seat{Number: i + 1}
+	}
+	return &Manager{
+		seats:      seats,
+		roles:      make(map[string]string),
+		remembered: make(map[string]int),
+		handler:    handler,
+	}
+}
+
+// Reserve seat number for role, empty role frees the reservation.
+// A participant already sitting there keeps the seat
+func (m *Manager) Reserve(role string, number int) error {
+	defer m.notify()
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	seat := m.seat(number)
+	if seat == nil {
+		return fmt.Errorf("Seat %d is outside 1 to %d", number, len(m.seats))
+	}
+	if seat.Role == role {
+		return nil
+	}
+	seat.Role = role
+	m.changed()
+	return nil
+}
+
+// SetRole of signalID, a seated participant moves to a free seat of its role
+func (m *Manager) SetRole(signalID, role string) {
+	defer m.notify()
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if m.roles[signalID] == role {
+		return
+	}
+	if role == "" {
+		delete(m.roles, signalID)
+	} else {
+		m.roles[signalID] = role
+	}
+
+	current := m.find(signalID)
+	if current == nil || current.Role == role {
+		return
+	}
+	if seat := m.reserved(role); seat != nil {
+		current.SignalID = ""
+		seat.SignalID = signalID
+		m.remembered[signalID] = seat.Number
+		m.changed()
+	}
+}
+
+// GetRole linter
+func (m *Manager) GetRole(signalID string) string {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	return m.roles[signalID]
+}
+
+// Join seat signalID, return its seat number or an error when every seat it may take is used
+func (m *Manager) Join(signalID string) (int, error) {
+	defer m.notify()
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if seat := m.find(signalID); seat != nil {
+		return seat.Number, nil
+	}
+
+	// a free seat of its role comes first, then its previous seat, then the lowest free one
+	role := m.roles[signalID]
+	previous := m.seat(m.remembered[signalID])
+	seat := m.reserved(role)
+	if seat == nil || (previous != nil && previous.Role == role && m.canSit(previous, role)) {
+		if m.canSit(previous, role) {
+			seat = previous
+		} else if seat == nil {
+			seat = m.unreserved()
+		}
+	}
+	if seat == nil {
+		return 0, fmt.Errorf("No free seat for %s", signalID)
+	}
+
+	seat.SignalID = signalID
+	m.remembered[signalID] = seat.Number
+	m.changed()
+	return seat.Number, nil
+}
+
+// Leave free the seat of signalID, it is remembered for a later join
+func (m *Manager) Leave(signalID string) {
+	defer m.notify()
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	seat := m.find(signalID)
+	if seat == nil {
+		return
+	}
+	seat.SignalID = ""
+	m.changed()
+}
+
+// Get seat number of signalID, 0 if it has none
+func (m *Manager) Get(signalID string) int {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if seat := m.find(signalID); seat != nil {
+		return seat.Number
+	}
+	return 0
+}
+
+// List copies of every seat by number
+func (m *Manager) List() []*Seat {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	return m.list()
+}
+
+// Order signalIDs by seat, ones without a seat keep their order after the others
+func (m *Manager) Order(signalIDs []string) []string {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	numbers := make(map[string]int, len(signalIDs))
+	for _, id := range signalIDs {
+		if seat := m.find(id); seat != nil {
+			numbers[id] = seat.Number
+		} else {
+			numbers[id] = len(m.seats) + 1
+		}
+	}
+
+	ordered := append([]string{}, signalIDs...)
+	sort.SliceStable(ordered, func(i, j int) bool {
+		return numbers[ordered[i]] < numbers[ordered[j]]
+	})
+	return ordered
+}
+
+func (m *Manager) seat(number int) *Seat {
+	if number < 1 || number > len(m.seats) {
+		return nil
+	}
+	return m.seats[number-1]
+}
+
+func (m *Manager) find(signalID string) *Seat {
+	for _, seat := range m.seats {
+		if seat.SignalID == signalID {
+			return seat
+		}
+	}
+	return nil
+}
+
+// canSit check seat is free and either unreserved or reserved for role
+func (m *Manager) canSit(seat *Seat, role string) bool {
+	return seat != nil && seat.SignalID == "" && (seat.Role == "" || seat.Role == role)
+}
+
+// reserved lowest free seat reserved for role, nil without role
+func (m *Manager) reserved(role string) *Seat {
+	if role == "" {
+		return nil
+	}
+	for _, seat := range m.seats {
+		if seat.SignalID == "" && seat.Role == role {
+			return seat
+		}
+	}
+	return nil
+}
+
+// unreserved lowest free seat open to anyone
+func (m *Manager) unreserved() *Seat {
+	for _, seat := range m.seats {
+		if seat.SignalID == "" && seat.Role == "" {
+			return seat
+		}
+	}
+	return nil
+}
+
+func (m *Manager) list() []*Seat {
+	seats := make([]*Seat, len(m.seats))
+	for i, seat := range m.seats {
+		copied := *seat
+		seats[i] = &copied
+	}
+	return seats
+}
+
+// changed keep the seats for notify, mutex must be held
+func (m *Manager) changed() {
+	m.version++
+	m.pending = m.list()
+}
+
+// notify call handler with the last change, mutex must not be held
+func (m *Manager) notify() {
+	m.mutex.Lock()
+	seats, version := m.pending, m.version
+	m.pending = nil
+	m.mutex.Unlock()
+	if seats == nil || m.handler == nil {
+		return
+	}
+
+	m.handling.Lock()
+	defer m.handling.Unlock()
+	if version <= m.handled {
+		return
+	}
+	m.handled = version
+	m.handler(seats)
+}
@@ -0,0 +1,77 @@
+package seat
+
+import (
+	"testing"
+)
+
+func TestRejoinKeepSeat(t *testing.T) {
+	changes := 0
+	m := NewManager(3, func(seats []*Seat) { changes++ })
+
+	a, _ := m.Join("a")
+	b, _ := m.Join("b")
+	if a != 1 || b != 2 {
+		t.Fatalf("seats %d %d, want 1 2", a, b)
+	}
+
+	m.Leave("a")
+	m.Join("c")
+	m.Join("a")
+	if m.Get("c") != 1 || m.Get("a") != 3 {
+		t.Fatalf("taken seat should not be given back, a %d c %d", m.Get("a"), m.Get("c"))
+	}
+
+	m.Leave("b")
+	m.Join("b")
+	if m.Get("b") != 2 {
+		t.Fatalf("b got seat %d, want its previous 2", m.Get("b"))
+	}
+	if _, err := m.Join("d"); err == nil {
+		t.Fatal("room is full")
+	}
+	if changes != 7 {
+		t.Fatalf("handler called %d times, want 7", changes)
+	}
+
+	if order := m.Order([]string{"x", "a", "b", "c"}); order[0] != "c" || order[1] != "b" || order[2] != "a" || order[3] != "x" {
+		t.Fatalf("unexpected order %v", order)
+	}
+}
+
+func TestReservedSeat(t *testing.T) {
+	m := NewManager(3, nil)
+	if err := m.Reserve("host", 4); err == nil {
+		t.Fatal("seat 4 does not exist")
+	}
+	m.Reserve("host", 1)
+
+	m.Join("student")
+	if m.Get("student") != 2 {
+		t.Fatalf("student got seat %d, seat 1 is for the host", m.Get("student"))
+	}
+
+	m.SetRole("teacher", "host")
+	m.Join("teacher")
+	if m.Get("teacher") != 1 {
+		t.Fatalf("host got seat %d, want 1", m.Get("teacher"))
+	}
+
+	// a seated participant moves once given a role with a free seat
+	m.Reserve("presenter", 3)
+	m.SetRole("student", "presenter")
+	if m.Get("student") != 3 {
+		t.Fatalf("presenter got seat %d, want 3", m.Get("student"))
+	}
+}
+
+func TestHandlerUnlocked(t *testing.T) {
+	var m *Manager
+	seated := 0
+	// the handler may read the seats, it is not called under their lock
+	m = NewManager(2, func(seats []*Seat) { seated = m.Get("a") })
+
+	m.Join("a")
+	if seated != 1 {
+		t.Fatalf("handler saw seat %d, want 1", seated)
+	}
+}
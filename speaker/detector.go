@@ -0,0 +1,161 @@
+package speaker
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	smoothing    = 0.2                    // weight of a new audio level sample
+	minLoudness  = 40                     // below this nobody is speaking
+	switchMargin = 5                      // candidate must be louder than current by this
+	switchDelay  = 500 * time.Millisecond // candidate must stay loudest for this
+	staleAfter   = time.Second            // no audio level for this means silent
+)
+
+// Level smoothed loudness of a participant, 0 is silent and 127 is loudest
+type Level struct {
+	SignalID string  `json:"signalID"`
+	Loudness float64 `json:"loudness"`
+}
+
+type participant struct {
+	loudness float64
+	lastSeen time.Time
+}
+
+// Detector rank participants of a room by their rtp audio level
+// and pick the dominant speaker with hysteresis
+type Detector struct {
+	participants   map[string]*participant
+	dominant       string
+	candidate      string
+	candidateSince time.Time
+	handler        func(signalID string) // called when dominant speaker change
+	mutex          sync.RWMutex
+}
+
+// NewDetector linter
+func NewDetector(handler func(signalID string)) *Detector {
+	return &Detector{
+		participants: make(map[string]*participant),
+		handler:      handler,
+	}
+}
+
+// Update with the audio level (RFC 6464, -dBov) of an incoming packet
+func (d *Detector) Update(signalID string, level uint8, now time.Time) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	loudness := float64(127 - level&0x7f)
+	p, ok := d.participants[signalID]
+	if !ok || now.Sub(p.lastSeen) > staleAfter {
+		d.participants[signalID] = &participant{
+			loudness: loudness,
+			lastSeen: now,
+		}
+		return
+	}
+	p.loudness += (loudness - p.loudness) * smoothing
+	p.lastSeen = now
+}
+
+// Remove participant when leaving room
+func (d *Detector) Remove(signalID string) {
+	d.mutex.Lock()
+	delete(d.participants, signalID)
+	changed := d.dominant == signalID
+	if changed {
+		d.dominant = ""
+	}
+	d.mutex.Unlock()
+
+	if changed && d.handler != nil {
+		d.handler("")
+	}
+}
+
+// Ranking return participants from loudest to quietest
+func (d *Detector) Ranking(now time.Time) []Level {
+	d.mutex.RLock()
+	defer d.mutex.RUnlock()
+	return d.ranking(now)
+}
+
+// GetDominant return current dominant speaker, empty if nobody
+func (d *Detector) GetDominant() string {
+	d.mutex.RLock()
+	defer d.mutex.RUnlock()
+	return d.dominant
+}
+
+// Evaluate pick dominant speaker, call it periodically
+func (d *Detector) Evaluate(now time.Time) {
+	d.mutex.Lock()
+	changed := d.evaluate(now)
+	dominant := d.dominant
+	d.mutex.Unlock()
+
+	if changed && d.handler != nil {
+		d.handler(dominant)
+	}
+}
+
+func (d *Detector) evaluate(now time.Time) bool {
+	ranking := d.ranking(now)
+	if len(ranking) == 0 || ranking[0].Loudness < minLoudness {
+		d.candidate = ""
+		return false
+	}
+
+	top := ranking[0]
+	if top.SignalID == d.dominant {
+		d.candidate = ""
+		return false
+	}
+
+	// current speaker is still talking and not clearly quieter
+	for _, level := range ranking {
+		if level.SignalID == d.dominant && level.Loudness >= minLoudness && top.Loudness < level.Loudness+switchMargin {
+			d.candidate = ""
+			return false
+		}
+	}
+
+	if d.candidate != top.SignalID {
+		d.candidate = top.SignalID
+		d.candidateSince = now
+		return false
+	}
+
+	if now.Sub(d.candidateSince) < switchDelay {
+		return false
+	}
+
+	d.dominant = top.SignalID
+	d.candidate = ""
+	return true
+}
+
+func (d *Detector) ranking(now time.Time) []Level {
+	levels := make([]Level, 0, len(d.participants))
+	for signalID, p := range d.participants {
+		loudness := p.loudness
+		if now.Sub(p.lastSeen) > staleAfter {
+			loudness = 0
+		}
+		levels = append(levels, Level{
+			SignalID: signalID,
+			Loudness: loudness,
+		})
+	}
+	sort.Slice(levels, func(i, j int) bool {
+		if levels[i].Loudness == levels[j].Loudness {
+			return levels[i].SignalID < levels[j].SignalID
+		}
+		return levels[i].Loudness > levels[j].Loudness
+	})
+	return levels
+}
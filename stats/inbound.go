@@ -0,0 +1,87 @@
+package stats
+
+import (
+	"sync"
+	"time"
+
+	"github.com/pion/rtp"
+)
+
+// Inbound count packets of a remote track
+type Inbound struct {
+	kind       string
+	ssrc       uint32
+	clockRate  uint32
+	packets    uint64
+	bytes      uint64
+	frames     uint64
+	jitter     float64 // in rtp timestamp units
+	transit    uint32  // last arrival - rtp timestamp in rtp timestamp units, wraps like timestamps
+	hasTransit bool
+	base       time.Time // arrival of the first packet, arrivals are counted from it
+	bitrate    rate
+	frameRate  rate
+	mutex      sync.RWMutex
+}
+
+// NewInbound linter
+func NewInbound(kind string, ssrc uint32, clockRate uint32) *Inbound {
+	return &Inbound{
+		kind:      kind,
+		ssrc:      ssrc,
+		clockRate: clockRate,
+	}
+}
+
+// OnPacket count an incoming packet and update interarrival jitter (RFC 3550 A.8)
+func (i *Inbound) OnPacket(pkt *rtp.Packet, arrival time.Time) {
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+
+	i.packets++
+	i.bytes += uint64(len(pkt.Payload))
+	if pkt.Marker {
+		i.frames++
+	}
+
+	if i.clockRate != 0 {
+		if !i.hasTransit {
+			i.base = arrival
+		}
+		ticks := int64(arrival.Sub(i.base).Seconds() * float64(i.clockRate))
+		transit := uint32(ticks) - pkt.Timestamp
+		if i.hasTransit {
+			d := float64(int32(transit - i.transit))
+			if d < 0 {
+				d = -d
+			}
+			i.jitter += (d - i.jitter) / 16
+		}
+		i.transit = transit
+		i.hasTransit = true
+	}
+
+	i.bitrate.update(i.bytes*8, arrival)
+	i.frameRate.update(i.frames, arrival)
+}
+
+// Snapshot return current statistics, it changes nothing so any number of readers may call it
+func (i *Inbound) Snapshot(now time.Time) *InboundRTPStats {
+	i.mutex.RLock()
+	defer i.mutex.RUnlock()
+
+	s := &InboundRTPStats{
+		Kind:            i.kind,
+		SSRC:            i.ssrc,
+		PacketsReceived: i.packets,
+		BytesReceived:   i.bytes,
+		Bitrate:         i.bitrate.peek(i.bytes*8, now),
+	}
+	if i.clockRate != 0 {
+		s.Jitter = i.jitter / float64(i.clockRate)
+	}
+	if i.kind == "video" {
+		s.FrameRate = i.frameRate.peek(i.frames, now)
+	}
+	return s
+}
@@ -0,0 +1,104 @@
+package stats
+
+import (
+	"sync"
+	"time"
+
+	"github.com/lamhai1401/testrtc/avsync"
+	"github.com/pion/rtcp"
+	"github.com/pion/rtp"
+)
+
+// estimateTimeout age of a remb after which the bandwidth is unknown again
+const estimateTimeout = 5 * time.Second
+
+// Outbound count packets of a local track and receiver reports about it
+type Outbound struct {
+	kind          string
+	ssrc          uint32
+	clockRate     uint32
+	packets       uint64
+	bytes         uint64
+	bitrate       rate
+	fractionLost  float64
+	packetsLost   uint32
+	jitter        float64
+	roundTripTime float64
+	estimate      float64 // from last remb, bits per second
+	estimateTime  time.Time
+	mutex         sync.RWMutex
+}
+
+// NewOutbound linter
+func NewOutbound(kind string, ssrc uint32, clockRate uint32) *Outbound {
+	return &Outbound{
+		kind:      kind,
+		ssrc:      ssrc,
+		clockRate: clockRate,
+	}
+}
+
+// GetSSRC linter
+func (o *Outbound) GetSSRC() uint32 {
+	return o.ssrc
+}
+
+// OnPacket count an outgoing packet
+func (o *Outbound) OnPacket(pkt *rtp.Packet, now time.Time) {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+	o.packets++
+	o.bytes += uint64(len(pkt.Payload))
+	o.bitrate.update(o.bytes*8, now)
+}
+
+// OnReceiverReport save what remote side report about this track
+func (o *Outbound) OnReceiverReport(report rtcp.ReceptionReport, now time.Time) {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+
+	o.fractionLost = float64(report.FractionLost) / 256
+	o.packetsLost = report.TotalLost
+	if o.clockRate != 0 {
+		o.jitter = float64(report.Jitter) / float64(o.clockRate)
+	}
+
+	// RFC 3550 6.4.1, middle 32 bits of ntp in 1/65536 seconds
+	if report.LastSenderReport != 0 {
+		middle := uint32(avsync.ToNTP(now) >> 16)
+		if rtt := middle - report.LastSenderReport - report.Delay; int32(rtt) > 0 {
+			o.roundTripTime = float64(rtt) / 65536
+		}
+	}
+}
+
+// OnREMB save the bandwidth the remote side estimates it can receive
+func (o *Outbound) OnREMB(bitrate uint64, now time.Time) {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+	o.estimate = float64(bitrate)
+	o.estimateTime = now
+}
+
+// Snapshot return current statistics, it changes nothing so any number of readers may call it
+func (o *Outbound) Snapshot(now time.Time) *OutboundRTPStats {
+	o.mutex.RLock()
+	defer o.mutex.RUnlock()
+
+	estimate := o.estimate
+	if now.Sub(o.estimateTime) > estimateTimeout {
+		estimate = 0
+	}
+	return &OutboundRTPStats{
+		Kind:          o.kind,
+		SSRC:          o.ssrc,
+		PacketsSent:   o.packets,
+		BytesSent:     o.bytes,
+		Bitrate:       o.bitrate.peek(o.bytes*8, now),
+		FractionLost:  o.fractionLost,
+		PacketsLost:   o.packetsLost,
+		Jitter:        o.jitter,
+		RoundTripTime: o.roundTripTime,
+		Estimate:      estimate,
+	}
+}
@@ -0,0 +1,40 @@
+package stats
+
+import (
+	"time"
+)
+
+// rate compute per second value of a counter over at least one second
+type rate struct {
+	lastTime  time.Time
+	lastCount uint64
+	value     float64
+}
+
+func (r *rate) update(count uint64, now time.Time) {
+	if r.lastTime.IsZero() {
+		r.lastTime = now
+		r.lastCount = count
+		return
+	}
+
+	elapsed := now.Sub(r.lastTime)
+	if elapsed < time.Second {
+		return
+	}
+	r.value = float64(count-r.lastCount) / elapsed.Seconds()
+	r.lastTime = now
+	r.lastCount = count
+}
+
+// peek value at now without moving the window, a counter that stopped changing
+// drops to its rate since the last update
+func (r *rate) peek(count uint64, now time.Time) float64 {
+	if r.lastTime.IsZero() {
+		return 0
+	}
+	if elapsed := now.Sub(r.lastTime); elapsed >= time.Second {
+		return float64(count-r.lastCount) / elapsed.Seconds()
+	}
+	return r.value
+}
@@ -0,0 +1,59 @@
+package stats
+
+import (
+	"time"
+
+	"github.com/lamhai1401/testrtc/jitter"
+)
+
+// InboundRTPStats statistics of a remote track
+type InboundRTPStats struct {
+	Kind            string        `json:"kind"`
+	SSRC            uint32        `json:"ssrc"`
+	PacketsReceived uint64        `json:"packetsReceived"`
+	BytesReceived   uint64        `json:"bytesReceived"`
+	Jitter          float64       `json:"jitter"`    // interarrival jitter in seconds
+	Bitrate         float64       `json:"bitrate"`   // bits per second
+	FrameRate       float64       `json:"frameRate"` // video only
+	JitterBuffer    *jitter.Stats `json:"jitterBuffer,omitempty"`
+}
+
+// OutboundRTPStats statistics of a local track and what the receiver reported about it
+type OutboundRTPStats struct {
+	Kind          string  `json:"kind"`
+	SSRC          uint32  `json:"ssrc"`
+	PacketsSent   uint64  `json:"packetsSent"`
+	BytesSent     uint64  `json:"bytesSent"`
+	Bitrate       float64 `json:"bitrate"`       // bits per second
+	FractionLost  float64 `json:"fractionLost"`  // from last receiver report, 0-1
+	PacketsLost   uint32  `json:"packetsLost"`   // from last receiver report
+	Jitter        float64 `json:"jitter"`        // from last receiver report, in seconds
+	RoundTripTime float64 `json:"roundTripTime"` // in seconds
+	Estimate      float64 `json:"estimate"`      // bandwidth from last remb in bits per second, 0 is unknown
+}
+
+// CandidatePairStats selected ice candidate pair
+type CandidatePairStats struct {
+	State                string  `json:"state"`
+	Nominated            bool    `json:"nominated"`
+	LocalAddress         string  `json:"localAddress"`
+	LocalType            string  `json:"localType"`
+	RemoteAddress        string  `json:"remoteAddress"`
+	RemoteType           string  `json:"remoteType"`
+	Protocol             string  `json:"protocol"`
+	BytesSent            uint64  `json:"bytesSent"`
+	BytesReceived        uint64  `json:"bytesReceived"`
+	CurrentRoundTripTime float64 `json:"currentRoundTripTime"`
+}
+
+// Report snapshot of all statistics of a peer
+type Report struct {
+	SignalID      string              `json:"signalID"`
+	SessionID     string              `json:"sessionID"`
+	Timestamp     time.Time           `json:"timestamp"`
+	ICEState      string              `json:"iceState"`
+	DTLSState     string              `json:"dtlsState"`
+	Inbound       []*InboundRTPStats  `json:"inbound"`
+	Outbound      []*OutboundRTPStats `json:"outbound"`
+	CandidatePair *CandidatePairStats `json:"candidatePair,omitempty"`
+}
@@ -0,0 +1,95 @@
+package still
+
+import (
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/pion/rtp"
+	"github.com/pion/rtp/codecs"
+)
+
+const (
+	mtu         = 1200
+	payloadType = 96
+	clockRate   = 90000
+)
+
+// Stream repeat a vp8 keyframe of a still image as rtp, so a mixer joining late or
+// losing a packet has a whole picture again at the next frame
+type Stream struct {
+	packetizer rtp.Packetizer
+	interval   time.Duration
+	frame      []byte
+	handler    func(pkt *rtp.Packet)
+	closed     chan struct{}
+	closeOnce  sync.Once
+	sending    sync.Mutex // held while packets go to handler
+	mutex      sync.Mutex
+}
+
+// NewStream send the keyframe fps times per second to handler once SetFrame is called
+func NewStream(fps int, handler func(pkt *rtp.Packet)) *Stream {
+	if fps <= 0 {
+		fps = 1
+	}
+	s := &Stream{
+		packetizer: rtp.NewPacketizer(mtu, payloadType, rand.Uint32(), &codecs.VP8Payloader{}, rtp.NewRandomSequencer(), clockRate),
+		interval:   time.Second / time.Duration(fps),
+		handler:    handler,
+		closed:     make(chan struct{}),
+	}
+	go s.serve()
+	return s
+}
+
+// SetFrame vp8 keyframe to repeat, it is sent right away
+func (s *Stream) SetFrame(frame []byte) {
+	s.mutex.Lock()
+	s.frame = frame
+	s.mutex.Unlock()
+	s.send()
+}
+
+func (s *Stream) serve() {
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.closed:
+			return
+		case <-ticker.C:
+			s.send()
+		}
+	}
+}
+
+func (s *Stream) send() {
+	s.mutex.Lock()
+	if s.frame == nil {
+		s.mutex.Unlock()
+		return
+	}
+	packets := s.packetizer.Packetize(s.frame, uint32(s.interval*clockRate/time.Second))
+	s.mutex.Unlock()
+
+	s.sending.Lock()
+	defer s.sending.Unlock()
+	for _, pkt := range packets {
+		select {
+		case <-s.closed:
+			return
+		default:
+			s.handler(pkt)
+		}
+	}
+}
+
+// Close stop sending, no packet reach handler after it returns
+func (s *Stream) Close() {
+	s.closeOnce.Do(func() {
+		close(s.closed)
+	})
+	s.sending.Lock()
+	s.sending.Unlock()
+}
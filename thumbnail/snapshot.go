@@ -0,0 +1,125 @@
+package thumbnail
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"sync"
+	"time"
+
+	"github.com/lamhai1401/testrtc/codec"
+	"github.com/pion/rtp"
+	"golang.org/x/image/vp8"
+)
+
+const (
+	jpegQuality = 75
+)
+
+// Thumbnail a jpeg snapshot of a video
+type Thumbnail struct {
+	JPEG      []byte
+	Width     int
+	Height    int
+	UpdatedAt time.Time
+}
+
+// snapshotter decode a vp8 keyframe to jpeg at most once per interval
+type snapshotter struct {
+	interval   time.Duration
+	maxWidth   int
+	builder    *codec.FrameBuilder
+	decoder    *vp8.Decoder
+	latest     *Thumbnail
+	lastDecode time.Time
+	mutex      sync.Mutex
+}
+
+func newSnapshotter(interval time.Duration, maxWidth int) *snapshotter {
+	return &snapshotter{
+		interval: interval,
+		maxWidth: maxWidth,
+		builder:  codec.NewFrameBuilder(codec.VP8),
+		decoder:  vp8.NewDecoder(),
+	}
+}
+
+// push a packet, return a new thumbnail when one is made,
+// senders are asked for keyframes periodically so only keyframes are decoded
+func (s *snapshotter) push(pkt *rtp.Packet, now time.Time) (*Thumbnail, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	frame, err := s.builder.Push(pkt)
+	if err != nil || frame == nil || !frame.Keyframe {
+		return nil, err
+	}
+	if now.Sub(s.lastDecode) < s.interval {
+		return nil, nil
+	}
+
+	thumbnail, err := s.decode(frame.Data, now)
+	if err != nil {
+		return nil, err
+	}
+	s.latest = thumbnail
+	s.lastDecode = now
+	return thumbnail, nil
+}
+
+func (s *snapshotter) decode(data []byte, now time.Time) (*Thumbnail, error) {
+	s.decoder.Init(bytes.NewReader(data), len(data))
+	if _, err := s.decoder.DecodeFrameHeader(); err != nil {
+		return nil, err
+	}
+	img, err := s.decoder.DecodeFrame()
+	if err != nil {
+		return nil, err
+	}
+
+	scaled := scale(img, s.maxWidth)
+	buf := &bytes.Buffer{}
+	if err := jpeg.Encode(buf, scaled, &jpeg.Options{Quality: jpegQuality}); err != nil {
+		return nil, err
+	}
+
+	bounds := scaled.Bounds()
+	return &Thumbnail{
+		JPEG:      buf.Bytes(),
+		Width:     bounds.Dx(),
+		Height:    bounds.Dy(),
+		UpdatedAt: now,
+	}, nil
+}
+
+func (s *snapshotter) get() *Thumbnail {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.latest
+}
+
+// scale down to maxWidth keeping aspect ratio, nearest neighbour is enough for thumbnails
+func scale(img *image.YCbCr, maxWidth int) image.Image {
+	bounds := img.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	if maxWidth <= 0 || width <= maxWidth {
+		return img
+	}
+
+	dstWidth := maxWidth
+	dstHeight := height * maxWidth / width
+	if dstHeight == 0 {
+		dstHeight = 1
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, dstWidth, dstHeight))
+	for y := 0; y < dstHeight; y++ {
+		srcY := bounds.Min.Y + y*height/dstHeight
+		for x := 0; x < dstWidth; x++ {
+			srcX := bounds.Min.X + x*width/dstWidth
+			dst.Set(x, y, color.RGBAModel.Convert(img.YCbCrAt(srcX, srcY)))
+		}
+	}
+	return dst
+}
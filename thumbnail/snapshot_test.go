@@ -0,0 +1,17 @@
+package thumbnail
+
+import (
+	"image"
+	"testing"
+)
+
+func TestScale(t *testing.T) {
+	img := image.NewYCbCr(image.Rect(0, 0, 640, 360), image.YCbCrSubsampleRatio420)
+
+	if bounds := scale(img, 320).Bounds(); bounds.Dx() != 320 || bounds.Dy() != 180 {
+		t.Fatalf("wrong scaled size %v", bounds)
+	}
+	if scale(img, 1280) != image.Image(img) {
+		t.Fatalf("small image should not be scaled")
+	}
+}
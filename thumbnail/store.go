@@ -0,0 +1,116 @@
+package thumbnail
+
+import (
+	"encoding/json"
+	"net/http"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/lamhai1401/gologs/logs"
+	"github.com/lamhai1401/testrtc/utils"
+	"github.com/pion/rtp"
+)
+
+// Store keep latest thumbnail of every video by id
+type Store struct {
+	interval  time.Duration
+	maxWidth  int
+	onUpdate  func(id string, thumbnail *Thumbnail)
+	snapshots *utils.AdvanceMap // id - *snapshotter
+}
+
+// NewStore make a thumbnail every interval, onUpdate can be nil
+func NewStore(interval time.Duration, maxWidth int, onUpdate func(id string, thumbnail *Thumbnail)) *Store {
+	return &Store{
+		interval:  interval,
+		maxWidth:  maxWidth,
+		onUpdate:  onUpdate,
+		snapshots: utils.NewAdvanceMap(),
+	}
+}
+
+func (s *Store) getSnapshotter(id string) *snapshotter {
+	if value, has := s.snapshots.Get(id); has {
+		if snapshot, ok := value.(*snapshotter); ok {
+			return snapshot
+		}
+	}
+
+	snapshot := newSnapshotter(s.interval, s.maxWidth)
+	s.snapshots.Set(id, snapshot)
+	return snapshot
+}
+
+// Push a vp8 packet of id in sequence order
+func (s *Store) Push(id string, pkt *rtp.Packet) {
+	thumbnail, err := s.getSnapshotter(id).push(pkt, time.Now())
+	if err != nil {
+		logs.Warn("Make thumbnail of ", id, " err: ", err.Error())
+		return
+	}
+	if thumbnail != nil && s.onUpdate != nil {
+		s.onUpdate(id, thumbnail)
+	}
+}
+
+// Get latest thumbnail of id, nil if none yet
+func (s *Store) Get(id string) *Thumbnail {
+	value, has := s.snapshots.Get(id)
+	if !has {
+		return nil
+	}
+	snapshot, ok := value.(*snapshotter)
+	if !ok {
+		return nil
+	}
+	return snapshot.get()
+}
+
+// Remove video of a leaving participant
+func (s *Store) Remove(id string) {
+	s.snapshots.Delete(id)
+}
+
+type entry struct {
+	ID        string    `json:"id"`
+	URL       string    `json:"url"`
+	Width     int       `json:"width"`
+	Height    int       `json:"height"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+// ServeHTTP index.json lists thumbnails, <id>.jpg returns one, strip any path prefix before it
+func (s *Store) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	name := path.Base(r.URL.Path)
+	if name == "index.json" || name == "." || name == "/" {
+		entries := make([]*entry, 0)
+		for _, id := range s.snapshots.GetKeys() {
+			if thumbnail := s.Get(id); thumbnail != nil {
+				entries = append(entries, &entry{
+					ID:        id,
+					URL:       id + ".jpg",
+					Width:     thumbnail.Width,
+					Height:    thumbnail.Height,
+					UpdatedAt: thumbnail.UpdatedAt,
+				})
+			}
+		}
+		sort.Slice(entries, func(i, j int) bool { return entries[i].ID < entries[j].ID })
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(entries)
+		return
+	}
+
+	thumbnail := s.Get(strings.TrimSuffix(name, ".jpg"))
+	if !strings.HasSuffix(name, ".jpg") || thumbnail == nil {
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("Content-Type", "image/jpeg")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Last-Modified", thumbnail.UpdatedAt.UTC().Format(http.TimeFormat))
+	w.Write(thumbnail.JPEG)
+}
@@ -0,0 +1,260 @@
+package upload
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+const (
+	defaultRegion   = "us-east-1"
+	defaultPartSize = 8 * 1024 * 1024
+	requestTimeout  = 5 * time.Minute
+)
+
+// Config of an s3 compatible bucket
+type Config struct {
+	Endpoint  string // e.g. https://s3.amazonaws.com or http://localhost:9000
+	Region    string
+	Bucket    string
+	AccessKey string
+	SecretKey string
+	Prefix    string // key prefix of uploaded files
+	PathStyle bool   // endpoint/bucket/key instead of bucket.endpoint/key
+	PartSize  int64  // files bigger than this use multipart upload
+}
+
+// Client minimal s3 client for uploading objects
+type Client struct {
+	config   Config
+	endpoint *url.URL
+	http     *http.Client
+}
+
+// NewClient linter
+func NewClient(config Config) (*Client, error) {
+	endpoint, err := url.Parse(config.Endpoint)
+	if err != nil {
+		return nil, err
+	}
+	if endpoint.Scheme != "http" && endpoint.Scheme != "https" {
+		return nil, fmt.Errorf("invalid s3 endpoint: %s", config.Endpoint)
+	}
+	if config.Bucket == "" {
+		return nil, fmt.Errorf("s3 bucket is empty")
+	}
+	if config.Region == "" {
+		config.Region = defaultRegion
+	}
+	if config.PartSize <= 0 {
+		config.PartSize = defaultPartSize
+	}
+
+	return &Client{
+		config:   config,
+		endpoint: endpoint,
+		http:     &http.Client{Timeout: requestTimeout},
+	}, nil
+}
+
+// ObjectURL url of key in bucket
+func (c *Client) ObjectURL(key string) string {
+	u := *c.endpoint
+	if c.config.PathStyle {
+		u.Path = "/" + c.config.Bucket + "/" + key
+		u.RawPath = "/" + c.config.Bucket + "/" + escape(key, true)
+	} else {
+		u.Host = c.config.Bucket + "." + u.Host
+		u.Path = "/" + key
+		u.RawPath = "/" + escape(key, true)
+	}
+	return u.String()
+}
+
+type errorResponse struct {
+	Code    string `xml:"Code"`
+	Message string `xml:"Message"`
+}
+
+// do send a signed request and return response body, non 2xx and error documents are errors
+func (c *Client) do(method, key string, query url.Values, body []byte, headers map[string]string) ([]byte, http.Header, error) {
+	req, err := http.NewRequest(method, c.ObjectURL(key), bytes.NewReader(body))
+	if err != nil {
+		return nil, nil, err
+	}
+	req.URL.RawQuery = canonicalQuery(query)
+	req.ContentLength = int64(len(body))
+	for name, value := range headers {
+		req.Header.Set(name, value)
+	}
+	sign(req, sha256Hex(body), c.config.Region, c.config.AccessKey, c.config.SecretKey, time.Now())
+
+	res, err := c.http.Do(req)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer res.Body.Close()
+
+	data, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// complete multipart may fail with status 200
+	if res.StatusCode/100 != 2 || bytes.Contains(data, []byte("<Error>")) {
+		e := &errorResponse{}
+		xml.Unmarshal(data, e)
+		return nil, nil, fmt.Errorf("s3 %s %s: %d %s %s", method, key, res.StatusCode, e.Code, e.Message)
+	}
+	return data, res.Header, nil
+}
+
+func md5Sum(data []byte) []byte {
+	sum := md5.Sum(data)
+	return sum[:]
+}
+
+// verifyETag compare etag of server with expected md5 hex
+func verifyETag(header http.Header, expect string) error {
+	etag := strings.Trim(header.Get("ETag"), `"`)
+	if etag != expect {
+		return fmt.Errorf("checksum mismatch: etag %s, expect %s", etag, expect)
+	}
+	return nil
+}
+
+// Put upload small data in one request
+func (c *Client) Put(key string, data []byte) error {
+	sum := md5Sum(data)
+	_, header, err := c.do("PUT", key, url.Values{}, data, map[string]string{
+		"Content-MD5": base64.StdEncoding.EncodeToString(sum),
+	})
+	if err != nil {
+		return err
+	}
+	return verifyETag(header, hex.EncodeToString(sum))
+}
+
+type completePart struct {
+	PartNumber int    `xml:"PartNumber"`
+	ETag       string `xml:"ETag"`
+}
+
+type completeMultipartUpload struct {
+	XMLName xml.Name        `xml:"CompleteMultipartUpload"`
+	Parts   []*completePart `xml:"Part"`
+}
+
+// PutFile upload a file, multipart if bigger than part size
+func (c *Client) PutFile(key, path string) (int64, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return 0, err
+	}
+	if info.Size() <= c.config.PartSize {
+		data, err := ioutil.ReadAll(file)
+		if err != nil {
+			return 0, err
+		}
+		return int64(len(data)), c.Put(key, data)
+	}
+	return info.Size(), c.putMultipart(key, file)
+}
+
+func (c *Client) putMultipart(key string, file io.Reader) error {
+	data, _, err := c.do("POST", key, url.Values{"uploads": {""}}, nil, nil)
+	if err != nil {
+		return err
+	}
+	initiate := &struct {
+		UploadID string `xml:"UploadId"`
+	}{}
+	if err := xml.Unmarshal(data, initiate); err != nil || initiate.UploadID == "" {
+		return fmt.Errorf("invalid initiate multipart upload response: %s", data)
+	}
+
+	uploadID := initiate.UploadID
+	if err := c.uploadParts(key, uploadID, file); err != nil {
+		c.do("DELETE", key, url.Values{"uploadId": {uploadID}}, nil, nil)
+		return err
+	}
+	return nil
+}
+
+func (c *Client) uploadParts(key, uploadID string, file io.Reader) error {
+	complete := &completeMultipartUpload{}
+	sums := make([]byte, 0)
+	buf := make([]byte, c.config.PartSize)
+
+	for number := 1; ; number++ {
+		n, err := io.ReadFull(file, buf)
+		if err == io.EOF {
+			break
+		}
+		if err != nil && err != io.ErrUnexpectedEOF {
+			return err
+		}
+
+		sum := md5Sum(buf[:n])
+		_, header, err := c.do("PUT", key, url.Values{
+			"partNumber": {fmt.Sprint(number)},
+			"uploadId":   {uploadID},
+		}, buf[:n], map[string]string{
+			"Content-MD5": base64.StdEncoding.EncodeToString(sum),
+		})
+		if err != nil {
+			return err
+		}
+		if err := verifyETag(header, hex.EncodeToString(sum)); err != nil {
+			return fmt.Errorf("part %d: %v", number, err)
+		}
+
+		sums = append(sums, sum...)
+		complete.Parts = append(complete.Parts, &completePart{
+			PartNumber: number,
+			ETag:       `"` + hex.EncodeToString(sum) + `"`,
+		})
+		if n < len(buf) {
+			break
+		}
+	}
+
+	body, err := xml.Marshal(complete)
+	if err != nil {
+		return err
+	}
+	data, _, err := c.do("POST", key, url.Values{"uploadId": {uploadID}}, body, nil)
+	if err != nil {
+		return err
+	}
+
+	result := &struct {
+		ETag string `xml:"ETag"`
+	}{}
+	if err := xml.Unmarshal(data, result); err != nil {
+		return err
+	}
+
+	// etag of multipart object is md5 of part md5s and part count
+	expect := fmt.Sprintf("%s-%d", hex.EncodeToString(md5Sum(sums)), len(complete.Parts))
+	if etag := strings.Trim(result.ETag, `"`); etag != expect {
+		return fmt.Errorf("checksum mismatch: etag %s, expect %s", etag, expect)
+	}
+	return nil
+}
@@ -0,0 +1,103 @@
+package upload
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/lamhai1401/gologs/logs"
+)
+
+const (
+	maxConcurrent = 2
+	maxAttempts   = 4
+	firstBackoff  = 2 * time.Second
+)
+
+// Result of uploading one file
+type Result struct {
+	Path string `json:"path"`
+	Key  string `json:"key"`
+	URL  string `json:"url,omitempty"`
+	Size int64  `json:"size"`
+	Err  string `json:"error,omitempty"`
+}
+
+// Uploader upload finished files in background, delete local copies after success
+type Uploader struct {
+	client  *Client
+	onDone  func(result *Result)
+	slots   chan struct{} // limit concurrent uploads
+	wg      sync.WaitGroup
+	backoff time.Duration
+}
+
+// NewUploader onDone is called for every file, success or not
+func NewUploader(client *Client, onDone func(result *Result)) *Uploader {
+	return &Uploader{
+		client:  client,
+		onDone:  onDone,
+		slots:   make(chan struct{}, maxConcurrent),
+		backoff: firstBackoff,
+	}
+}
+
+// Upload queue a file, it does not block
+func (u *Uploader) Upload(path string) {
+	u.wg.Add(1)
+	go func() {
+		defer u.wg.Done()
+		u.slots <- struct{}{}
+		defer func() { <-u.slots }()
+
+		result := u.upload(path)
+		if u.onDone != nil {
+			u.onDone(result)
+		}
+	}()
+}
+
+func (u *Uploader) upload(path string) *Result {
+	key := u.client.config.Prefix + filepath.Base(path)
+	result := &Result{
+		Path: path,
+		Key:  key,
+	}
+
+	var err error
+	backoff := u.backoff
+	for attempt := 1; attempt <= maxAttempts; attempt++ {
+		if result.Size, err = u.client.PutFile(key, path); err == nil {
+			break
+		}
+		if os.IsNotExist(err) {
+			break
+		}
+
+		logs.Warn(fmt.Sprintf("Upload %s attempt %d err: %v", path, attempt, err))
+		if attempt < maxAttempts {
+			time.Sleep(backoff)
+			backoff *= 2
+		}
+	}
+
+	if err != nil {
+		logs.Error(fmt.Sprintf("Upload %s err: %v, keep local file", path, err))
+		result.Err = err.Error()
+		return result
+	}
+
+	result.URL = u.client.ObjectURL(key)
+	if err := os.Remove(path); err != nil {
+		logs.Error(fmt.Sprintf("Remove uploaded %s err: %v", path, err))
+	}
+	logs.Info(fmt.Sprintf("Uploaded %s to %s", path, result.URL))
+	return result
+}
+
+// Wait until queued uploads are done
+func (u *Uploader) Wait() {
+	u.wg.Wait()
+}
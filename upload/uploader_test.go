@@ -0,0 +1,125 @@
+package upload
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// fakeS3 keeps objects in memory, first request fails to test retries
+type fakeS3 struct {
+	objects map[string][]byte
+	parts   map[int][]byte
+	failed  bool
+	mutex   sync.Mutex
+}
+
+func (f *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	if !strings.HasPrefix(r.Header.Get("Authorization"), algorithm) {
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
+	if !f.failed {
+		f.failed = true
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	body, _ := ioutil.ReadAll(r.Body)
+	sum := md5.Sum(body)
+	query := r.URL.Query()
+
+	switch {
+	case r.Method == "PUT" && query.Get("partNumber") != "":
+		var number int
+		fmt.Sscan(query.Get("partNumber"), &number)
+		f.parts[number] = body
+		w.Header().Set("ETag", `"`+hex.EncodeToString(sum[:])+`"`)
+	case r.Method == "PUT":
+		f.objects[r.URL.Path] = body
+		w.Header().Set("ETag", `"`+hex.EncodeToString(sum[:])+`"`)
+	case r.Method == "POST" && hasQuery(query, "uploads"):
+		f.parts = make(map[int][]byte)
+		w.Write([]byte("<InitiateMultipartUploadResult><UploadId>1</UploadId></InitiateMultipartUploadResult>"))
+	case r.Method == "POST" && query.Get("uploadId") == "1":
+		complete := &completeMultipartUpload{}
+		xml.Unmarshal(body, complete)
+
+		data, sums := []byte{}, []byte{}
+		for _, part := range complete.Parts {
+			data = append(data, f.parts[part.PartNumber]...)
+			partSum := md5.Sum(f.parts[part.PartNumber])
+			sums = append(sums, partSum[:]...)
+		}
+		f.objects[r.URL.Path] = data
+		total := md5.Sum(sums)
+		fmt.Fprintf(w, `<CompleteMultipartUploadResult><ETag>"%s-%d"</ETag></CompleteMultipartUploadResult>`, hex.EncodeToString(total[:]), len(complete.Parts))
+	default:
+		w.WriteHeader(http.StatusBadRequest)
+	}
+}
+
+func TestUploader(t *testing.T) {
+	s3 := &fakeS3{objects: make(map[string][]byte)}
+	server := httptest.NewServer(s3)
+	defer server.Close()
+
+	client, err := NewClient(Config{
+		Endpoint:  server.URL,
+		Bucket:    "records",
+		Prefix:    "room/",
+		PathStyle: true,
+		PartSize:  4,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir, err := ioutil.TempDir("", "upload")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "a b.webm")
+	if err := ioutil.WriteFile(path, []byte("0123456789"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	results := make([]*Result, 0)
+	uploader := NewUploader(client, func(result *Result) {
+		results = append(results, result)
+	})
+	uploader.backoff = 0
+	uploader.Upload(path)
+	uploader.Wait()
+
+	if len(results) != 1 || results[0].Err != "" {
+		t.Fatalf("wrong results: %+v", results)
+	}
+	if results[0].URL != server.URL+"/records/room/a%20b.webm" || results[0].Size != 10 {
+		t.Fatalf("wrong result: %+v", results[0])
+	}
+	if got := string(s3.objects["/records/room/a b.webm"]); got != "0123456789" {
+		t.Fatalf("wrong object: %q", got)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Fatalf("local file is not deleted")
+	}
+}
+
+func hasQuery(query map[string][]string, key string) bool {
+	_, ok := query[key]
+	return ok
+}
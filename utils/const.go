@@ -1,8 +1,11 @@
 package utils
 
 import (
+	"net"
 	"os"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/lamhai1401/gologs/logs"
 )
@@ -15,12 +18,67 @@ var (
 	// MixerStreamID linter
 	MixerStreamID = os.Getenv("MIXERSTREAMID")
 	mixerLength   = os.Getenv("MIXERLENGTH")
+	mixerWidth    = os.Getenv("MIXERWIDTH")
+	mixerHeight   = os.Getenv("MIXERHEIGHT")
+	mixerFPS      = os.Getenv("MIXERFRAMERATE")
+	mixerBitrate  = os.Getenv("MIXERBITRATE")
+	mixerRate     = os.Getenv("MIXERSAMPLERATE")
+	mixerVideo    = os.Getenv("MIXERVIDEO")
+	mixerAudio    = os.Getenv("MIXERAUDIO")
+	mixerConfig   = os.Getenv("MIXERCONFIG")
+	mixerBackend  = os.Getenv("MIXERBACKEND")
+	renditions    = os.Getenv("MIXERRENDITIONS")
 	nodeLevel     = os.Getenv("NODELEVEL")
+	fecEnable     = os.Getenv("FECENABLE")
+	fecGroupSize  = os.Getenv("FECGROUPSIZE")
+	jitterSize    = os.Getenv("JITTERSIZE")
+	jitterLatency = os.Getenv("JITTERLATENCY")
+	statsInterval = os.Getenv("STATSINTERVAL")
+	recordDir     = os.Getenv("RECORDDIR")
+	recordMaxSize = os.Getenv("RECORDMAXSIZE")
+	recordMaxTime = os.Getenv("RECORDMAXDURATION")
+	captureDir    = os.Getenv("CAPTUREDIR")
+	httpAddr      = os.Getenv("HTTPADDR")
+	hlsSegment    = os.Getenv("HLSSEGMENTDURATION")
+	hlsPart       = os.Getenv("HLSPARTDURATION")
+	hlsWindow     = os.Getenv("HLSWINDOW")
+	ingestSDP     = os.Getenv("INGESTSDP")
+	rtspSources   = os.Getenv("RTSPSOURCES")
+	s3Endpoint    = os.Getenv("S3ENDPOINT")
+	s3Region      = os.Getenv("S3REGION")
+	s3Bucket      = os.Getenv("S3BUCKET")
+	s3AccessKey   = os.Getenv("S3ACCESSKEY")
+	s3SecretKey   = os.Getenv("S3SECRETKEY")
+	s3Prefix      = os.Getenv("S3PREFIX")
+	s3PathStyle   = os.Getenv("S3PATHSTYLE")
+	thumbInterval = os.Getenv("THUMBNAILINTERVAL")
+	thumbWidth    = os.Getenv("THUMBNAILWIDTH")
+	pcmSampleRate = os.Getenv("PCMSAMPLERATE")
+	pcmChannels   = os.Getenv("PCMCHANNELS")
+	pcmFrame      = os.Getenv("PCMFRAME")
+	pcmSocket     = os.Getenv("PCMSOCKET")
+	placeholder   = os.Getenv("PLACEHOLDERIMAGE")
+	mutedImage    = os.Getenv("MUTEDIMAGE")
+	audioNorm     = os.Getenv("AUDIONORMALIZE")
+	audioLimiter  = os.Getenv("AUDIOLIMITER")
+	seatRoles     = os.Getenv("SEATROLES")
+	cascadeAddr   = os.Getenv("CASCADEADDR")
+	cascadeParent = os.Getenv("CASCADEPARENT")
+	cascadeID     = os.Getenv("CASCADEID")
+	roleSecret    = os.Getenv("ROLESECRET")
+	moderators    = os.Getenv("MODERATORROLES")
+	rtmpHosts     = os.Getenv("RTMPHOSTS")
+	rtspHosts     = os.Getenv("RTSPHOSTS")
+	ingestPorts   = os.Getenv("INGESTPORTS")
+	ingestSources = os.Getenv("INGESTSOURCES")
+	cascadeSecret = os.Getenv("CASCADESECRET")
+	cascadeAllow  = os.Getenv("CASCADEALLOW")
 	// NodeLevel linter
 	NodeLevel = -1
 )
 
-// GetNodeLevel get level of current node, default is 0
+// GetNodeLevel get level of current node in a cascade, default is -1 not cascading.
+// Level 0 mixes local participants, level N mixes the sub-mixes of level N-1
 func GetNodeLevel() int {
 	if nodeLevel == "" {
 		return -1
@@ -35,17 +93,626 @@ func GetNodeLevel() int {
 	return level
 }
 
-// GetMixerLength get numbers of mixer inputs, default is 1
+// GetMixerLength get numbers of mixer inputs, default is 10
 func GetMixerLength() int {
 	if mixerLength == "" {
-		return 1
+		return 10
 	}
 
-	level, err := strconv.Atoi(mixerLength)
+	length, err := strconv.Atoi(mixerLength)
 	if err != nil {
-		logs.Error("Get node level err: ", err.Error())
-		return 1
+		logs.Error("Get mixer length err: ", err.Error())
+		return 10
 	}
 
-	return level
+	return length
+}
+
+// GetMixerStreamID get id of the mixed stream, default is mixedStreamID
+func GetMixerStreamID() string {
+	if MixerStreamID == "" {
+		return "mixedStreamID"
+	}
+	return MixerStreamID
+}
+
+// IsFECEnable check red and ulpfec are allowed to negotiate, default is false
+func IsFECEnable() bool {
+	enable, err := strconv.ParseBool(fecEnable)
+	if err != nil {
+		return false
+	}
+	return enable
+}
+
+// GetFECGroupSize get numbers of video packets protected by one ulpfec packet, default is 5
+func GetFECGroupSize() int {
+	if fecGroupSize == "" {
+		return 5
+	}
+
+	size, err := strconv.Atoi(fecGroupSize)
+	if err != nil {
+		logs.Error("Get fec group size err: ", err.Error())
+		return 5
+	}
+
+	return size
+}
+
+// GetJitterSize get max packets a jitter buffer hold while waiting a missing one, default is 100
+func GetJitterSize() int {
+	if jitterSize == "" {
+		return 100
+	}
+
+	size, err := strconv.Atoi(jitterSize)
+	if err != nil {
+		logs.Error("Get jitter size err: ", err.Error())
+		return 100
+	}
+
+	return size
+}
+
+// GetJitterLatency get max time in millisecond a packet wait for a missing one, default is 150
+func GetJitterLatency() time.Duration {
+	if jitterLatency == "" {
+		return 150 * time.Millisecond
+	}
+
+	latency, err := strconv.Atoi(jitterLatency)
+	if err != nil {
+		logs.Error("Get jitter latency err: ", err.Error())
+		return 150 * time.Millisecond
+	}
+
+	return time.Duration(latency) * time.Millisecond
+}
+
+// GetStatsInterval get seconds between stats events of a peer, default is 5, 0 is disabled
+func GetStatsInterval() time.Duration {
+	if statsInterval == "" {
+		return 5 * time.Second
+	}
+
+	interval, err := strconv.Atoi(statsInterval)
+	if err != nil {
+		logs.Error("Get stats interval err: ", err.Error())
+		return 5 * time.Second
+	}
+
+	return time.Duration(interval) * time.Second
+}
+
+// GetRecordDir get folder of participant recordings, default is records
+func GetRecordDir() string {
+	if recordDir == "" {
+		return "records"
+	}
+	return recordDir
+}
+
+// GetRecordMaxSize get max bytes of a recording file before rotating, env in MB, default is 0 (unlimited)
+func GetRecordMaxSize() int64 {
+	if recordMaxSize == "" {
+		return 0
+	}
+
+	size, err := strconv.Atoi(recordMaxSize)
+	if err != nil {
+		logs.Error("Get record max size err: ", err.Error())
+		return 0
+	}
+
+	return int64(size) * 1024 * 1024
+}
+
+// GetRecordMaxDuration get max duration of a recording file before rotating, env in seconds, default is 0 (unlimited)
+func GetRecordMaxDuration() time.Duration {
+	if recordMaxTime == "" {
+		return 0
+	}
+
+	duration, err := strconv.Atoi(recordMaxTime)
+	if err != nil {
+		logs.Error("Get record max duration err: ", err.Error())
+		return 0
+	}
+
+	return time.Duration(duration) * time.Second
+}
+
+// GetCaptureDir get folder of rtp dump files, default is captures
+func GetCaptureDir() string {
+	if captureDir == "" {
+		return "captures"
+	}
+	return captureDir
+}
+
+// GetHTTPAddr get listen address of http server for hls and thumbnails, empty is not serving
+func GetHTTPAddr() string {
+	return httpAddr
+}
+
+// GetHLSSegmentDuration get target duration of hls segments, env in seconds, default is 2s
+func GetHLSSegmentDuration() time.Duration {
+	if hlsSegment == "" {
+		return 2 * time.Second
+	}
+
+	duration, err := strconv.Atoi(hlsSegment)
+	if err != nil || duration <= 0 {
+		logs.Error("Get hls segment duration err: ", hlsSegment)
+		return 2 * time.Second
+	}
+
+	return time.Duration(duration) * time.Second
+}
+
+// GetHLSPartDuration get duration of low latency hls parts, env in ms, default is 0 (disabled)
+func GetHLSPartDuration() time.Duration {
+	if hlsPart == "" {
+		return 0
+	}
+
+	duration, err := strconv.Atoi(hlsPart)
+	if err != nil {
+		logs.Error("Get hls part duration err: ", err.Error())
+		return 0
+	}
+
+	return time.Duration(duration) * time.Millisecond
+}
+
+// GetHLSWindow get number of segments in hls playlist, default is 6
+func GetHLSWindow() int {
+	if hlsWindow == "" {
+		return 6
+	}
+
+	window, err := strconv.Atoi(hlsWindow)
+	if err != nil {
+		logs.Error("Get hls window err: ", err.Error())
+		return 6
+	}
+
+	return window
+}
+
+// GetIngestSDPs get sdp files of plain rtp sources joining the mixer, env is comma separated
+func GetIngestSDPs() []string {
+	paths := make([]string, 0)
+	for _, path := range strings.Split(ingestSDP, ",") {
+		if path = strings.TrimSpace(path); path != "" {
+			paths = append(paths, path)
+		}
+	}
+	return paths
+}
+
+// GetRTSPSources get signalID - rtsp url of cameras joining the mixer, env is comma separated signalID=url
+func GetRTSPSources() map[string]string {
+	sources := make(map[string]string)
+	for _, source := range strings.Split(rtspSources, ",") {
+		kv := strings.SplitN(strings.TrimSpace(source), "=", 2)
+		if len(kv) != 2 || kv[0] == "" || kv[1] == "" {
+			continue
+		}
+		sources[kv[0]] = kv[1]
+	}
+	return sources
+}
+
+// GetS3Endpoint get endpoint of s3 compatible storage, default is https://s3.amazonaws.com
+func GetS3Endpoint() string {
+	if s3Endpoint == "" {
+		return "https://s3.amazonaws.com"
+	}
+	return s3Endpoint
+}
+
+// GetS3Region linter
+func GetS3Region() string {
+	return s3Region
+}
+
+// GetS3Bucket get bucket of finished recordings, empty is not uploading
+func GetS3Bucket() string {
+	return s3Bucket
+}
+
+// GetS3Credentials get access key and secret key
+func GetS3Credentials() (string, string) {
+	return s3AccessKey, s3SecretKey
+}
+
+// GetS3Prefix get key prefix of uploaded recordings
+func GetS3Prefix() string {
+	return s3Prefix
+}
+
+// IsS3PathStyle use endpoint/bucket/key urls, default is true as minio needs it
+func IsS3PathStyle() bool {
+	pathStyle, err := strconv.ParseBool(s3PathStyle)
+	if err != nil {
+		return true
+	}
+	return pathStyle
+}
+
+// GetThumbnailInterval get min time between thumbnails of a video, env in seconds, default is 5s
+func GetThumbnailInterval() time.Duration {
+	if thumbInterval == "" {
+		return 5 * time.Second
+	}
+
+	interval, err := strconv.Atoi(thumbInterval)
+	if err != nil {
+		logs.Error("Get thumbnail interval err: ", err.Error())
+		return 5 * time.Second
+	}
+
+	return time.Duration(interval) * time.Second
+}
+
+// GetThumbnailWidth get max width of thumbnails, default is 320
+func GetThumbnailWidth() int {
+	if thumbWidth == "" {
+		return 320
+	}
+
+	width, err := strconv.Atoi(thumbWidth)
+	if err != nil {
+		logs.Error("Get thumbnail width err: ", err.Error())
+		return 320
+	}
+
+	return width
+}
+
+// GetPCMSampleRate get sample rate of decoded audio, one of 8000, 12000, 16000, 24000, 48000, default is 16000
+func GetPCMSampleRate() int {
+	if pcmSampleRate == "" {
+		return 16000
+	}
+
+	rate, err := strconv.Atoi(pcmSampleRate)
+	if err != nil {
+		logs.Error("Get pcm sample rate err: ", err.Error())
+		return 16000
+	}
+
+	switch rate {
+	case 8000, 12000, 16000, 24000, 48000:
+		return rate
+	default:
+		logs.Error("Unsupported pcm sample rate: ", rate)
+		return 16000
+	}
+}
+
+// GetPCMChannels get 1 for mono or 2 for stereo decoded audio, default is 1
+func GetPCMChannels() int {
+	if pcmChannels == "2" {
+		return 2
+	}
+	return 1
+}
+
+// GetPCMFrameDuration get duration of each decoded frame, env in ms, default is 20ms
+func GetPCMFrameDuration() time.Duration {
+	if pcmFrame == "" {
+		return 20 * time.Millisecond
+	}
+
+	frame, err := strconv.Atoi(pcmFrame)
+	if err != nil || frame <= 0 {
+		logs.Error("Get pcm frame duration err: ", pcmFrame)
+		return 20 * time.Millisecond
+	}
+
+	return time.Duration(frame) * time.Millisecond
+}
+
+// GetPCMSocket get unix socket path serving decoded audio, empty is not serving
+func GetPCMSocket() string {
+	return pcmSocket
+}
+
+// GetMixerWidth get width of mixed video canvas, default is 1280
+func GetMixerWidth() int {
+	if mixerWidth == "" {
+		return 1280
+	}
+
+	width, err := strconv.Atoi(mixerWidth)
+	if err != nil || width <= 0 {
+		logs.Error("Get mixer width err: ", mixerWidth)
+		return 1280
+	}
+
+	return width
+}
+
+// GetMixerHeight get height of mixed video canvas, default is 720
+func GetMixerHeight() int {
+	if mixerHeight == "" {
+		return 720
+	}
+
+	height, err := strconv.Atoi(mixerHeight)
+	if err != nil || height <= 0 {
+		logs.Error("Get mixer height err: ", mixerHeight)
+		return 720
+	}
+
+	return height
+}
+
+// GetPlaceholderImage get ivf file whose first frame, a vp8 keyframe, is the tile of participant without video
+func GetPlaceholderImage() string {
+	if placeholder == "" {
+		return "resources/img/voice-only-icon.ivf"
+	}
+	return placeholder
+}
+
+// GetMutedImage get ivf file of the tile of participant without video and with muted audio
+func GetMutedImage() string {
+	if mutedImage == "" {
+		return "resources/img/voice-only-muted.ivf"
+	}
+	return mutedImage
+}
+
+// IsAudioNormalize check participants are brought to the same loudness at start, default is false
+func IsAudioNormalize() bool {
+	normalize, err := strconv.ParseBool(audioNorm)
+	if err != nil {
+		return false
+	}
+	return normalize
+}
+
+// IsAudioLimiter check mixed audio is limited against clipping, default is true
+func IsAudioLimiter() bool {
+	limiter, err := strconv.ParseBool(audioLimiter)
+	if err != nil {
+		return true
+	}
+	return limiter
+}
+
+// GetMixerFrameRate get frames per second of mixed video, default is 30
+func GetMixerFrameRate() int {
+	if mixerFPS == "" {
+		return 30
+	}
+
+	fps, err := strconv.Atoi(mixerFPS)
+	if err != nil {
+		logs.Error("Get mixer frame rate err: ", err.Error())
+		return 30
+	}
+
+	return fps
+}
+
+// GetMixerBitrate get bitrate of mixed video in kbps, default is 1500
+func GetMixerBitrate() int {
+	if mixerBitrate == "" {
+		return 1500
+	}
+
+	bitrate, err := strconv.Atoi(mixerBitrate)
+	if err != nil {
+		logs.Error("Get mixer bitrate err: ", err.Error())
+		return 1500
+	}
+
+	return bitrate
+}
+
+// GetMixerSampleRate get sample rate of mixed audio, default is 48000
+func GetMixerSampleRate() int {
+	if mixerRate == "" {
+		return 48000
+	}
+
+	rate, err := strconv.Atoi(mixerRate)
+	if err != nil {
+		logs.Error("Get mixer sample rate err: ", err.Error())
+		return 48000
+	}
+
+	return rate
+}
+
+// IsMixerVideo check the mixer output video, default is true
+func IsMixerVideo() bool {
+	video, err := strconv.ParseBool(mixerVideo)
+	if err != nil {
+		return true
+	}
+	return video
+}
+
+// IsMixerAudio check the mixer output audio, default is true
+func IsMixerAudio() bool {
+	audio, err := strconv.ParseBool(mixerAudio)
+	if err != nil {
+		return true
+	}
+	return audio
+}
+
+// GetMixerConfig get json file of mixer configs by room, empty is every room on env values
+func GetMixerConfig() string {
+	return mixerConfig
+}
+
+// GetMixerBackend get v2, passthrough or audio, default is v2
+func GetMixerBackend() string {
+	if mixerBackend == "" {
+		return "v2"
+	}
+	return mixerBackend
+}
+
+// GetMixerRenditions get encodings of the mixed video as name=kbps pairs split by comma,
+// empty is one encoding
+func GetMixerRenditions() string {
+	return renditions
+}
+
+// GetSeatRoles get seat number reserved for each role from role=number pairs split by comma,
+// such as host=1,presenter=2
+func GetSeatRoles() map[string]int {
+	roles := make(map[string]int)
+	for _, pair := range strings.Split(seatRoles, ",") {
+		kv := strings.SplitN(strings.TrimSpace(pair), "=", 2)
+		if len(kv) != 2 || kv[0] == "" {
+			continue
+		}
+		number, err := strconv.Atoi(kv[1])
+		if err != nil {
+			logs.Error("Get seat of role "+kv[0]+" err: ", err.Error())
+			continue
+		}
+		roles[kv[0]] = number
+	}
+	return roles
+}
+
+// GetCascadeAddr get address children one level below connect to, empty is accepting none
+func GetCascadeAddr() string {
+	return cascadeAddr
+}
+
+// GetCascadeParent get address of the node one level above, empty is mixing for local clients only
+func GetCascadeParent() string {
+	return cascadeParent
+}
+
+// GetCascadeID get participant id of this node at its parent, default is the host name
+func GetCascadeID() string {
+	if cascadeID != "" {
+		return cascadeID
+	}
+	host, err := os.Hostname()
+	if err != nil {
+		logs.Error("Get cascade id err: ", err.Error())
+		return "node"
+	}
+	return host
+}
+
+// GetRoleSecret get secret signing the role tokens of the join payload, empty is refusing every token
+func GetRoleSecret() []byte {
+	return []byte(roleSecret)
+}
+
+// GetModeratorRoles get roles allowed to moderate the room, default is host
+func GetModeratorRoles() []string {
+	if moderators == "" {
+		return []string{"host"}
+	}
+	roles := make([]string, 0)
+	for _, role := range strings.Split(moderators, ",") {
+		if role = strings.TrimSpace(role); role != "" {
+			roles = append(roles, role)
+		}
+	}
+	return roles
+}
+
+// GetRTMPHosts get hosts clients may push the mix to, env is comma separated, empty is none
+func GetRTMPHosts() []string {
+	hosts := make([]string, 0)
+	for _, host := range strings.Split(rtmpHosts, ",") {
+		if host = strings.TrimSpace(host); host != "" {
+			hosts = append(hosts, strings.ToLower(host))
+		}
+	}
+	return hosts
+}
+
+// GetRTSPHosts get hosts clients may pull cameras from, env is comma separated, empty is none
+func GetRTSPHosts() []string {
+	hosts := make([]string, 0)
+	for _, host := range strings.Split(rtspHosts, ",") {
+		if host = strings.TrimSpace(host); host != "" {
+			hosts = append(hosts, strings.ToLower(host))
+		}
+	}
+	return hosts
+}
+
+// GetIngestPorts get udp port range clients may ingest on, env is min-max, 0 0 is none
+func GetIngestPorts() (int, int) {
+	bounds := strings.SplitN(ingestPorts, "-", 2)
+	if len(bounds) != 2 {
+		return 0, 0
+	}
+	min, err := strconv.Atoi(strings.TrimSpace(bounds[0]))
+	if err != nil {
+		logs.Error("Get ingest ports err: ", err.Error())
+		return 0, 0
+	}
+	max, err := strconv.Atoi(strings.TrimSpace(bounds[1]))
+	if err != nil {
+		logs.Error("Get ingest ports err: ", err.Error())
+		return 0, 0
+	}
+	if min < 1 || max < min {
+		return 0, 0
+	}
+	return min, max
+}
+
+// GetIngestSources get networks ingested rtp may come from, env is comma separated ips or cidrs,
+// default is loopback only
+func GetIngestSources() []*net.IPNet {
+	value := ingestSources
+	if value == "" {
+		value = "127.0.0.0/8,::1/128"
+	}
+	return parseNetworks(value)
+}
+
+// parseNetworks comma separated ips or cidrs, invalid ones are logged and left out
+func parseNetworks(value string) []*net.IPNet {
+	networks := make([]*net.IPNet, 0)
+	for _, source := range strings.Split(value, ",") {
+		if source = strings.TrimSpace(source); source == "" {
+			continue
+		}
+		if !strings.Contains(source, "/") {
+			if ip := net.ParseIP(source); ip != nil && ip.To4() != nil {
+				source += "/32"
+			} else {
+				source += "/128"
+			}
+		}
+		_, network, err := net.ParseCIDR(source)
+		if err != nil {
+			logs.Error("Parse network "+source+" err: ", err.Error())
+			continue
+		}
+		networks = append(networks, network)
+	}
+	return networks
+}
+
+// GetCascadeSecret get secret shared by the nodes of a cascade, children without it are refused
+func GetCascadeSecret() []byte {
+	return []byte(cascadeSecret)
+}
+
+// GetCascadeAllow get networks children may connect from, env is comma separated ips or cidrs,
+// empty is any
+func GetCascadeAllow() []*net.IPNet {
+	return parseNetworks(cascadeAllow)
 }
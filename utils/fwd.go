@@ -11,7 +11,7 @@ import (
 
 // Wrapper linter
 type Wrapper struct {
-	Pkg    rtp.Packet // save rtp packet
+	Pkg    rtp.Packet `json:"-"`      // save rtp packet, sent between nodes as Data
 	Data   []byte     `json:"rtp"`    // packet to write
 	Kind   string     `json:"kind"`   // audio or video
 	SeatID int        `json:"seatID"` // stream id number 1-2-3-4
@@ -0,0 +1,117 @@
+package webm
+
+import (
+	"encoding/binary"
+	"math"
+)
+
+// element ids, see https://www.matroska.org/technical/elements.html
+const (
+	idEBML               = 0x1A45DFA3
+	idEBMLVersion        = 0x4286
+	idEBMLReadVersion    = 0x42F7
+	idEBMLMaxIDLength    = 0x42F2
+	idEBMLMaxSizeLength  = 0x42F3
+	idDocType            = 0x4282
+	idDocTypeVersion     = 0x4287
+	idDocTypeReadVersion = 0x4285
+	idSegment            = 0x18538067
+	idInfo               = 0x1549A966
+	idTimecodeScale      = 0x2AD7B1
+	idDuration           = 0x4489
+	idMuxingApp          = 0x4D80
+	idWritingApp         = 0x5741
+	idTracks             = 0x1654AE6B
+	idTrackEntry         = 0xAE
+	idTrackNumber        = 0xD7
+	idTrackUID           = 0x73C5
+	idTrackType          = 0x83
+	idCodecID            = 0x86
+	idCodecPrivate       = 0x63A2
+	idVideo              = 0xE0
+	idPixelWidth         = 0xB0
+	idPixelHeight        = 0xBA
+	idAudio              = 0xE1
+	idSamplingFrequency  = 0xB5
+	idChannels           = 0x9F
+	idCluster            = 0x1F43B675
+	idTimecode           = 0xE7
+	idSimpleBlock        = 0xA3
+	idCues               = 0x1C53BB6B
+	idCuePoint           = 0xBB
+	idCueTime            = 0xB3
+	idCueTrackPositions  = 0xB7
+	idCueTrack           = 0xF7
+	idCueClusterPosition = 0xF1
+)
+
+// unknownSize 8 bytes vint with all value bits set
+var unknownSize = []byte{0x01, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF}
+
+func encodeID(id uint32) []byte {
+	switch {
+	case id <= 0xFF:
+		return []byte{byte(id)}
+	case id <= 0xFFFF:
+		return []byte{byte(id >> 8), byte(id)}
+	case id <= 0xFFFFFF:
+		return []byte{byte(id >> 16), byte(id >> 8), byte(id)}
+	default:
+		return []byte{byte(id >> 24), byte(id >> 16), byte(id >> 8), byte(id)}
+	}
+}
+
+// encodeSize encode data size to the shortest vint
+func encodeSize(size uint64) []byte {
+	length := 1
+	for length < 8 && size >= 1<<(7*uint(length))-1 {
+		length++
+	}
+	out := make([]byte, length)
+	for i := length - 1; i >= 0; i-- {
+		out[i] = byte(size)
+		size >>= 8
+	}
+	out[0] |= 0x80 >> uint(length-1)
+	return out
+}
+
+// encodeSize8 encode data size to a 8 bytes vint, used for sizes rewritten later
+func encodeSize8(size uint64) []byte {
+	out := make([]byte, 8)
+	binary.BigEndian.PutUint64(out, size)
+	out[0] = 0x01
+	return out
+}
+
+func element(id uint32, payload ...[]byte) []byte {
+	size := 0
+	for _, p := range payload {
+		size += len(p)
+	}
+	out := append(encodeID(id), encodeSize(uint64(size))...)
+	for _, p := range payload {
+		out = append(out, p...)
+	}
+	return out
+}
+
+func uintElement(id uint32, value uint64) []byte {
+	data := make([]byte, 8)
+	binary.BigEndian.PutUint64(data, value)
+	i := 0
+	for i < 7 && data[i] == 0 {
+		i++
+	}
+	return element(id, data[i:])
+}
+
+func floatElement(id uint32, value float64) []byte {
+	data := make([]byte, 8)
+	binary.BigEndian.PutUint64(data, math.Float64bits(value))
+	return element(id, data)
+}
+
+func stringElement(id uint32, value string) []byte {
+	return element(id, []byte(value))
+}
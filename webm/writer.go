@@ -0,0 +1,315 @@
+package webm
+
+import (
+	"encoding/binary"
+	"io"
+	"math"
+	"sync"
+
+	"github.com/lamhai1401/testrtc/codec"
+)
+
+const (
+	videoTrackNumber = 1
+	audioTrackNumber = 2
+	maxClusterTime   = 5000          // ms, audio only files
+	maxRelativeTime  = math.MaxInt16 // ms, simple block relative timecode
+	muxingApp        = "testrtc"
+)
+
+type cue struct {
+	time     int64
+	position int64 // cluster position from segment data start
+}
+
+// Writer mux vp8 and opus frames to a webm file with keyframe cues.
+// Video frames must start with a keyframe, audio before it is dropped
+type Writer struct {
+	out          io.WriteSeeker
+	pos          int64 // current write position
+	hasVideo     bool
+	hasAudio     bool
+	sampleRate   uint32
+	channels     uint16
+	started      bool
+	segmentPos   int64 // position of segment size
+	segmentStart int64 // position of segment data
+	durationPos  int64 // position of duration value
+	cluster      []byte
+	clusterTime  int64
+	hasCluster   bool
+	cues         []*cue
+	lastTime     int64
+	isClosed     bool
+	mutex        sync.Mutex
+}
+
+// NewWriter linter
+func NewWriter(out io.WriteSeeker, hasVideo, hasAudio bool, sampleRate uint32, channels uint16) *Writer {
+	return &Writer{
+		out:        out,
+		hasVideo:   hasVideo,
+		hasAudio:   hasAudio,
+		sampleRate: sampleRate,
+		channels:   channels,
+		cues:       make([]*cue, 0),
+	}
+}
+
+// WriteVideo write a vp8 frame at ms from start of recording
+func (w *Writer) WriteVideo(frame *codec.Frame, ms int64) error {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	if w.isClosed || !w.hasVideo {
+		return nil
+	}
+	if !w.started {
+		if !frame.Keyframe {
+			return nil
+		}
+		if err := w.writeHeader(frame.Width, frame.Height); err != nil {
+			return err
+		}
+	}
+
+	if frame.Keyframe || w.needCluster(ms) {
+		if err := w.newCluster(ms, frame.Keyframe); err != nil {
+			return err
+		}
+	}
+	w.addBlock(videoTrackNumber, frame.Data, ms, frame.Keyframe)
+	return nil
+}
+
+// WriteAudio write an opus frame at ms from start of recording
+func (w *Writer) WriteAudio(data []byte, ms int64) error {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	if w.isClosed || !w.hasAudio {
+		return nil
+	}
+	if !w.started {
+		if w.hasVideo {
+			return nil
+		}
+		if err := w.writeHeader(0, 0); err != nil {
+			return err
+		}
+	}
+
+	if w.needCluster(ms) {
+		// audio only file, every cluster can be a seek point
+		if err := w.newCluster(ms, !w.hasVideo); err != nil {
+			return err
+		}
+	}
+	w.addBlock(audioTrackNumber, data, ms, true)
+	return nil
+}
+
+// Close flush last cluster, write cues and fix sizes and duration
+func (w *Writer) Close() error {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	if w.isClosed {
+		return nil
+	}
+	w.isClosed = true
+
+	if !w.started {
+		return nil
+	}
+	if err := w.flushCluster(); err != nil {
+		return err
+	}
+	if err := w.writeCues(); err != nil {
+		return err
+	}
+
+	end := w.pos
+	if err := w.writeAt(w.segmentPos, encodeSize8(uint64(end-w.segmentStart))); err != nil {
+		return err
+	}
+
+	duration := make([]byte, 8)
+	binary.BigEndian.PutUint64(duration, math.Float64bits(float64(w.lastTime)))
+	if err := w.writeAt(w.durationPos, duration); err != nil {
+		return err
+	}
+
+	_, err := w.out.Seek(end, io.SeekStart)
+	return err
+}
+
+func (w *Writer) write(data []byte) error {
+	n, err := w.out.Write(data)
+	w.pos += int64(n)
+	return err
+}
+
+func (w *Writer) writeAt(pos int64, data []byte) error {
+	if _, err := w.out.Seek(pos, io.SeekStart); err != nil {
+		return err
+	}
+	_, err := w.out.Write(data)
+	return err
+}
+
+func (w *Writer) writeHeader(width, height uint16) error {
+	header := element(idEBML,
+		uintElement(idEBMLVersion, 1),
+		uintElement(idEBMLReadVersion, 1),
+		uintElement(idEBMLMaxIDLength, 4),
+		uintElement(idEBMLMaxSizeLength, 8),
+		stringElement(idDocType, "webm"),
+		uintElement(idDocTypeVersion, 4),
+		uintElement(idDocTypeReadVersion, 2),
+	)
+	if err := w.write(header); err != nil {
+		return err
+	}
+
+	// segment size is unknown until close
+	if err := w.write(encodeID(idSegment)); err != nil {
+		return err
+	}
+	w.segmentPos = w.pos
+	if err := w.write(unknownSize); err != nil {
+		return err
+	}
+	w.segmentStart = w.pos
+
+	// duration is the last child so its position is easy to find
+	info := element(idInfo,
+		uintElement(idTimecodeScale, 1000000), // ms
+		stringElement(idMuxingApp, muxingApp),
+		stringElement(idWritingApp, muxingApp),
+		floatElement(idDuration, 0),
+	)
+	w.durationPos = w.pos + int64(len(info)) - 8
+	if err := w.write(info); err != nil {
+		return err
+	}
+
+	entries := make([][]byte, 0, 2)
+	if w.hasVideo {
+		entries = append(entries, element(idTrackEntry,
+			uintElement(idTrackNumber, videoTrackNumber),
+			uintElement(idTrackUID, videoTrackNumber),
+			uintElement(idTrackType, 1),
+			stringElement(idCodecID, "V_VP8"),
+			element(idVideo,
+				uintElement(idPixelWidth, uint64(width)),
+				uintElement(idPixelHeight, uint64(height)),
+			),
+		))
+	}
+	if w.hasAudio {
+		entries = append(entries, element(idTrackEntry,
+			uintElement(idTrackNumber, audioTrackNumber),
+			uintElement(idTrackUID, audioTrackNumber),
+			uintElement(idTrackType, 2),
+			stringElement(idCodecID, "A_OPUS"),
+			element(idCodecPrivate, opusHead(w.sampleRate, w.channels)),
+			element(idAudio,
+				floatElement(idSamplingFrequency, float64(w.sampleRate)),
+				uintElement(idChannels, uint64(w.channels)),
+			),
+		))
+	}
+	if err := w.write(element(idTracks, entries...)); err != nil {
+		return err
+	}
+
+	w.started = true
+	return nil
+}
+
+func (w *Writer) needCluster(ms int64) bool {
+	if !w.hasCluster {
+		return true
+	}
+	relative := ms - w.clusterTime
+	if relative >= maxRelativeTime || relative < -maxRelativeTime {
+		return true
+	}
+	return !w.hasVideo && relative >= maxClusterTime
+}
+
+func (w *Writer) newCluster(ms int64, isCue bool) error {
+	if err := w.flushCluster(); err != nil {
+		return err
+	}
+	w.cluster = uintElement(idTimecode, uint64(ms))
+	w.clusterTime = ms
+	w.hasCluster = true
+	if isCue {
+		w.cues = append(w.cues, &cue{
+			time:     ms,
+			position: w.pos - w.segmentStart,
+		})
+	}
+	return nil
+}
+
+func (w *Writer) flushCluster() error {
+	if !w.hasCluster {
+		return nil
+	}
+	err := w.write(element(idCluster, w.cluster))
+	w.cluster = nil
+	w.hasCluster = false
+	return err
+}
+
+func (w *Writer) addBlock(track uint64, data []byte, ms int64, keyframe bool) {
+	header := make([]byte, 4)
+	header[0] = 0x80 | byte(track) // track number as 1 byte vint
+	binary.BigEndian.PutUint16(header[1:3], uint16(int16(ms-w.clusterTime)))
+	if keyframe {
+		header[3] = 0x80
+	}
+	w.cluster = append(w.cluster, element(idSimpleBlock, header, data)...)
+	if ms > w.lastTime {
+		w.lastTime = ms
+	}
+}
+
+func (w *Writer) writeCues() error {
+	if len(w.cues) == 0 {
+		return nil
+	}
+
+	track := uint64(audioTrackNumber)
+	if w.hasVideo {
+		track = videoTrackNumber
+	}
+
+	points := make([][]byte, 0, len(w.cues))
+	for _, c := range w.cues {
+		points = append(points, element(idCuePoint,
+			uintElement(idCueTime, uint64(c.time)),
+			element(idCueTrackPositions,
+				uintElement(idCueTrack, track),
+				uintElement(idCueClusterPosition, uint64(c.position)),
+			),
+		))
+	}
+	return w.write(element(idCues, points...))
+}
+
+// opusHead codec private data of opus (RFC 7845 5.1)
+func opusHead(sampleRate uint32, channels uint16) []byte {
+	head := make([]byte, 19)
+	copy(head, "OpusHead")
+	head[8] = 1 // version
+	head[9] = byte(channels)
+	binary.LittleEndian.PutUint16(head[10:], 0) // pre skip
+	binary.LittleEndian.PutUint32(head[12:], sampleRate)
+	binary.LittleEndian.PutUint16(head[16:], 0) // output gain
+	head[18] = 0                                // mapping family
+	return head
+}
@@ -0,0 +1,68 @@
+package webm
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/lamhai1401/testrtc/codec"
+)
+
+func TestEncodeSize(t *testing.T) {
+	cases := map[uint64][]byte{
+		0:     {0x80},
+		126:   {0xFE},
+		127:   {0x40, 0x7F},
+		16382: {0x7F, 0xFE},
+	}
+	for size, want := range cases {
+		if got := encodeSize(size); !bytes.Equal(got, want) {
+			t.Fatalf("size %d: expect %x, got %x", size, want, got)
+		}
+	}
+}
+
+func TestWriterStartOnKeyframe(t *testing.T) {
+	file, err := ioutil.TempFile("", "*.webm")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(file.Name())
+	defer file.Close()
+
+	w := NewWriter(file, true, true, 48000, 2)
+	if err := w.WriteAudio([]byte{1}, 0); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.WriteVideo(&codec.Frame{Data: []byte{2}}, 10); err != nil {
+		t.Fatal(err)
+	}
+	if w.started {
+		t.Fatal("writer must wait for a keyframe")
+	}
+
+	if err := w.WriteVideo(&codec.Frame{Data: []byte{3}, Keyframe: true, Width: 640, Height: 480}, 20); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.WriteAudio([]byte{4}, 30); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := ioutil.ReadFile(file.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.HasPrefix(data, encodeID(idEBML)) {
+		t.Fatal("missing ebml header")
+	}
+	if !bytes.Contains(data, encodeID(idCues)) {
+		t.Fatal("missing cues")
+	}
+	if w.lastTime != 30 || len(w.cues) != 1 || w.cues[0].time != 20 {
+		t.Fatalf("wrong cues: %+v, last time %d", w.cues, w.lastTime)
+	}
+}